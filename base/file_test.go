@@ -0,0 +1,50 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gob")
+	// write and read
+	err = WriteGob(path, map[string]int{"a": 1, "b": 2})
+	assert.Nil(t, err)
+	var m map[string]int
+	err = ReadGob(path, &m)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, m)
+	// overwrite
+	err = WriteGob(path, map[string]int{"c": 3})
+	assert.Nil(t, err)
+	m = nil
+	err = ReadGob(path, &m)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"c": 3}, m)
+	// no temporary files are left
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	// read file not existed
+	err = ReadGob(filepath.Join(dir, "none"), &m)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -25,6 +25,7 @@ type Index interface {
 	ToNumber(name string) int
 	ToName(index int) string
 	GetNames() []string
+	Clone() Index
 }
 
 func init() {
@@ -83,6 +84,19 @@ func (idx *MapIndex) GetNames() []string {
 	return idx.Names
 }
 
+// Clone creates a copy of the MapIndex.
+func (idx *MapIndex) Clone() Index {
+	clone := &MapIndex{
+		Numbers: make(map[string]int, len(idx.Numbers)),
+		Names:   make([]string, len(idx.Names)),
+	}
+	for name, number := range idx.Numbers {
+		clone.Numbers[name] = number
+	}
+	copy(clone.Names, idx.Names)
+	return clone
+}
+
 type DirectIndex struct {
 	Limit int
 }
@@ -130,3 +144,8 @@ func (idx *DirectIndex) GetNames() []string {
 	}
 	return names
 }
+
+// Clone creates a copy of the DirectIndex.
+func (idx *DirectIndex) Clone() Index {
+	return &DirectIndex{Limit: idx.Limit}
+}
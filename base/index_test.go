@@ -27,6 +27,12 @@ func TestMapIndex(t *testing.T) {
 	assert.Equal(t, "8", set.ToName(3))
 	// Get names
 	assert.Equal(t, []string{"1", "2", "4", "8"}, set.GetNames())
+	// Clone
+	clone := set.Clone()
+	clone.Add("16")
+	assert.Equal(t, 5, clone.Len())
+	assert.Equal(t, 4, set.Len())
+	assert.Equal(t, NotId, set.ToNumber("16"))
 }
 
 func TestDirectIndex(t *testing.T) {
@@ -0,0 +1,71 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"os"
+	"strconv"
+)
+
+func init() {
+	cliCommand.AddCommand(diagnoseCommand)
+}
+
+var diagnoseCommand = &cobra.Command{
+	Use:   "diagnose",
+	Short: "Diagnose data store",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		// Open database
+		database, err := data.Open(globalConfig.Database.DataStore, tenant)
+		if err != nil {
+			log.Fatalf("cli: failed to connect database (%v)", err)
+		}
+		defer database.Close()
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"problem", "detail"})
+		// Pending migrations
+		migrations, err := database.Migrate(ctx, true)
+		if err != nil {
+			log.Fatalf("cli: failed to check migrations (%v)", err)
+		}
+		for _, migration := range migrations {
+			table.Append([]string{"pending migration", strconv.Itoa(migration.Version) + ": " + migration.Description})
+		}
+		// Missing indexes
+		problems := len(migrations)
+		if mongoDB, ok := database.(*data.MongoDB); ok {
+			indexes, err := mongoDB.MissingIndexes(ctx)
+			if err != nil {
+				log.Fatalf("cli: failed to check indexes (%v)", err)
+			}
+			for _, index := range indexes {
+				table.Append([]string{"missing index", index})
+			}
+			problems += len(indexes)
+		}
+		if problems == 0 {
+			fmt.Println("No problem found.")
+			return
+		}
+		table.Render()
+		fmt.Println("Run `gorse-cli migrate` to fix these problems.")
+	},
+}
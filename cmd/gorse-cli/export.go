@@ -14,6 +14,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -74,7 +75,7 @@ var exportFeedbackCommand = &cobra.Command{
 
 func exportFeedback(csvFile, feedbackType string, sep string, printHeader bool, batchSize int) {
 	// Open database
-	database, err := data.Open(globalConfig.Database.DataStore)
+	database, err := data.OpenWithReplica(globalConfig.Database.DataStore, globalConfig.Database.DataStoreReplica, tenant)
 	if err != nil {
 		log.Fatalf("cli: failed to connect database (%v)", err)
 	}
@@ -87,8 +88,8 @@ func exportFeedback(csvFile, feedbackType string, sep string, printHeader bool,
 	defer file.Close()
 	// Export feedbacks
 	if printHeader {
-		if _, err := file.WriteString(fmt.Sprintf("user_id%vitem_id%vtime_stamp\n",
-			sep, sep)); err != nil {
+		if _, err := file.WriteString(fmt.Sprintf("user_id%vitem_id%vtime_stamp%vvalue\n",
+			sep, sep, sep)); err != nil {
 			log.Fatalf("cli: failed to write file (%v)", err)
 		}
 	}
@@ -96,12 +97,13 @@ func exportFeedback(csvFile, feedbackType string, sep string, printHeader bool,
 	for {
 		var feedback []data.Feedback
 		var err error
-		cursor, feedback, err = database.GetFeedback(feedbackType, cursor, batchSize)
+		cursor, feedback, err = database.GetFeedback(context.Background(), feedbackType, cursor, batchSize, nil)
 		if err != nil {
 			log.Fatal(err)
 		}
 		for _, v := range feedback {
-			if _, err = file.WriteString(fmt.Sprintf("%v%v%v%v%v\n", v.UserId, sep, v.ItemId, sep, v.Timestamp)); err != nil {
+			if _, err = file.WriteString(fmt.Sprintf("%v%v%v%v%v%v%v\n",
+				v.UserId, sep, v.ItemId, sep, v.Timestamp, sep, v.Value)); err != nil {
 				log.Fatal(err)
 			}
 		}
@@ -113,7 +115,7 @@ func exportFeedback(csvFile, feedbackType string, sep string, printHeader bool,
 
 func exportItems(csvFile string, sep string, labelSep string, printHeader bool, batchSize int) {
 	// Open database
-	database, err := data.Open(globalConfig.Database.DataStore)
+	database, err := data.OpenWithReplica(globalConfig.Database.DataStore, globalConfig.Database.DataStoreReplica, tenant)
 	if err != nil {
 		log.Fatalf("cli: failed to connect database (%v)", err)
 	}
@@ -134,7 +136,7 @@ func exportItems(csvFile string, sep string, labelSep string, printHeader bool,
 	cursor := ""
 	for {
 		var items []data.Item
-		cursor, items, err = database.GetItems(cursor, batchSize)
+		cursor, items, err = database.GetItems(context.Background(), cursor, batchSize, nil)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -15,15 +15,19 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/araddon/dateparse"
 	"github.com/cheggaaa/pb/v3"
 	"github.com/olekukonko/tablewriter"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -34,6 +38,7 @@ func init() {
 	importItemCommand.PersistentFlags().StringP("sep", "s", ",", "Separator for csv file.")
 	importItemCommand.PersistentFlags().BoolP("header", "H", false, "Skip first line of csv file.")
 	importItemCommand.PersistentFlags().StringP("label-sep", "l", "|", "Separator for labels")
+	importItemCommand.PersistentFlags().IntP("batch-size", "b", 1024, "Batch size of writing data.")
 	importItemCommand.PersistentFlags().StringP("format", "f", "itl", "Columns of csv file "+
 		"(u - user, i - item, t - timestamp, l - labels, _ - meaningless).")
 	// import feedback
@@ -42,8 +47,9 @@ func init() {
 	importFeedbackCommand.PersistentFlags().StringP("type", "t", "", "Set feedback type.")
 	importFeedbackCommand.PersistentFlags().StringP("sep", "s", ",", "Separator for csv file.")
 	importFeedbackCommand.PersistentFlags().BoolP("header", "H", false, "Skip first line of csv file.")
+	importFeedbackCommand.PersistentFlags().IntP("batch-size", "b", 1024, "Batch size of writing data.")
 	importFeedbackCommand.PersistentFlags().StringP("format", "f", "uit", "Columns of csv file "+
-		"(u - user, i - item, t - timestamp, _ - meaningless).")
+		"(u - user, i - item, t - timestamp, v - value, _ - meaningless).")
 }
 
 var importCommand = &cobra.Command{
@@ -62,12 +68,13 @@ var importItemCommand = &cobra.Command{
 		header, _ := cmd.PersistentFlags().GetBool("header")
 		formatString, _ := cmd.PersistentFlags().GetString("format")
 		labelSep, _ := cmd.PersistentFlags().GetString("label-sep")
+		batchSize, _ := cmd.PersistentFlags().GetInt("batch-size")
 		if !skipPreview {
 			if ok := previewImportItems(csvFile, sep, labelSep, header, formatString); !ok {
 				return
 			}
 		}
-		importItems(csvFile, sep, labelSep, header, formatString)
+		importItems(csvFile, sep, labelSep, header, formatString, batchSize)
 	},
 }
 
@@ -128,7 +135,7 @@ func previewImportItems(csvFile string, sep string, labelSep string, hasHeader b
 	return true
 }
 
-func importItems(csvFile string, sep string, labelSep string, hasHeader bool, fmt string) {
+func importItems(csvFile string, sep string, labelSep string, hasHeader bool, fmt string, batchSize int) {
 	// Get file size
 	info, err := os.Stat(csvFile)
 	if err != nil {
@@ -142,7 +149,7 @@ func importItems(csvFile string, sep string, labelSep string, hasHeader bool, fm
 	}
 	defer file.Close()
 	// Open database
-	database, err := data.Open(globalConfig.Database.DataStore)
+	database, err := data.Open(globalConfig.Database.DataStore, tenant)
 	if err != nil {
 		log.Fatalf("cli: failed to connect database (%v)", err)
 	}
@@ -155,6 +162,13 @@ func importItems(csvFile string, sep string, labelSep string, hasHeader bool, fm
 	scanner := bufio.NewScanner(file)
 	bar := pb.StartNew(int(length))
 	lineCount := 0
+	items := make([]data.Item, 0, batchSize)
+	lines := make([]int, 0, batchSize)
+	insertItems := func() {
+		err := database.BatchInsertItem(context.Background(), items)
+		reportBatchError(err, lines)
+		items, lines = items[:0], lines[:0]
+	}
 	for scanner.Scan() {
 		line := scanner.Text()
 		// skip header
@@ -176,9 +190,10 @@ func importItems(csvFile string, sep string, labelSep string, hasHeader bool, fm
 		if splits[2] != "" {
 			item.Labels = strings.Split(splits[2], labelSep)
 		}
-		err := database.InsertItem(item)
-		if err != nil {
-			log.Fatal(err)
+		items = append(items, item)
+		lines = append(lines, lineCount)
+		if len(items) == batchSize {
+			insertItems()
 		}
 		bar.Add(len(line) + 1)
 		lineCount++
@@ -186,7 +201,9 @@ func importItems(csvFile string, sep string, labelSep string, hasHeader bool, fm
 	if err := scanner.Err(); err != nil {
 		log.Fatal(err)
 	}
+	insertItems()
 	bar.Finish()
+	notifyModified()
 }
 
 var importFeedbackCommand = &cobra.Command{
@@ -201,12 +218,13 @@ var importFeedbackCommand = &cobra.Command{
 		header, _ := cmd.PersistentFlags().GetBool("header")
 		fmtString, _ := cmd.PersistentFlags().GetString("format")
 		feedbackType, _ := cmd.PersistentFlags().GetString("type")
+		batchSize, _ := cmd.PersistentFlags().GetInt("batch-size")
 		if !skipPreview {
 			if ok := previewImportFeedback(csvFile, feedbackType, sep, header, fmtString); !ok {
 				return
 			}
 		}
-		importFeedback(csvFile, feedbackType, sep, header, fmtString)
+		importFeedback(csvFile, feedbackType, sep, header, fmtString, batchSize)
 	},
 }
 
@@ -219,7 +237,7 @@ func previewImportFeedback(csvFile string, feedbackType string, sep string, hasH
 	defer file.Close()
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"type", "user_id", "item_id", "timestamp"})
+	table.SetHeader([]string{"type", "user_id", "item_id", "timestamp", "value"})
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -227,7 +245,7 @@ func previewImportFeedback(csvFile string, feedbackType string, sep string, hasH
 			continue
 		}
 		splits := strings.Split(line, sep)
-		splits = format(fmtString, "uit", splits)
+		splits = format(fmtString, "uitv", splits)
 		if splits[0] == "" {
 			log.Fatalf("cli: invalid user id at line %v", table.NumLines())
 		}
@@ -239,12 +257,17 @@ func previewImportFeedback(csvFile string, feedbackType string, sep string, hasH
 		if err != nil {
 			log.Fatalf("cli: failed to parse datetime at line %v (%v)", table.NumLines(), err)
 		}
+		feedback.Value, err = parseFeedbackValue(splits[3])
+		if err != nil {
+			log.Fatalf("cli: failed to parse value at line %v (%v)", table.NumLines(), err)
+		}
 		// preview first 5 lines
 		table.Append([]string{
 			feedback.FeedbackType,
 			feedback.UserId,
 			feedback.ItemId,
 			fmt.Sprintf("%v", feedback.Timestamp),
+			fmt.Sprintf("%v", feedback.Value),
 		})
 		if table.NumLines() > 5 {
 			break
@@ -262,7 +285,7 @@ func previewImportFeedback(csvFile string, feedbackType string, sep string, hasH
 	return true
 }
 
-func importFeedback(csvFile, feedbackType string, sep string, hasHeader bool, fmtString string) {
+func importFeedback(csvFile, feedbackType string, sep string, hasHeader bool, fmtString string, batchSize int) {
 	// Get file size
 	info, err := os.Stat(csvFile)
 	if err != nil {
@@ -276,7 +299,7 @@ func importFeedback(csvFile, feedbackType string, sep string, hasHeader bool, fm
 	}
 	defer file.Close()
 	// Open database
-	database, err := data.Open(globalConfig.Database.DataStore)
+	database, err := data.Open(globalConfig.Database.DataStore, tenant)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -285,13 +308,38 @@ func importFeedback(csvFile, feedbackType string, sep string, hasHeader bool, fm
 	scanner := bufio.NewScanner(file)
 	bar := pb.StartNew(int(length))
 	lineCount := 0
+	feedbacks := make([]data.Feedback, 0, batchSize)
+	lines := make([]int, 0, batchSize)
+	insert := database.BatchInsertFeedback
+	if globalConfig.Database.CountFeedback {
+		insert = database.BatchCountFeedback
+	}
+	insertFeedback := func() {
+		err := insert(context.Background(), feedbacks,
+			globalConfig.Database.AutoInsertUser, globalConfig.Database.AutoInsertItem)
+		reportBatchError(err, lines)
+		feedbacks, lines = feedbacks[:0], lines[:0]
+	}
+	// erased users aren't inserted again along with feedback
+	erased := make(map[string]bool)
+	isErased := func(userId string) bool {
+		if result, checked := erased[userId]; checked {
+			return result
+		}
+		_, err := database.GetErasure(context.Background(), userId)
+		if err != nil && err.Error() != data.ErrErasureNotExist {
+			log.Fatalf("cli: failed to get erasure (%v)", err)
+		}
+		erased[userId] = err == nil
+		return erased[userId]
+	}
 	for scanner.Scan() {
 		line := scanner.Text()
 		if hasHeader {
 			continue
 		}
 		splits := strings.Split(line, sep)
-		splits = format(fmtString, "uit", splits)
+		splits = format(fmtString, "uitv", splits)
 		if splits[0] == "" {
 			log.Fatalf("cli: invalid user id at line %v", lineCount)
 		}
@@ -303,9 +351,18 @@ func importFeedback(csvFile, feedbackType string, sep string, hasHeader bool, fm
 		if err != nil {
 			log.Fatalf("cli: failed to parse datetime at line %v (%v)", lineCount, err)
 		}
-		err = database.InsertFeedback(feedback, globalConfig.Database.AutoInsertUser, globalConfig.Database.AutoInsertItem)
+		feedback.Value, err = parseFeedbackValue(splits[3])
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("cli: failed to parse value at line %v (%v)", lineCount, err)
+		}
+		if globalConfig.Database.AutoInsertUser && isErased(feedback.UserId) {
+			log.Warnf("cli: skip feedback of erased user at line %v (user_id = %v)", lineCount, feedback.UserId)
+		} else {
+			feedbacks = append(feedbacks, feedback)
+			lines = append(lines, lineCount)
+			if len(feedbacks) == batchSize {
+				insertFeedback()
+			}
 		}
 		bar.Add(len(line) + 1)
 		lineCount++
@@ -313,7 +370,46 @@ func importFeedback(csvFile, feedbackType string, sep string, hasHeader bool, fm
 	if err := scanner.Err(); err != nil {
 		log.Fatal(err)
 	}
+	insertFeedback()
 	bar.Finish()
+	notifyModified()
+}
+
+// notifyModified notifies the master to pull datasets entirely since imported rows might be older than the window of
+// incremental pulls.
+func notifyModified() {
+	cacheStore, err := cache.Open(globalConfig.Database.CacheStore, tenant)
+	if err != nil {
+		log.Fatalf("cli: failed to connect cache store (%v)", err)
+	}
+	defer cacheStore.Close()
+	if err = cacheStore.SetString(context.Background(), cache.GlobalMeta, cache.LastModifyTime,
+		time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		log.Fatalf("cli: failed to notify master (%v)", err)
+	}
+}
+
+// reportBatchError logs rows failed in a batch insertion. The i-th row is at lines[i] of the file.
+func reportBatchError(err error, lines []int) {
+	if batchError, ok := err.(*data.BatchError); ok {
+		for _, i := range batchError.Indices() {
+			log.Errorf("cli: failed to insert line %v (%v)", lines[i], batchError.Errors[i])
+		}
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseFeedbackValue parses the value of feedback. The default value is used if the value is empty.
+func parseFeedbackValue(s string) (float64, error) {
+	if s == "" {
+		return data.DefaultFeedbackValue, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value, data.ValidateFeedbackValue(value)
 }
 
 func format(inFmt string, outFmt string, s []string) []string {
@@ -25,14 +25,21 @@ import (
 	"github.com/zhenghaoz/gorse/protocol"
 	"google.golang.org/grpc"
 	"log"
+	"net"
+	"strconv"
+	"strings"
 )
 
 var configPath = model.GorseDir + "/cli.toml"
 var masterClient protocol.MasterClient
 var globalConfig config.Config
 
+// tenant is the tenant operated by commands. The default tenant is operated if it's empty.
+var tenant string
+
 func init() {
 	cliCommand.AddCommand(versionCommand)
+	cliCommand.PersistentFlags().StringVar(&tenant, "tenant", "", "tenant to operate")
 
 	// load cli config
 	cliConfig, _, err := config.LoadConfig(configPath)
@@ -40,8 +47,12 @@ func init() {
 		logrus.Fatalf("cli: failed to load config from %v", configPath)
 	}
 
-	// create connection
-	conn, err := grpc.Dial(fmt.Sprintf("%v:%v", cliConfig.Master.Host, cliConfig.Master.Port), grpc.WithInsecure())
+	// create connection to masters listed, or the master host if no master is listed
+	addresses := protocol.MasterAddresses(strings.Join(cliConfig.Master.MasterAddresses, ","), cliConfig.Master.Port)
+	if len(addresses) == 0 {
+		addresses = []string{net.JoinHostPort(cliConfig.Master.Host, strconv.Itoa(cliConfig.Master.Port))}
+	}
+	conn, err := protocol.DialMasters(addresses, grpc.WithInsecure())
 	if err != nil {
 		logrus.Fatalf("cli: failed to connect master (%v)", err)
 	}
@@ -67,6 +78,11 @@ func main() {
 var cliCommand = &cobra.Command{
 	Use:   "gorse-cli",
 	Short: "CLI for gorse recommender system.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if _, exist := globalConfig.Tenant(tenant); !exist {
+			logrus.Fatalf("cli: tenant not exist (%v)", tenant)
+		}
+	},
 }
 
 var versionCommand = &cobra.Command{
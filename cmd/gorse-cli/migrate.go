@@ -0,0 +1,62 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"os"
+	"strconv"
+)
+
+func init() {
+	cliCommand.AddCommand(migrateCommand)
+	migrateCommand.PersistentFlags().Bool("dry-run", false, "Show pending migrations without applying them.")
+}
+
+var migrateCommand = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate schema of data store",
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.PersistentFlags().GetBool("dry-run")
+		// Open database
+		database, err := data.Open(globalConfig.Database.DataStore, tenant)
+		if err != nil {
+			log.Fatalf("cli: failed to connect database (%v)", err)
+		}
+		defer database.Close()
+		// Migrate
+		migrations, err := database.Migrate(context.Background(), dryRun)
+		status := "applied"
+		if dryRun {
+			status = "pending"
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"version", "description", "status"})
+		for _, migration := range migrations {
+			table.Append([]string{strconv.Itoa(migration.Version), migration.Description, status})
+		}
+		table.Render()
+		if err != nil {
+			log.Fatalf("cli: failed to migrate database (%v)", err)
+		}
+		if len(migrations) == 0 {
+			fmt.Println("Schema is up to date.")
+		}
+	},
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/zhenghaoz/gorse/protocol"
+	"os"
+	"strconv"
+)
+
+func init() {
+	cliCommand.AddCommand(modelCommand)
+	modelCommand.AddCommand(modelListCommand)
+	modelCommand.AddCommand(modelPromoteCommand)
+	modelCommand.AddCommand(modelRollbackCommand)
+}
+
+var modelCommand = &cobra.Command{
+	Use:   "model",
+	Short: "Manage versions of models in the model registry",
+}
+
+var modelListCommand = &cobra.Command{
+	Use:   "list match|rank",
+	Short: "List versions of a model",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := protocol.WithTenant(context.Background(), tenant)
+		versions, err := masterClient.ListModels(ctx, &protocol.ModelQuery{Type: args[0]})
+		if err != nil {
+			log.Fatalf("cli: failed to list models (%v)", err)
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"version", "name", "fit time", "score", "params", "users", "items", "feedback", "status"})
+		for _, version := range versions.Versions {
+			status := ""
+			if version.Serving {
+				status = "serving"
+				if versions.Pinned {
+					status = "serving (pinned)"
+				}
+			} else if version.Rejected {
+				status = "rejected"
+			}
+			table.Append([]string{
+				fmt.Sprintf("%x", version.Version),
+				version.Name,
+				version.FitTime,
+				version.Score,
+				version.Params,
+				strconv.FormatInt(version.UserCount, 10),
+				strconv.FormatInt(version.ItemCount, 10),
+				strconv.FormatInt(version.FeedbackCount, 10),
+				status,
+			})
+		}
+		table.Render()
+	},
+}
+
+var modelPromoteCommand = &cobra.Command{
+	Use:   "promote match|rank version|latest",
+	Short: "Serve a version of a model until another version is promoted",
+	Long: "Serve a version of a model until another version is promoted. Versions are hexadecimal as listed. " +
+		"Promoting \"latest\" serves the latest version not rejected and newly fitted versions again.",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var version int64
+		if args[1] != "latest" {
+			var err error
+			if version, err = strconv.ParseInt(args[1], 16, 64); err != nil || version == 0 {
+				log.Fatalf("cli: invalid version (%v)", args[1])
+			}
+		}
+		ctx := protocol.WithTenant(context.Background(), tenant)
+		promoted, err := masterClient.PromoteModel(ctx, &protocol.ModelQuery{Type: args[0], Version: version})
+		if err != nil {
+			log.Fatalf("cli: failed to promote model (%v)", err)
+		}
+		fmt.Printf("Serving %v model of version %x.\n", args[0], promoted.Version)
+	},
+}
+
+var modelRollbackCommand = &cobra.Command{
+	Use:   "rollback match|rank",
+	Short: "Serve the version before the serving version of a model",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := protocol.WithTenant(context.Background(), tenant)
+		promoted, err := masterClient.RollbackModel(ctx, &protocol.ModelQuery{Type: args[0]})
+		if err != nil {
+			log.Fatalf("cli: failed to rollback model (%v)", err)
+		}
+		fmt.Printf("Serving %v model of version %x.\n", args[0], promoted.Version)
+	},
+}
@@ -58,7 +58,7 @@ var statusCommand = &cobra.Command{
 	Short: "status of recommender system",
 	Run: func(cmd *cobra.Command, args []string) {
 		// connect to cache store
-		cacheStore, err := cache.Open(globalConfig.Database.CacheStore)
+		cacheStore, err := cache.Open(globalConfig.Database.CacheStore, tenant)
 		if err != nil {
 			log.Fatal("cli:", err)
 		}
@@ -75,8 +75,8 @@ var statusCommand = &cobra.Command{
 		table := tablewriter.NewWriter(os.Stdout)
 		table.SetHeader([]string{"status", "value"})
 		for _, stat := range status {
-			val, err := cacheStore.GetString(cache.GlobalMeta, stat)
-			if err != nil && err.Error() != "redis: nil" {
+			val, err := cacheStore.GetString(context.Background(), cache.GlobalMeta, stat)
+			if err != nil && err.Error() != cache.ErrObjectNotExist {
 				log.Fatal("cli:", err)
 			}
 			table.Append([]string{stat, val})
@@ -89,7 +89,8 @@ var configCommand = &cobra.Command{
 	Use:   "config",
 	Short: "config of recommender system",
 	Run: func(cmd *cobra.Command, args []string) {
-		bytes, err := json.MarshalIndent(globalConfig, "", "\t")
+		tenantConfig, _ := globalConfig.Tenant(tenant)
+		bytes, err := json.MarshalIndent(tenantConfig, "", "\t")
 		if err != nil {
 			log.Fatalf("cli: failed to marshall JSON (%v)", err)
 		}
@@ -14,6 +14,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
@@ -183,14 +184,14 @@ var testMatchCommand = &cobra.Command{
 			numTestUsers, _ := cmd.PersistentFlags().GetInt("n-test-users")
 			seed, _ := cmd.PersistentFlags().GetInt("random-state")
 			// Open database
-			database, err := data.Open(globalConfig.Database.DataStore)
+			database, err := data.OpenWithReplica(globalConfig.Database.DataStore, globalConfig.Database.DataStoreReplica, tenant)
 			if err != nil {
 				log.Fatalf("cli: failed to connect database (%v)", err)
 			}
 			defer database.Close()
 			// Load data
 			log.Infof("Load data from database")
-			data, _, err := cf.LoadDataFromDatabase(database, []string{feedbackType})
+			data, _, err := cf.LoadDataFromDatabase(context.Background(), database, []string{feedbackType})
 			if err != nil {
 				log.Fatalf("cli: failed to load data from database (%v)", err)
 			}
@@ -259,7 +260,7 @@ var testRankCommand = &cobra.Command{
 			// load dataset
 			feedbackType, _ := cmd.PersistentFlags().GetString("feedback-type")
 			// Open database
-			database, err := data.Open(globalConfig.Database.DataStore)
+			database, err := data.OpenWithReplica(globalConfig.Database.DataStore, globalConfig.Database.DataStoreReplica, tenant)
 			if err != nil {
 				log.Fatalf("cli: failed to connect database (%v)", err)
 			}
@@ -267,7 +268,7 @@ var testRankCommand = &cobra.Command{
 			seed, _ := cmd.PersistentFlags().GetInt64("seed")
 			testRatio, _ := cmd.PersistentFlags().GetFloat32("test-ratio")
 			log.Infof("Load data from database")
-			dataSet, err := rank.LoadDataFromDatabase(database, []string{feedbackType})
+			dataSet, err := rank.LoadDataFromDatabase(context.Background(), database, []string{feedbackType})
 			if err != nil {
 				log.Fatalf("cli: failed to load data from database (%v)", err)
 			}
@@ -20,6 +20,9 @@ import (
 	"github.com/zhenghaoz/gorse/cmd/version"
 	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/master"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 var masterCommand = &cobra.Command{
@@ -38,7 +41,19 @@ var masterCommand = &cobra.Command{
 		if err != nil {
 			log.Fatal(err)
 		}
+		// the advertise address differs between masters sharing a configuration file
+		if cmd.PersistentFlags().Changed("advertise-address") {
+			conf.Master.AdvertiseAddress, _ = cmd.PersistentFlags().GetString("advertise-address")
+		}
 		l := master.NewMaster(conf, meta)
+		// shutdown gracefully once interrupted
+		go func() {
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			<-signals
+			log.Info("master: shutting down")
+			l.Shutdown()
+		}()
 		l.Serve()
 	},
 }
@@ -48,6 +63,7 @@ func init() {
 	masterCommand.PersistentFlags().BoolP("version", "v", false, "gorse version")
 	masterCommand.PersistentFlags().Int("port", 8086, "port of master node")
 	masterCommand.PersistentFlags().String("host", "127.0.0.1", "host of master node")
+	masterCommand.PersistentFlags().String("advertise-address", "", "address other master nodes reach this master node by")
 }
 
 func main() {
@@ -44,7 +44,7 @@ var serverCommand = &cobra.Command{
 func init() {
 	serverCommand.PersistentFlags().BoolP("version", "v", false, "gorse version")
 	serverCommand.PersistentFlags().Int("master-port", 8086, "port of master node")
-	serverCommand.PersistentFlags().String("master-host", "127.0.0.1", "host of master node")
+	serverCommand.PersistentFlags().String("master-host", "127.0.0.1", "hosts of master nodes separated by commas")
 	serverCommand.PersistentFlags().Int("port", 8087, "port of server node")
 	serverCommand.PersistentFlags().String("host", "127.0.0.1", "host of server node")
 }
@@ -34,7 +34,7 @@ var workerCommand = &cobra.Command{
 }
 
 func init() {
-	workerCommand.PersistentFlags().String("master-host", "127.0.0.1", "host of master node")
+	workerCommand.PersistentFlags().String("master-host", "127.0.0.1", "hosts of master nodes separated by commas")
 	workerCommand.PersistentFlags().Int("master-port", 8086, "port of master node")
 	workerCommand.PersistentFlags().IntP("jobs", "j", runtime.NumCPU(), "number of working jobs.")
 }
@@ -15,9 +15,11 @@ package config
 
 import (
 	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
 	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/cf"
 	"github.com/zhenghaoz/gorse/model/rank"
+	"regexp"
 )
 
 // Config is the configuration for the engine.
@@ -32,6 +34,39 @@ type Config struct {
 	Rank    RankConfig    `toml:"rank"`
 	// nodes
 	Master MasterConfig `toml:"master"`
+	// Tenants are configurations of tenants other than the default tenant indexed by their names.
+	Tenants map[string]*TenantConfig `toml:"-"`
+}
+
+// TenantConfig is the configuration for a tenant. Settings missing in a tenant are inherited from the top level.
+type TenantConfig struct {
+	Similar SimilarConfig `toml:"similar"`
+	Latest  LatestConfig  `toml:"latest"`
+	Popular PopularConfig `toml:"popular"`
+	CF      CFConfig      `toml:"cf"`
+	Rank    RankConfig    `toml:"rank"`
+}
+
+// tenantNamePattern restricts tenant names since they are parts of table names, collection names and keys.
+var tenantNamePattern = regexp.MustCompile("^[A-Za-z0-9_]+$")
+
+// Tenant returns the configuration for a tenant, whose strategies are replaced by settings of the tenant. The
+// configuration itself is returned for the default tenant, whose name is empty.
+func (config *Config) Tenant(name string) (*Config, bool) {
+	if name == "" {
+		return config, true
+	}
+	tenant, exist := config.Tenants[name]
+	if !exist {
+		return nil, false
+	}
+	tenantConfig := *config
+	tenantConfig.Similar = tenant.Similar
+	tenantConfig.Latest = tenant.Latest
+	tenantConfig.Popular = tenant.Popular
+	tenantConfig.CF = tenant.CF
+	tenantConfig.Rank = tenant.Rank
+	return &tenantConfig, true
 }
 
 func (config *Config) LoadDefaultIfNil() *Config {
@@ -119,6 +154,8 @@ type CFConfig struct {
 	Candidates   int `toml:"n_candidates"` // number of candidates for test
 	TopK         int `toml:"top_k"`        // evaluate top k recommendations
 	NumTestUsers int `toml:"n_test_users"` // number of users in test set
+	// tenant is the name of the tenant if the configuration belongs to a tenant.
+	tenant string
 }
 
 func (c *CFConfig) LoadDefaultIfNil() *CFConfig {
@@ -165,7 +202,7 @@ func (c *CFConfig) GetParams(metaData *toml.MetaData) model.Params {
 	}
 	params := model.Params{}
 	for _, v := range values {
-		if metaData.IsDefined("cf", v.name) {
+		if metaData.IsDefined("cf", v.name) || (c.tenant != "" && metaData.IsDefined("tenants", c.tenant, "cf", v.name)) {
 			params[v.key] = v.value
 		}
 	}
@@ -189,6 +226,8 @@ type RankConfig struct {
 	UseBias     bool    `toml:"use_bias"`     // use bias
 	InitMean    float64 `toml:"init_mean"`    // mean of gaussian initial parameter
 	InitStdDev  float64 `toml:"init_std"`     // standard deviation of gaussian initial parameter
+	// tenant is the name of the tenant if the configuration belongs to a tenant.
+	tenant string
 }
 
 func (c *RankConfig) LoadDefaultIfNil() *RankConfig {
@@ -228,7 +267,7 @@ func (c *RankConfig) GetParams(metaData *toml.MetaData) model.Params {
 	}
 	params := model.Params{}
 	for _, v := range values {
-		if metaData.IsDefined("rank", v.name) {
+		if metaData.IsDefined("rank", v.name) || (c.tenant != "" && metaData.IsDefined("tenants", c.tenant, "rank", v.name)) {
 			params[v.key] = v.value
 		}
 	}
@@ -237,10 +276,29 @@ func (c *RankConfig) GetParams(metaData *toml.MetaData) model.Params {
 
 // MasterConfig is the configuration for the master.
 type MasterConfig struct {
-	Port               int    `toml:"port"`
-	Host               string `toml:"host"`
-	Jobs               int    `toml:"jobs"`
-	ClusterMetaTimeout int    `toml:"cluster_meta_timeout"`
+	Port int `toml:"port"`
+	// Host is the host the master binds to.
+	Host string `toml:"host"`
+	// AdvertiseAddress is the address other masters reach the master by, which identifies the master in the leader
+	// election. It's required if masters bind to unspecified hosts such as "0.0.0.0", otherwise the hostname is used.
+	AdvertiseAddress string `toml:"advertise_address"`
+	// MasterAddresses are addresses of masters connected by clients. The port is used by addresses without ports, and
+	// clients connect to the host if no address is listed.
+	MasterAddresses    []string `toml:"master_addresses"`
+	Jobs               int      `toml:"jobs"`
+	ClusterMetaTimeout int      `toml:"cluster_meta_timeout"`
+	// ModelDir is the directory where trained models are persisted, and models aren't persisted if it's empty. Masters
+	// electing a leader must share the directory, so that a new leader reloads models persisted by the previous one.
+	ModelDir string `toml:"model_dir"`
+	// NumModelVersions is the number of versions of each model kept in the model registry.
+	NumModelVersions int `toml:"n_model_versions"`
+	// ModelTolerance is the maximal relative regression of the validation score of a new model from the baseline, which
+	// is the score of the serving version in the model registry. New models regressing beyond the tolerance are recorded in
+	// the model registry but not served.
+	ModelTolerance float64 `toml:"model_tolerance"`
+	// LeaderLease is the lease (in seconds) of the leader lock in the cache store. Masters sharing the cache store elect
+	// a leader, and a new leader is elected once the lease expires without renewal.
+	LeaderLease int `toml:"leader_lease"`
 }
 
 func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
@@ -250,6 +308,9 @@ func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
 			Host:               "127.0.0.1",
 			Jobs:               2,
 			ClusterMetaTimeout: 60,
+			NumModelVersions:   5,
+			ModelTolerance:     0.1,
+			LeaderLease:        10,
 		}
 	}
 	return config
@@ -259,12 +320,16 @@ func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
 type DatabaseConfig struct {
 	// database for data store
 	DataStore string `toml:"data_store"`
+	// read replica of data store for bulk reads
+	DataStoreReplica string `toml:"data_store_replica"`
 	// database for cache store
 	CacheStore string `toml:"cache_store"`
 	// insert new users while inserting feedback
 	AutoInsertUser bool `toml:"auto_insert_user"`
 	// insert new items while inserting feedback
 	AutoInsertItem bool `toml:"auto_insert_item"`
+	// count repeated feedback instead of ignoring them
+	CountFeedback bool `toml:"count_feedback"`
 }
 
 func (config *DatabaseConfig) LoadDefaultIfNil() *DatabaseConfig {
@@ -286,6 +351,9 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("database", "data_store") {
 		config.Database.DataStore = defaultDBConfig.DataStore
 	}
+	if !meta.IsDefined("database", "data_store_replica") {
+		config.Database.DataStoreReplica = defaultDBConfig.DataStoreReplica
+	}
 	if !meta.IsDefined("database", "cache_store") {
 		config.Database.CacheStore = defaultDBConfig.CacheStore
 	}
@@ -385,9 +453,21 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("master", "cluster_meta_timeout") {
 		config.Master.ClusterMetaTimeout = defaultMasterConfig.ClusterMetaTimeout
 	}
+	if !meta.IsDefined("master", "model_dir") {
+		config.Master.ModelDir = defaultMasterConfig.ModelDir
+	}
+	if !meta.IsDefined("master", "n_model_versions") {
+		config.Master.NumModelVersions = defaultMasterConfig.NumModelVersions
+	}
+	if !meta.IsDefined("master", "model_tolerance") {
+		config.Master.ModelTolerance = defaultMasterConfig.ModelTolerance
+	}
+	if !meta.IsDefined("master", "leader_lease") {
+		config.Master.LeaderLease = defaultMasterConfig.LeaderLease
+	}
 }
 
-// LoadConfig loads configuration from toml file.
+// LoadConfig loads configuration from toml file. Tenants are declared in sections [tenants.<name>.<section>].
 func LoadConfig(path string) (*Config, *toml.MetaData, error) {
 	var conf Config
 	metaData, err := toml.DecodeFile(path, &conf)
@@ -395,5 +475,34 @@ func LoadConfig(path string) (*Config, *toml.MetaData, error) {
 		return nil, nil, err
 	}
 	conf.FillDefault(metaData)
+	// settings of tenants are decoded over settings at the top level
+	var tenants struct {
+		Tenants map[string]toml.Primitive `toml:"tenants"`
+	}
+	tenantMetaData, err := toml.DecodeFile(path, &tenants)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tenants.Tenants) > 0 {
+		conf.Tenants = make(map[string]*TenantConfig)
+	}
+	for name, primitive := range tenants.Tenants {
+		if !tenantNamePattern.MatchString(name) {
+			return nil, nil, errors.Errorf("invalid tenant name: %s", name)
+		}
+		tenant := &TenantConfig{
+			Similar: conf.Similar,
+			Latest:  conf.Latest,
+			Popular: conf.Popular,
+			CF:      conf.CF,
+			Rank:    conf.Rank,
+		}
+		if err = tenantMetaData.PrimitiveDecode(primitive, tenant); err != nil {
+			return nil, nil, err
+		}
+		tenant.CF.tenant = name
+		tenant.Rank.tenant = name
+		conf.Tenants[name] = tenant
+	}
 	return &conf, &metaData, nil
 }
@@ -16,6 +16,10 @@ package config
 import (
 	"github.com/BurntSushi/toml"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -28,6 +32,7 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, "mysql://root@tcp(localhost:3306)/gitrec?parseTime=true", config.Database.DataStore)
 	assert.Equal(t, true, config.Database.AutoInsertUser)
 	assert.Equal(t, false, config.Database.AutoInsertItem)
+	assert.Equal(t, false, config.Database.CountFeedback)
 
 	// similar configuration
 	assert.Equal(t, 500, config.Similar.NumSimilar)
@@ -83,8 +88,14 @@ func TestLoadConfig(t *testing.T) {
 	// master configuration
 	assert.Equal(t, 8086, config.Master.Port)
 	assert.Equal(t, "127.0.0.1", config.Master.Host)
+	assert.Equal(t, "", config.Master.AdvertiseAddress)
+	assert.Empty(t, config.Master.MasterAddresses)
 	assert.Equal(t, 4, config.Master.Jobs)
 	assert.Equal(t, 30, config.Master.ClusterMetaTimeout)
+	assert.Equal(t, "models", config.Master.ModelDir)
+	assert.Equal(t, 5, config.Master.NumModelVersions)
+	assert.Equal(t, 0.1, config.Master.ModelTolerance)
+	assert.Equal(t, 10, config.Master.LeaderLease)
 }
 
 func TestConfig_FillDefault(t *testing.T) {
@@ -94,3 +105,49 @@ func TestConfig_FillDefault(t *testing.T) {
 	config.FillDefault(meta)
 	assert.Equal(t, *(*Config)(nil).LoadDefaultIfNil(), config)
 }
+
+func TestLoadConfig_Tenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(path, []byte(`
+[popular]
+n_popular = 500
+[cf]
+lr = 0.05
+[tenants.shop.popular]
+n_popular = 100
+[tenants.shop.cf]
+reg = 0.01
+[tenants.news.latest]
+n_latest = 10
+`), 0644)
+	assert.Nil(t, err)
+	config, meta, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(config.Tenants))
+	// settings of a tenant override settings at the top level
+	shop, exist := config.Tenant("shop")
+	assert.True(t, exist)
+	assert.Equal(t, 100, shop.Popular.NumPopular)
+	assert.Equal(t, 365, shop.Popular.TimeWindow)
+	assert.Equal(t, model.Params{model.Lr: 0.05, model.Reg: 0.01}, shop.CF.GetParams(meta))
+	assert.Equal(t, model.Params{model.Lr: 0.05}, config.CF.GetParams(meta))
+	// settings missing in a tenant are inherited
+	news, exist := config.Tenant("news")
+	assert.True(t, exist)
+	assert.Equal(t, 10, news.Latest.NumLatest)
+	assert.Equal(t, 500, news.Popular.NumPopular)
+	// the default tenant
+	defaultTenant, exist := config.Tenant("")
+	assert.True(t, exist)
+	assert.Equal(t, config, defaultTenant)
+	_, exist = config.Tenant("none")
+	assert.False(t, exist)
+	// invalid tenant name
+	err = ioutil.WriteFile(path, []byte(`[tenants."a-b".cf]`), 0644)
+	assert.Nil(t, err)
+	_, _, err = LoadConfig(path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package master
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhenghaoz/gorse/protocol"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// followerMethods are rpc methods served by followers themselves.
+var followerMethods = map[string]bool{
+	"/protocol.Master/GetConfig": true,
+}
+
+// forwardedMethods are read-only rpc methods forwarded to the leader by followers, with constructors of replies.
+// GetCluster isn't forwarded since the leader would take the follower as the caller, so workers fail over to the leader.
+var forwardedMethods = map[string]func() interface{}{
+	"/protocol.Master/GetMatchModelVersion": func() interface{} { return new(protocol.Model) },
+	"/protocol.Master/GetMatchModel":        func() interface{} { return new(protocol.Model) },
+	"/protocol.Master/GetRankModelVersion":  func() interface{} { return new(protocol.Model) },
+	"/protocol.Master/GetRankModel":         func() interface{} { return new(protocol.Model) },
+	"/protocol.Master/ListModels":           func() interface{} { return new(protocol.ModelVersions) },
+}
+
+// address returns the address of the master, which identifies the master in the leader election. The advertise
+// address is preferred, and the hostname is used if the master binds to an unspecified host, since the host is shared
+// by masters with the same configuration.
+func (m *Master) address() string {
+	if m.cfg.Master.AdvertiseAddress != "" {
+		return m.cfg.Master.AdvertiseAddress
+	}
+	host := m.cfg.Master.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("master: failed to get hostname, advertise address is required (%v)", err)
+		}
+		host = hostname
+	}
+	return net.JoinHostPort(host, strconv.Itoa(m.cfg.Master.Port))
+}
+
+// lead campaigns for the leader until the master is shut down. Models are reloaded and loops are started once the master
+// becomes the leader.
+// The leader exits once it loses the leader lock since loops can't be stopped safely, and the leader lock is released
+// once the leader is shut down.
+func (m *Master) lead() {
+	lease := time.Duration(m.cfg.Master.LeaderLease) * time.Second
+	// renewTime is the last time the leader lock is renewed, which is zero if the master isn't the leader.
+	var renewTime time.Time
+	for {
+		isLeader, err := m.campaign(m.ctx, lease)
+		if m.ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			log.Errorf("master: failed to campaign for leader (%v)", err)
+			if !renewTime.IsZero() && time.Since(renewTime) > lease {
+				log.Fatal("master: lost leader lock")
+			}
+		} else if isLeader {
+			if renewTime.IsZero() {
+				log.Infof("master: become leader (%v)", m.address())
+				m.startLoops()
+			}
+			renewTime = time.Now()
+		} else if !renewTime.IsZero() {
+			log.Fatal("master: lost leader lock")
+		}
+		select {
+		case <-m.ctx.Done():
+		case <-time.After(lease / 3):
+		}
+	}
+	if !renewTime.IsZero() {
+		if err := m.cacheStore.Unlock(context.Background(), cache.LeaderLock, m.address()); err != nil {
+			log.Errorf("master: failed to release leader lock (%v)", err)
+		}
+	}
+}
+
+// campaign acquires or renews the leader lock, and updates the leader known by the master. It returns true if the
+// master is the leader.
+func (m *Master) campaign(ctx context.Context, lease time.Duration) (bool, error) {
+	acquired, err := m.cacheStore.Lock(ctx, cache.LeaderLock, m.address(), lease)
+	if err != nil {
+		return false, err
+	}
+	leader := m.address()
+	if !acquired {
+		if leader, err = m.cacheStore.GetLock(ctx, cache.LeaderLock); err != nil {
+			return false, err
+		}
+	}
+	m.setLeader(leader)
+	return acquired, nil
+}
+
+// setLeader updates the leader known by the master. Followers connect to the leader to forward rpc calls.
+func (m *Master) setLeader(leader string) {
+	m.leaderMutex.Lock()
+	defer m.leaderMutex.Unlock()
+	if leader == m.leader {
+		return
+	}
+	log.Infof("master: leader changed (%q -> %q)", m.leader, leader)
+	if m.leaderConn != nil {
+		if err := m.leaderConn.Close(); err != nil {
+			log.Errorf("master: failed to close connection to leader (%v)", err)
+		}
+		m.leaderConn = nil
+	}
+	m.leader = leader
+	if leader != "" && leader != m.address() {
+		conn, err := grpc.Dial(leader, grpc.WithInsecure())
+		if err != nil {
+			log.Errorf("master: failed to connect leader (%v)", err)
+			return
+		}
+		m.leaderConn = conn
+	}
+}
+
+// startLoops reloads models and starts loops of the master and its tenants. Models persisted by the previous leader
+// are reloaded from the shared model directory, since models loaded by a follower might be stale.
+func (m *Master) startLoops() {
+	m.loadModels(m.ctx)
+	go m.Loop()
+	for _, tenant := range m.tenants {
+		tenant.loadModels(tenant.ctx)
+		go tenant.Loop()
+	}
+}
+
+// intercept serves rpc calls by the leader. Followers serve configurations, forward read-only calls to the leader and
+// reject other calls as unavailable, so that clients fail over to the leader.
+func (m *Master) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if followerMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	m.leaderMutex.RLock()
+	leader, conn := m.leader, m.leaderConn
+	m.leaderMutex.RUnlock()
+	if leader == m.address() {
+		return handler(ctx, req)
+	}
+	newReply, forwarded := forwardedMethods[info.FullMethod]
+	if !forwarded || conn == nil {
+		return nil, status.Errorf(codes.Unavailable, "master isn't the leader (leader = %q)", leader)
+	}
+	reply := newReply()
+	ctx = protocol.WithTenant(ctx, protocol.TenantFromContext(ctx))
+	if err := conn.Invoke(ctx, info.FullMethod, req, reply, grpc.MaxCallRecvMsgSize(10e9)); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
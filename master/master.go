@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -34,7 +35,9 @@ import (
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -61,16 +64,47 @@ type Master struct {
 	// match model
 	cfModel           cf.MatrixFactorization
 	matchModelVersion int
+	matchModels       modelRegistry
 	matchModelMutex   sync.Mutex
+	matchModelFiles   registryFiles
 
 	// rank model
 	rankModel        rank.FactorizationMachine
 	rankModelVersion int
+	rankModels       modelRegistry
 	rankModelMutex   sync.Mutex
+	rankModelFiles   registryFiles
+
+	// datasets and items pulled incrementally
+	cfDataSet   *cf.DataSet
+	rankDataSet *rank.Dataset
+	items       []data.Item
+	// lastErasureTime is the time of the last erasure of users observed by the master.
+	lastErasureTime time.Time
+	// lastModifyTime is the time of the last modification of data observed by the master.
+	lastModifyTime string
+
+	// leader is the address of the leader, and leaderConn is the connection to the leader if the master is a follower.
+	leader      string
+	leaderConn  *grpc.ClientConn
+	leaderMutex sync.RWMutex
+
+	// tenant is the name of the tenant served by the master, which is empty for the default tenant.
+	tenant string
+	// tenants are masters of other tenants indexed by names. They share the rpc server and the cluster meta.
+	tenants map[string]*Master
+
+	// ctx is cancelled once the master is shut down.
+	ctx        context.Context
+	cancel     context.CancelFunc
+	grpcServer *grpc.Server
 }
 
 func NewMaster(cfg *config.Config, meta *toml.MetaData) *Master {
+	ctx, cancel := context.WithCancel(context.Background())
 	l := &Master{
+		ctx:               ctx,
+		cancel:            cancel,
 		nodesMap:          make(map[string]string),
 		cfg:               cfg,
 		meta:              meta,
@@ -92,24 +126,16 @@ func (m *Master) Serve() {
 		log.Error("master:", err)
 	}
 
-	// connect data database
-	var err error
-	m.dataStore, err = data.Open(m.cfg.Database.DataStore)
-	if err != nil {
-		log.Fatalf("master: failed to connect data database (%v)", err)
-	}
-	if err = m.dataStore.Init(); err != nil {
-		log.Fatalf("master: failed to init database ")
+	// connect databases
+	m.connect()
+	m.tenants = make(map[string]*Master)
+	for name := range m.cfg.Tenants {
+		m.tenants[name] = m.newTenant(name)
+		m.tenants[name].connect()
 	}
 
-	// connect cache database
-	m.cacheStore, err = cache.Open(m.cfg.Database.CacheStore)
-	if err != nil {
-		log.Fatalf("master: failed to connect cache database (%v)", err)
-	}
-
-	// start loop
-	go m.Loop()
+	// elect leader, which starts loops
+	go m.lead()
 
 	// start rpc server
 	log.Infof("master: start rpc server %v:%v", m.cfg.Master.Host, m.cfg.Master.Port)
@@ -117,14 +143,64 @@ func (m *Master) Serve() {
 	if err != nil {
 		log.Fatalf("master: failed to listen: %v", err)
 	}
-	var opts []grpc.ServerOption
-	grpcServer := grpc.NewServer(opts...)
-	protocol.RegisterMasterServer(grpcServer, m)
-	if err = grpcServer.Serve(lis); err != nil {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(m.intercept)}
+	m.grpcServer = grpc.NewServer(opts...)
+	protocol.RegisterMasterServer(m.grpcServer, m)
+	if err = m.grpcServer.Serve(lis); err != nil {
 		log.Fatalf("master: failed to start rpc server (%v)", err)
 	}
 }
 
+// newTenant creates the master of a tenant, which is shut down with the master.
+func (m *Master) newTenant(name string) *Master {
+	cfg, _ := m.cfg.Tenant(name)
+	tenant := NewMaster(cfg, m.meta)
+	tenant.ctx, tenant.cancel = context.WithCancel(m.ctx)
+	tenant.tenant = name
+	return tenant
+}
+
+// connect connects to databases in the namespace of the tenant. Pending migrations are applied to the data store.
+// Persisted models are reloaded once the master becomes the leader.
+func (m *Master) connect() {
+	var err error
+	m.dataStore, err = data.OpenWithReplica(m.cfg.Database.DataStore, m.cfg.Database.DataStoreReplica, m.tenant)
+	if err != nil {
+		log.Fatalf("master: failed to connect data database (%v)", err)
+	}
+	migrations, err := m.dataStore.Migrate(m.ctx, false)
+	if err != nil {
+		log.Fatalf("master: failed to migrate database (%v)", err)
+	}
+	for _, migration := range migrations {
+		log.Infof("master: applied migration %d (%s) to tenant %q", migration.Version, migration.Description, m.tenant)
+	}
+	m.cacheStore, err = cache.Open(m.cfg.Database.CacheStore, m.tenant)
+	if err != nil {
+		log.Fatalf("master: failed to connect cache database (%v)", err)
+	}
+}
+
+// tenantOf returns the master of the tenant on behalf of which an rpc call is made.
+func (m *Master) tenantOf(ctx context.Context) (*Master, error) {
+	name := protocol.TenantFromContext(ctx)
+	if name == "" {
+		return m, nil
+	}
+	if tenant, exist := m.tenants[name]; exist {
+		return tenant, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "tenant not exist (%v)", name)
+}
+
+// Shutdown stops the rpc server and cancels in-flight queries of the loop.
+func (m *Master) Shutdown() {
+	m.cancel()
+	if m.grpcServer != nil {
+		m.grpcServer.GracefulStop()
+	}
+}
+
 func (m *Master) GetConfig(context.Context, *protocol.Void) (*protocol.Config, error) {
 	s, err := json.Marshal(m.cfg)
 	if err != nil {
@@ -162,7 +238,7 @@ func (m *Master) GetCluster(ctx context.Context, _ *protocol.Void) (*protocol.Cl
 	p, _ := peer.FromContext(ctx)
 	cluster.Me = p.Addr.String()
 	// add master
-	cluster.Master = fmt.Sprintf("%s:%d", m.cfg.Master.Host, m.cfg.Master.Port)
+	cluster.Master = m.address()
 	// add servers/workers
 	m.nodesMutex.Lock()
 	defer m.nodesMutex.Unlock()
@@ -179,62 +255,78 @@ func (m *Master) GetCluster(ctx context.Context, _ *protocol.Void) (*protocol.Cl
 	return cluster, nil
 }
 
-func (m *Master) GetMatchModelVersion(context.Context, *protocol.Void) (*protocol.Model, error) {
-	m.matchModelMutex.Lock()
-	defer m.matchModelMutex.Unlock()
+func (m *Master) GetMatchModelVersion(ctx context.Context, _ *protocol.Void) (*protocol.Model, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tenant.matchModelMutex.Lock()
+	defer tenant.matchModelMutex.Unlock()
 	// skip empty model
-	if m.cfModel == nil {
+	if tenant.cfModel == nil {
 		return &protocol.Model{Version: 0}, nil
 	}
 	return &protocol.Model{
-		Name:    m.cfg.CF.CFModel,
-		Version: int64(m.matchModelVersion),
+		Name:    tenant.cfg.CF.CFModel,
+		Version: int64(tenant.matchModelVersion),
 	}, nil
 }
 
-func (m *Master) GetMatchModel(context.Context, *protocol.Void) (*protocol.Model, error) {
-	m.matchModelMutex.Lock()
-	defer m.matchModelMutex.Unlock()
+func (m *Master) GetMatchModel(ctx context.Context, _ *protocol.Void) (*protocol.Model, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tenant.matchModelMutex.Lock()
+	defer tenant.matchModelMutex.Unlock()
 	// skip empty model
-	if m.cfModel == nil {
+	if tenant.cfModel == nil {
 		return &protocol.Model{Version: 0}, nil
 	}
 	// encode model
-	modelData, err := cf.EncodeModel(m.cfModel)
+	modelData, err := cf.EncodeModel(tenant.cfModel)
 	if err != nil {
 		return nil, err
 	}
 	return &protocol.Model{
-		Name:    m.cfg.CF.CFModel,
-		Version: int64(m.matchModelVersion),
+		Name:    tenant.cfg.CF.CFModel,
+		Version: int64(tenant.matchModelVersion),
 		Model:   modelData,
 	}, nil
 }
 
-func (m *Master) GetRankModelVersion(context.Context, *protocol.Void) (*protocol.Model, error) {
-	m.rankModelMutex.Lock()
-	defer m.rankModelMutex.Unlock()
+func (m *Master) GetRankModelVersion(ctx context.Context, _ *protocol.Void) (*protocol.Model, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tenant.rankModelMutex.Lock()
+	defer tenant.rankModelMutex.Unlock()
 	// skip empty model
-	if m.rankModel == nil {
+	if tenant.rankModel == nil {
 		return &protocol.Model{Version: 0}, nil
 	}
-	return &protocol.Model{Version: int64(m.rankModelVersion)}, nil
+	return &protocol.Model{Version: int64(tenant.rankModelVersion)}, nil
 }
 
-func (m *Master) GetRankModel(context.Context, *protocol.Void) (*protocol.Model, error) {
-	m.rankModelMutex.Lock()
-	defer m.rankModelMutex.Unlock()
+func (m *Master) GetRankModel(ctx context.Context, _ *protocol.Void) (*protocol.Model, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tenant.rankModelMutex.Lock()
+	defer tenant.rankModelMutex.Unlock()
 	// skip empty model
-	if m.rankModel == nil {
+	if tenant.rankModel == nil {
 		return &protocol.Model{Version: 0}, nil
 	}
 	// encode model
-	modelData, err := rank.EncodeModel(m.rankModel)
+	modelData, err := rank.EncodeModel(tenant.rankModel)
 	if err != nil {
 		return nil, err
 	}
 	return &protocol.Model{
-		Version: int64(m.rankModelVersion),
+		Version: int64(tenant.rankModelVersion),
 		Model:   modelData,
 	}, nil
 }
@@ -263,36 +355,53 @@ func (m *Master) Loop() {
 		m.cfg.Similar.UpdatePeriod,
 		m.cfg.Popular.UpdatePeriod,
 		m.cfg.Latest.UpdatePeriod)
-	log.Infof("master: start loop (period = %v min)", loopPeriod)
+	log.Infof("master: start loop (tenant = %q, period = %v min)", m.tenant, loopPeriod)
 
 	for {
+		// traces of erased users are removed from popular items, similar items and models
+		isErased := m.checkErasure(m.ctx)
+		m.checkModification(m.ctx)
 		// check stale
-		isPopItemStale := m.IsStale(cache.LastUpdatePopularTime, m.cfg.Popular.UpdatePeriod)
-		isLatestStale := m.IsStale(cache.LastUpdateLatestTime, m.cfg.Latest.UpdatePeriod)
-		isSimilarStale := m.IsStale(cache.LastUpdateSimilarTime, m.cfg.Similar.UpdatePeriod)
-		isRankModelStale := m.IsStale(cache.LastFitRankModelTime, m.cfg.Rank.FitPeriod)
-		isCFModelStale := m.IsStale(cache.LastFitCFModelTime, m.cfg.CF.FitPeriod)
+		isPopItemStale := isErased || m.IsStale(m.ctx, cache.LastUpdatePopularTime, m.cfg.Popular.UpdatePeriod)
+		isLatestStale := m.IsStale(m.ctx, cache.LastUpdateLatestTime, m.cfg.Latest.UpdatePeriod)
+		isSimilarStale := isErased || m.IsStale(m.ctx, cache.LastUpdateSimilarTime, m.cfg.Similar.UpdatePeriod)
+		isRankModelStale := isErased || m.IsStale(m.ctx, cache.LastFitRankModelTime, m.cfg.Rank.FitPeriod)
+		isCFModelStale := isErased || m.IsStale(m.ctx, cache.LastFitCFModelTime, m.cfg.CF.FitPeriod)
 
 		// pull dataset for rank
-		if isRankModelStale || m.rankModel == nil {
-			rankDataSet, err := rank.LoadDataFromDatabase(m.dataStore, m.cfg.Rank.FeedbackTypes)
-			if err != nil {
+		if isRankModelStale || !m.hasModel(RankModel) {
+			if m.rankDataSet == nil {
+				m.rankDataSet = rank.NewMapIndexDataset()
+			}
+			if err := m.rankDataSet.PullDataFromDatabase(m.ctx, m.dataStore, m.cfg.Rank.FeedbackTypes); err != nil {
+				if m.ctx.Err() != nil {
+					return
+				}
 				log.Fatalf("master: failed to pull dataset for ranking (%v)", err)
 			}
+			rankDataSet := m.rankDataSet
 			if rankDataSet.PositiveCount == 0 {
 				log.Info("master: empty dataset")
-			} else if err = m.FitRankModel(rankDataSet); err != nil {
+			} else if err := m.FitRankModel(m.ctx, rankDataSet, isErased); err != nil {
 				log.Fatalf("master: failed to renew ranking model (%v)", err)
 			}
 		}
 
-		if isCFModelStale || isLatestStale || isPopItemStale || isSimilarStale || m.cfModel == nil {
+		if isCFModelStale || isLatestStale || isPopItemStale || isSimilarStale || !m.hasModel(MatchModel) {
 			// download dataset
 			log.Infof("master: load data from database")
-			dataSet, items, err := cf.LoadDataFromDatabase(m.dataStore, m.cfg.CF.FeedbackTypes)
+			if m.cfDataSet == nil {
+				m.cfDataSet = cf.NewMapIndexDataset()
+			}
+			pulledItems, err := m.cfDataSet.PullDataFromDatabase(m.ctx, m.dataStore, m.cfg.CF.FeedbackTypes)
 			if err != nil {
+				if m.ctx.Err() != nil {
+					return
+				}
 				log.Fatal("master: ", err)
 			}
+			m.items = mergeItems(m.items, pulledItems)
+			dataSet, items := m.cfDataSet, m.items
 			if dataSet.Count() == 0 {
 				log.Info("master: empty dataset")
 			} else {
@@ -302,7 +411,7 @@ func (m *Master) Loop() {
 				// collect popular items
 				if isPopItemStale {
 					log.Info("master: collect popular items")
-					if err = m.CollectPopItem(items, dataSet); err != nil {
+					if err = m.CollectPopItem(m.ctx, items, dataSet); err != nil {
 						log.Errorf("master: failed to collect popular items (%v)", err)
 					}
 					log.Info("master: completed collect popular items")
@@ -311,7 +420,7 @@ func (m *Master) Loop() {
 				// collect latest items
 				if isLatestStale {
 					log.Info("master: collect latest items")
-					if err = m.CollectLatest(items); err != nil {
+					if err = m.CollectLatest(m.ctx, items); err != nil {
 						log.Errorf("master: failed to collect latest items (%v)", err)
 					}
 					log.Info("master: completed collect latest items")
@@ -320,15 +429,15 @@ func (m *Master) Loop() {
 				// collect similar items
 				if isSimilarStale {
 					log.Infof("master: collect similar items (n_jobs = %v)", m.cfg.Master.Jobs)
-					if err = m.CollectSimilar(items, dataSet); err != nil {
+					if err = m.CollectSimilar(m.ctx, items, dataSet); err != nil {
 						log.Errorf("master: failed to collect similar items (%v)", err)
 					}
 					log.Info("master: completed collect similar items")
 				}
 
-				if isCFModelStale || m.cfModel == nil {
+				if isCFModelStale || !m.hasModel(MatchModel) {
 					log.Infof("master: fit cf model (n_jobs = %v)", m.cfg.Master.Jobs)
-					if err = m.FitCFModel(dataSet); err != nil {
+					if err = m.FitCFModel(m.ctx, dataSet, isErased); err != nil {
 						log.Errorf("master: failed to fit cf model (%v)", err)
 					}
 					log.Infof("master: completed fit cf model")
@@ -337,54 +446,106 @@ func (m *Master) Loop() {
 		}
 
 		// sleep
-		time.Sleep(time.Duration(loopPeriod) * time.Minute)
+		select {
+		case <-m.ctx.Done():
+			log.Info("master: stop loop")
+			return
+		case <-time.After(time.Duration(loopPeriod) * time.Minute):
+		}
 	}
 }
 
-func (m *Master) FitRankModel(dataSet *rank.Dataset) error {
+// mergeItems merges pulled items into items pulled before. Existing items are replaced.
+func mergeItems(items []data.Item, pulledItems []data.Item) []data.Item {
+	positions := make(map[string]int, len(items))
+	for i, item := range items {
+		positions[item.ItemId] = i
+	}
+	for _, item := range pulledItems {
+		if i, exist := positions[item.ItemId]; exist {
+			items[i] = item
+		} else {
+			positions[item.ItemId] = len(items)
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// FitRankModel fits a new rank model and registers it. The new model is served regardless of the regression gate and
+// the pinned version if force is true.
+func (m *Master) FitRankModel(ctx context.Context, dataSet *rank.Dataset, force bool) error {
 	trainSet, testSet := dataSet.Split(0.2, 0)
 	testSet.NegativeSample(1, trainSet, 0)
 	nextModel := rank.NewFM(rank.FMTask(m.cfg.Rank.Task), nil)
-	nextModel.Fit(trainSet, testSet, nil)
+	score := nextModel.Fit(trainSet, testSet, nil)
+	modelData, err := rank.EncodeModel(nextModel)
+	if err != nil {
+		return err
+	}
 
-	m.rankModelMutex.Lock()
-	m.rankModel = nextModel
-	m.rankModelVersion++
-	m.rankModelMutex.Unlock()
+	// register rank model and serve it unless it regresses or another version is pinned
+	serving := m.registerRankModel(modelVersion{
+		FitTime:       time.Now(),
+		RankScore:     score,
+		Params:        nextModel.GetParams(),
+		UserCount:     dataSet.UserCount(),
+		ItemCount:     dataSet.ItemCount(),
+		FeedbackCount: dataSet.Count(),
+		Model:         modelData,
+	}, nextModel, force)
+	m.saveModels(RankModel)
 
-	if err := m.cacheStore.SetString(cache.GlobalMeta, cache.LastFitRankModelTime, base.Now()); err != nil {
+	if err = m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LastFitRankModelTime, base.Now()); err != nil {
 		return err
 	}
-	return m.cacheStore.SetString(cache.GlobalMeta, cache.LatestRankModelVersion, fmt.Sprintf("%x", m.rankModelVersion))
+	return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LatestRankModelVersion, fmt.Sprintf("%x", serving))
 }
 
-func (m *Master) FitCFModel(dataSet *cf.DataSet) error {
+// FitCFModel fits a new match model and registers it. The new model is served regardless of the regression gate and
+// the pinned version if force is true.
+func (m *Master) FitCFModel(ctx context.Context, dataSet *cf.DataSet, force bool) error {
 	// training match model
 	trainSet, testSet := dataSet.Split(m.cfg.CF.NumTestUsers, 0)
 	nextModel, err := cf.NewModel(m.cfg.CF.CFModel, m.cfg.CF.GetParams(m.meta))
 	if err != nil {
 		return err
 	}
-	nextModel.Fit(trainSet, testSet, m.cfg.CF.GetFitConfig())
-
-	// update match model
-	m.matchModelMutex.Lock()
-	m.cfModel = nextModel
-	m.matchModelVersion++
-	m.matchModelMutex.Unlock()
+	score := nextModel.Fit(trainSet, testSet, m.cfg.CF.GetFitConfig())
+	modelData, err := cf.EncodeModel(nextModel)
+	if err != nil {
+		return err
+	}
 
-	if err = m.cacheStore.SetString(cache.GlobalMeta, cache.LastFitCFModelTime, base.Now()); err != nil {
+	// register match model and serve it unless it regresses or another version is pinned
+	serving := m.registerMatchModel(modelVersion{
+		Name:          m.cfg.CF.CFModel,
+		FitTime:       time.Now(),
+		MatchScore:    score,
+		Params:        nextModel.GetParams(),
+		UserCount:     dataSet.UserCount(),
+		ItemCount:     dataSet.ItemCount(),
+		FeedbackCount: dataSet.Count(),
+		Model:         modelData,
+	}, nextModel, force)
+	m.saveModels(MatchModel)
+
+	if err = m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LastFitCFModelTime, base.Now()); err != nil {
 		return err
 	}
-	return m.cacheStore.SetString(cache.GlobalMeta, cache.LatestCFModelVersion, fmt.Sprintf("%x", m.matchModelVersion))
+	return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LatestCFModelVersion, fmt.Sprintf("%x", serving))
 }
 
-func (m *Master) IsStale(dateTimeField string, timeLimit int) bool {
-	updateTimeText, err := m.cacheStore.GetString(cache.GlobalMeta, dateTimeField)
+func (m *Master) IsStale(ctx context.Context, dateTimeField string, timeLimit int) bool {
+	updateTimeText, err := m.cacheStore.GetString(ctx, cache.GlobalMeta, dateTimeField)
 	if err != nil {
-		if err.Error() == "redis: nil" {
+		if err.Error() == cache.ErrObjectNotExist {
 			return true
 		}
+		if ctx.Err() != nil {
+			// the master is shutting down
+			return false
+		}
 		log.Fatalf("master: failed to get timestamp (%v)", err)
 	}
 	updateTime, err := dateparse.ParseAny(updateTimeText)
@@ -395,52 +556,103 @@ func (m *Master) IsStale(dateTimeField string, timeLimit int) bool {
 	return time.Since(updateTime).Minutes() > float64(timeLimit)
 }
 
-// CollectPopItem updates popular items for the database.
-func (m *Master) CollectPopItem(items []data.Item, dataset *cf.DataSet) error {
-	// create item map
-	itemMap := make(map[string]data.Item)
-	for _, item := range items {
-		itemMap[item.ItemId] = item
+// checkErasure returns true if users have been erased since the last check. Datasets pulled incrementally are
+// discarded and registries of models are purged, so that erased users are excluded once models are fitted again.
+func (m *Master) checkErasure(ctx context.Context) bool {
+	value, err := m.cacheStore.GetString(ctx, cache.GlobalMeta, cache.LastErasureTime)
+	if err != nil {
+		if err.Error() != cache.ErrObjectNotExist && ctx.Err() == nil {
+			log.Errorf("master: failed to get erasure time (%v)", err)
+		}
+		return false
 	}
+	erasureTime, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		log.Errorf("master: failed to parse erasure time (%v)", err)
+		return false
+	}
+	if !erasureTime.After(m.lastErasureTime) {
+		return false
+	}
+	log.Infof("master: found erasure of users (time = %v)", value)
+	m.lastErasureTime = erasureTime
+	m.cfDataSet, m.rankDataSet, m.items = nil, nil, nil
+	m.purgeModels(erasureTime)
+	return true
+}
+
+// checkModification discards datasets pulled incrementally if data have been modified in ways incremental pulls miss
+// since the last check, so that datasets are pulled entirely.
+func (m *Master) checkModification(ctx context.Context) {
+	modifyTime, err := m.cacheStore.GetString(ctx, cache.GlobalMeta, cache.LastModifyTime)
+	if err != nil {
+		if err.Error() != cache.ErrObjectNotExist && ctx.Err() == nil {
+			log.Errorf("master: failed to get modify time (%v)", err)
+		}
+		return
+	}
+	if modifyTime == m.lastModifyTime {
+		return
+	}
+	log.Infof("master: found modification of data (time = %v)", modifyTime)
+	m.lastModifyTime = modifyTime
+	m.cfDataSet, m.rankDataSet, m.items = nil, nil, nil
+}
+
+// CollectPopItem updates popular items for the database. Only feedback in the time window is counted, and repeated
+// feedback are counted by their counts. Hidden or expired items are excluded.
+func (m *Master) CollectPopItem(ctx context.Context, items []data.Item, dataset *cf.DataSet) error {
+	unavailable := unavailableItems(items, dataset)
 	// collect pop items
+	windowBegin := time.Now().AddDate(0, 0, -m.cfg.Popular.TimeWindow)
 	count := make([]int, dataset.ItemCount())
-	for _, userIndex := range dataset.FeedbackItems {
-		count[userIndex]++
+	for i, itemIndex := range dataset.FeedbackItems {
+		if m.cfg.Popular.TimeWindow > 0 && dataset.FeedbackTimestamps[i].Before(windowBegin) {
+			continue
+		}
+		count[itemIndex] += dataset.FeedbackCounts[i]
 	}
 	popItems := base.NewTopKStringFilter(m.cfg.Popular.NumPopular)
 	for itemIndex := range count {
+		if unavailable.Contain(itemIndex) {
+			continue
+		}
 		itemId := dataset.ItemIndex.ToName(itemIndex)
 		popItems.Push(itemId, float32(count[itemIndex]))
 	}
-	result, _ := popItems.PopAll()
+	result, scores := popItems.PopAll()
 	// write back
-	if err := m.cacheStore.SetList(cache.PopularItems, "", result); err != nil {
+	if err := m.cacheStore.SetScores(ctx, cache.PopularItems, "", cache.CreateScoredItems(result, scores)); err != nil {
 		return err
 	}
-	return m.cacheStore.SetString(cache.GlobalMeta, cache.LastUpdatePopularTime, base.Now())
+	return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LastUpdatePopularTime, base.Now())
 }
 
-// CollectLatest updates latest items.
-func (m *Master) CollectLatest(items []data.Item) error {
+// CollectLatest updates latest items. Hidden or expired items are excluded.
+func (m *Master) CollectLatest(ctx context.Context, items []data.Item) error {
 	// find latest items
-	latestItems := base.NewTopKStringFilter(m.cfg.Latest.NumLatest)
+	now := time.Now()
+	latestItems := make([]cache.ScoredItem, 0, len(items))
 	for _, item := range items {
-		latestItems.Push(item.ItemId, float32(item.Timestamp.Unix()))
+		if item.IsAvailable(now) {
+			latestItems = append(latestItems, cache.ScoredItem{ItemId: item.ItemId, Score: float64(item.Timestamp.Unix())})
+		}
+	}
+	sort.SliceStable(latestItems, func(i, j int) bool {
+		return latestItems[i].Score > latestItems[j].Score
+	})
+	if len(latestItems) > m.cfg.Latest.NumLatest {
+		latestItems = latestItems[:m.cfg.Latest.NumLatest]
 	}
-	result, _ := latestItems.PopAll()
-	if err := m.cacheStore.SetList(cache.LatestItems, "", result); err != nil {
+	if err := m.cacheStore.SetScores(ctx, cache.LatestItems, "", latestItems); err != nil {
 		return err
 	}
-	return m.cacheStore.SetString(cache.GlobalMeta, cache.LastUpdateLatestTime, base.Now())
+	return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LastUpdateLatestTime, base.Now())
 }
 
-// CollectSimilar updates neighbors for the database.
-func (m *Master) CollectSimilar(items []data.Item, dataset *cf.DataSet) error {
-	// create item map
-	itemMap := make(map[string]data.Item)
-	for _, item := range items {
-		itemMap[item.ItemId] = item
-	}
+// CollectSimilar updates neighbors for the database. Hidden or expired items are excluded from neighbors.
+func (m *Master) CollectSimilar(ctx context.Context, items []data.Item, dataset *cf.DataSet) error {
+	unavailable := unavailableItems(items, dataset)
 	// create progress tracker
 	completed := make(chan []interface{}, 1000)
 	go func() {
@@ -468,16 +680,16 @@ func (m *Master) CollectSimilar(items []data.Item, dataset *cf.DataSet) error {
 		// Ranking
 		nearItems := base.NewTopKFilter(m.cfg.Similar.NumSimilar)
 		for j := range itemSet {
-			if j != jobId {
+			if j != jobId && !unavailable.Contain(j) {
 				nearItems.Push(j, Dot(dataset.ItemFeedback[jobId], dataset.ItemFeedback[j]))
 			}
 		}
-		elem, _ := nearItems.PopAll()
-		recommends := make([]string, len(elem))
+		elem, scores := nearItems.PopAll()
+		recommends := make([]cache.ScoredItem, len(elem))
 		for i := range recommends {
-			recommends[i] = dataset.ItemIndex.ToName(elem[i])
+			recommends[i] = cache.ScoredItem{ItemId: dataset.ItemIndex.ToName(elem[i]), Score: float64(scores[i])}
 		}
-		if err := m.cacheStore.SetList(cache.SimilarItems, dataset.ItemIndex.ToName(jobId), recommends); err != nil {
+		if err := m.cacheStore.SetScores(ctx, cache.SimilarItems, dataset.ItemIndex.ToName(jobId), recommends); err != nil {
 			return err
 		}
 		completed <- nil
@@ -486,7 +698,19 @@ func (m *Master) CollectSimilar(items []data.Item, dataset *cf.DataSet) error {
 		return err
 	}
 	close(completed)
-	return m.cacheStore.SetString(cache.GlobalMeta, cache.LastUpdateSimilarTime, base.Now())
+	return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LastUpdateSimilarTime, base.Now())
+}
+
+// unavailableItems returns indices of items that are hidden or expired in the dataset.
+func unavailableItems(items []data.Item, dataset *cf.DataSet) base.Set {
+	now := time.Now()
+	unavailable := base.NewSet()
+	for _, item := range items {
+		if itemIndex := dataset.ItemIndex.ToNumber(item.ItemId); itemIndex != base.NotId && !item.IsAvailable(now) {
+			unavailable.Add(itemIndex)
+		}
+	}
+	return unavailable
 }
 
 func Dot(a, b []int) float32 {
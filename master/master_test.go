@@ -12,3 +12,596 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 package master
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/cf"
+	"github.com/zhenghaoz/gorse/model/rank"
+	"github.com/zhenghaoz/gorse/protocol"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type mockMaster struct {
+	Master
+}
+
+func newMockMaster(t *testing.T) *mockMaster {
+	s := new(mockMaster)
+	var err error
+	s.dataStore, err = data.Open("memory://", "")
+	assert.Nil(t, err)
+	s.cacheStore, err = cache.Open("memory://", "")
+	assert.Nil(t, err)
+	s.cfg = (*config.Config)(nil).LoadDefaultIfNil()
+	return s
+}
+
+func (m *mockMaster) Close(t *testing.T) {
+	err := m.dataStore.Close()
+	assert.Nil(t, err)
+	err = m.cacheStore.Close()
+	assert.Nil(t, err)
+}
+
+func TestMaster_CollectPopItem(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.cfg.Popular.TimeWindow = 30
+	dataset := cf.NewMapIndexDataset()
+	now := time.Now()
+	expireTime := now.Add(-time.Hour)
+	items := []data.Item{{ItemId: "0"}, {ItemId: "1"}, {ItemId: "2"}, {ItemId: "3", Hidden: true}, {ItemId: "4", ExpireTime: &expireTime}}
+	for _, item := range items {
+		dataset.AddItem(item.ItemId)
+	}
+	for _, userId := range []string{"a", "b", "c"} {
+		dataset.AddUser(userId)
+	}
+	// item 0: 1 recent feedback repeated 4 times
+	// item 1: 2 recent feedback
+	// item 2: 3 outdated feedback
+	// item 3: 3 recent feedback but hidden
+	// item 4: 3 recent feedback but expired
+	for _, feedback := range []struct {
+		userId    string
+		itemId    string
+		timestamp time.Time
+		count     int
+	}{
+		{"a", "0", now, 4},
+		{"a", "1", now, 1},
+		{"b", "1", now, 1},
+		{"a", "2", now.AddDate(0, 0, -60), 1},
+		{"b", "2", now.AddDate(0, 0, -60), 1},
+		{"c", "2", now.AddDate(0, 0, -60), 1},
+		{"a", "3", now, 1},
+		{"b", "3", now, 1},
+		{"c", "3", now, 1},
+		{"a", "4", now, 1},
+		{"b", "4", now, 1},
+		{"c", "4", now, 1},
+	} {
+		dataset.AddFeedback(feedback.userId, feedback.itemId, false)
+		dataset.FeedbackTimestamps = append(dataset.FeedbackTimestamps, feedback.timestamp)
+		dataset.FeedbackCounts = append(dataset.FeedbackCounts, feedback.count)
+	}
+	err := m.CollectPopItem(context.Background(), items, dataset)
+	assert.Nil(t, err)
+	popItems, err := m.cacheStore.GetScores(context.Background(), cache.PopularItems, "", 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "0", Score: 4}, {ItemId: "1", Score: 2}}, popItems)
+	// disable time window
+	m.cfg.Popular.TimeWindow = 0
+	err = m.CollectPopItem(context.Background(), items, dataset)
+	assert.Nil(t, err)
+	popItems, err = m.cacheStore.GetScores(context.Background(), cache.PopularItems, "", 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "0", Score: 4}, {ItemId: "2", Score: 3}}, popItems)
+}
+
+func TestMaster_CollectLatest(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.cfg.Latest.NumLatest = 3
+	expireTime := time.Now().Add(-time.Hour)
+	items := []data.Item{
+		{ItemId: "0", Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ItemId: "1", Timestamp: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ItemId: "2", Timestamp: time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC), Hidden: true},
+		{ItemId: "3", Timestamp: time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC), ExpireTime: &expireTime},
+	}
+	err := m.CollectLatest(context.Background(), items)
+	assert.Nil(t, err)
+	latestItems, err := m.cacheStore.GetScores(context.Background(), cache.LatestItems, "", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{ItemId: "1", Score: float64(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Unix())},
+		{ItemId: "0", Score: float64(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Unix())},
+	}, latestItems)
+}
+
+func TestMaster_CollectSimilar(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.cfg.CF.FitJobs = 1
+	m.cfg.Similar.NumSimilar = 3
+	dataset := cf.NewMapIndexDataset()
+	items := []data.Item{{ItemId: "0"}, {ItemId: "1"}, {ItemId: "2", Hidden: true}}
+	for _, item := range items {
+		dataset.AddItem(item.ItemId)
+	}
+	// all items are liked by the same user
+	dataset.AddUser("a")
+	for _, item := range items {
+		dataset.AddFeedback("a", item.ItemId, false)
+	}
+	err := m.CollectSimilar(context.Background(), items, dataset)
+	assert.Nil(t, err)
+	similarItems, err := m.cacheStore.GetScores(context.Background(), cache.SimilarItems, "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "1", Score: 1}}, similarItems)
+	similarItems, err = m.cacheStore.GetScores(context.Background(), cache.SimilarItems, "2", 0, 0)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []cache.ScoredItem{{ItemId: "0", Score: 1}, {ItemId: "1", Score: 1}}, similarItems)
+}
+
+func TestMergeItems(t *testing.T) {
+	items := []data.Item{{ItemId: "0"}, {ItemId: "1"}}
+	items = mergeItems(items, []data.Item{{ItemId: "1", Hidden: true}, {ItemId: "2"}})
+	assert.Equal(t, []data.Item{{ItemId: "0"}, {ItemId: "1", Hidden: true}, {ItemId: "2"}}, items)
+}
+
+func TestMaster_CheckErasure(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.cfDataSet = cf.NewMapIndexDataset()
+	// no erasure
+	assert.False(t, m.checkErasure(context.Background()))
+	assert.NotNil(t, m.cfDataSet)
+	// new erasure
+	err := m.cacheStore.SetString(context.Background(), cache.GlobalMeta, cache.LastErasureTime, "2021-01-01T00:00:00Z")
+	assert.Nil(t, err)
+	assert.True(t, m.checkErasure(context.Background()))
+	assert.Nil(t, m.cfDataSet)
+	assert.Nil(t, m.rankDataSet)
+	// erasure observed before
+	m.cfDataSet = cf.NewMapIndexDataset()
+	assert.False(t, m.checkErasure(context.Background()))
+	assert.NotNil(t, m.cfDataSet)
+	// another erasure in the same second
+	err = m.cacheStore.SetString(context.Background(), cache.GlobalMeta, cache.LastErasureTime, "2021-01-01T00:00:00.5Z")
+	assert.Nil(t, err)
+	assert.True(t, m.checkErasure(context.Background()))
+	assert.Nil(t, m.cfDataSet)
+}
+
+func TestMaster_CheckModification(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.cfDataSet, m.items = cf.NewMapIndexDataset(), []data.Item{{ItemId: "0"}}
+	// no modification
+	m.checkModification(context.Background())
+	assert.NotNil(t, m.cfDataSet)
+	// new modification
+	err := m.cacheStore.SetString(context.Background(), cache.GlobalMeta, cache.LastModifyTime, "2021-01-01T00:00:00Z")
+	assert.Nil(t, err)
+	m.checkModification(context.Background())
+	assert.Nil(t, m.cfDataSet)
+	assert.Nil(t, m.rankDataSet)
+	assert.Nil(t, m.items)
+	// modification observed before
+	m.cfDataSet = cf.NewMapIndexDataset()
+	m.checkModification(context.Background())
+	assert.NotNil(t, m.cfDataSet)
+}
+
+func TestMaster_Tenant(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	defer m.cancel()
+	m.cfg.Tenants = map[string]*config.TenantConfig{"shop": {Rank: m.cfg.Rank}}
+	tenant := m.newTenant("shop")
+	tenant.rankModel = rank.NewFM(rank.FMTask(tenant.cfg.Rank.Task), nil)
+	tenant.rankModelVersion = 2
+	m.tenants = map[string]*Master{"shop": tenant}
+	// the default tenant
+	model, err := m.GetRankModelVersion(context.Background(), &protocol.Void{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), model.Version)
+	// a tenant
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "shop"))
+	model, err = m.GetRankModelVersion(ctx, &protocol.Void{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), model.Version)
+	// a tenant not existed
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "none"))
+	_, err = m.GetRankModelVersion(ctx, &protocol.Void{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// the master of a tenant is shut down with the master
+	m.cancel()
+	assert.NotNil(t, tenant.ctx.Err())
+}
+
+// registerModels registers n versions of match models and rank models from version 1 to version n.
+func registerModels(t *testing.T, m *mockMaster, n int) {
+	for i := 1; i <= n; i++ {
+		matchModel, err := cf.NewModel(m.cfg.CF.CFModel, nil)
+		assert.Nil(t, err)
+		matchData, err := cf.EncodeModel(matchModel)
+		assert.Nil(t, err)
+		m.matchModels.Serving = i
+		m.matchModels.add(modelVersion{
+			Version:    i,
+			Name:       m.cfg.CF.CFModel,
+			MatchScore: cf.Score{NDCG: float32(i) / 10},
+			Model:      matchData,
+		}, m.cfg.Master.NumModelVersions)
+		rankData, err := rank.EncodeModel(rank.NewFM(rank.FMTask(m.cfg.Rank.Task), nil))
+		assert.Nil(t, err)
+		m.rankModels.Serving = i
+		m.rankModels.add(modelVersion{Version: i, Model: rankData}, m.cfg.Master.NumModelVersions)
+	}
+}
+
+func TestModelRegistry(t *testing.T) {
+	var registry modelRegistry
+	assert.Equal(t, 8, registry.nextVersion(7))
+	registry.Serving = 1
+	for i := 1; i <= 4; i++ {
+		registry.add(modelVersion{Version: i}, 3)
+	}
+	// the serving version is kept
+	assert.Equal(t, []modelVersion{{Version: 1}, {Version: 3}, {Version: 4}}, registry.Versions)
+	assert.Equal(t, 5, registry.nextVersion(7))
+	_, exist := registry.find(2)
+	assert.False(t, exist)
+	previous, exist := registry.previous(4)
+	assert.True(t, exist)
+	assert.Equal(t, 3, previous.Version)
+	_, exist = registry.previous(1)
+	assert.False(t, exist)
+}
+
+func TestModelRegistry_Rejected(t *testing.T) {
+	registry := modelRegistry{Serving: 1}
+	registry.add(modelVersion{Version: 1}, 5)
+	registry.add(modelVersion{Version: 2}, 5)
+	registry.add(modelVersion{Version: 3, Rejected: true}, 5)
+	// rejected versions are skipped
+	latest, exist := registry.latest()
+	assert.True(t, exist)
+	assert.Equal(t, 2, latest.Version)
+	previous, exist := registry.previous(3)
+	assert.True(t, exist)
+	assert.Equal(t, 2, previous.Version)
+}
+
+func TestAcceptScore(t *testing.T) {
+	// match models
+	assert.True(t, acceptMatchScore(cf.Score{NDCG: 0.5}, cf.Score{NDCG: 0.4}, 0.1))
+	assert.True(t, acceptMatchScore(cf.Score{NDCG: 0.37}, cf.Score{NDCG: 0.4}, 0.1))
+	assert.False(t, acceptMatchScore(cf.Score{NDCG: 0.35}, cf.Score{NDCG: 0.4}, 0.1))
+	assert.False(t, acceptMatchScore(cf.Score{NDCG: 0.39}, cf.Score{NDCG: 0.4}, 0))
+	// rank models of classification
+	serving := rank.Score{Task: rank.FMClassification, Precision: 0.4}
+	assert.True(t, acceptRankScore(rank.Score{Task: rank.FMClassification, Precision: 0.37}, serving, 0.1))
+	assert.False(t, acceptRankScore(rank.Score{Task: rank.FMClassification, Precision: 0.35}, serving, 0.1))
+	// rank models of regression
+	serving = rank.Score{Task: rank.FMRegression, RMSE: 1}
+	assert.True(t, acceptRankScore(rank.Score{Task: rank.FMRegression, RMSE: 1.05}, serving, 0.1))
+	assert.False(t, acceptRankScore(rank.Score{Task: rank.FMRegression, RMSE: 1.2}, serving, 0.1))
+	// scores aren't comparable
+	assert.True(t, acceptRankScore(rank.Score{Task: rank.FMRegression, RMSE: 1.2}, rank.Score{}, 0.1))
+	assert.True(t, acceptRankScore(rank.Score{Task: rank.FMRegression, RMSE: 1.2},
+		rank.Score{Task: rank.FMClassification, Precision: 0.4}, 0.1))
+}
+
+func TestModelRegistry_Baseline(t *testing.T) {
+	var registry modelRegistry
+	_, exist := registry.baselineMatchScore()
+	assert.False(t, exist)
+	registry.add(modelVersion{Version: 1, MatchScore: cf.Score{NDCG: 0.4}, RankScore: rank.Score{Task: rank.FMRegression, RMSE: 1}}, 5)
+	registry.add(modelVersion{Version: 2, MatchScore: cf.Score{NDCG: 0.9}, RankScore: rank.Score{Task: rank.FMRegression, RMSE: 3}}, 5)
+	registry.add(modelVersion{Version: 3, MatchScore: cf.Score{NDCG: 0.2}, Rejected: true}, 5)
+	registry.Serving = 2
+	matchBaseline, exist := registry.baselineMatchScore()
+	assert.True(t, exist)
+	assert.Equal(t, cf.Score{NDCG: 0.9}, matchBaseline)
+	rankBaseline, exist := registry.baselineRankScore()
+	assert.True(t, exist)
+	assert.Equal(t, rank.Score{Task: rank.FMRegression, RMSE: 3}, rankBaseline)
+	// rejected versions are never the baseline
+	registry.Serving = 3
+	_, exist = registry.baselineMatchScore()
+	assert.False(t, exist)
+	// no baseline once the serving version is purged
+	registry.Serving = 2
+	registry.purge(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	_, exist = registry.baselineRankScore()
+	assert.False(t, exist)
+}
+
+func TestMaster_RegisterModel(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	register := func(ndcg float32, force bool) int {
+		return m.registerMatchModel(modelVersion{MatchScore: cf.Score{NDCG: ndcg}}, nil, force)
+	}
+	assert.Equal(t, 1, register(0.4, false))
+	assert.Equal(t, 2, register(0.9, false))
+	// new versions are compared against the serving version
+	assert.Equal(t, 2, register(0.4, false))
+	assert.Equal(t, 4, register(0.85, false))
+	assert.Equal(t, []bool{false, false, true, false}, []bool{m.matchModels.Versions[0].Rejected,
+		m.matchModels.Versions[1].Rejected, m.matchModels.Versions[2].Rejected, m.matchModels.Versions[3].Rejected})
+	// new versions are compared against the pinned version but not served
+	m.matchModels.Pinned, m.matchModels.Serving, m.matchModelVersion = true, 1, 1
+	assert.Equal(t, 1, register(0.4, false))
+	assert.False(t, m.matchModels.Versions[4].Rejected)
+	// forced versions are served regardless of the gate and the pinned version
+	assert.Equal(t, 6, register(0.1, true))
+	assert.False(t, m.matchModels.Pinned)
+}
+
+func TestMaster_PromoteModel(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	ctx := context.Background()
+	registerModels(t, m, 3)
+	// list models
+	versions, err := m.ListModels(ctx, &protocol.ModelQuery{Type: MatchModel})
+	assert.Nil(t, err)
+	assert.False(t, versions.Pinned)
+	assert.Equal(t, 3, len(versions.Versions))
+	assert.Equal(t, int64(3), versions.Versions[0].Version)
+	assert.True(t, versions.Versions[0].Serving)
+	assert.Equal(t, `{"NDCG":0.3,"Precision":0,"Recall":0}`, versions.Versions[0].Score)
+	_, err = m.ListModels(ctx, &protocol.ModelQuery{Type: "none"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.False(t, m.hasModel(MatchModel))
+	// promote a version
+	promoted, err := m.PromoteModel(ctx, &protocol.ModelQuery{Type: MatchModel, Version: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), promoted.Version)
+	assert.True(t, promoted.Serving)
+	assert.True(t, m.matchModels.Pinned)
+	assert.Equal(t, 1, m.matchModelVersion)
+	assert.NotNil(t, m.cfModel)
+	assert.True(t, m.hasModel(MatchModel))
+	version, err := m.cacheStore.GetString(ctx, cache.GlobalMeta, cache.LatestCFModelVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", version)
+	_, err = m.PromoteModel(ctx, &protocol.ModelQuery{Type: MatchModel, Version: 9})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// promote the latest version
+	promoted, err = m.PromoteModel(ctx, &protocol.ModelQuery{Type: RankModel})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), promoted.Version)
+	assert.False(t, m.rankModels.Pinned)
+	assert.NotNil(t, m.rankModel)
+	// match models of other types aren't served
+	m.cfg.CF.CFModel = "bpr"
+	_, err = m.PromoteModel(ctx, &protocol.ModelQuery{Type: MatchModel, Version: 2})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, 1, m.matchModelVersion)
+}
+
+func TestMaster_RollbackModel(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	ctx := context.Background()
+	registerModels(t, m, 2)
+	rollback, err := m.RollbackModel(ctx, &protocol.ModelQuery{Type: RankModel})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rollback.Version)
+	assert.Equal(t, 1, m.rankModelVersion)
+	assert.True(t, m.rankModels.Pinned)
+	version, err := m.cacheStore.GetString(ctx, cache.GlobalMeta, cache.LatestRankModelVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", version)
+	// no version before the first version
+	_, err = m.RollbackModel(ctx, &protocol.ModelQuery{Type: RankModel})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestMaster_PersistModels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	m := newMockMaster(t)
+	defer m.Close(t)
+	ctx := context.Background()
+	m.cfg.Master.ModelDir = filepath.Join(dir, "models")
+	// save models
+	registerModels(t, m, 3)
+	_, err = m.PromoteModel(ctx, &protocol.ModelQuery{Type: MatchModel, Version: 2})
+	assert.Nil(t, err)
+	_, err = m.PromoteModel(ctx, &protocol.ModelQuery{Type: RankModel})
+	assert.Nil(t, err)
+	// reload models
+	restarted := newMockMaster(t)
+	defer restarted.Close(t)
+	restarted.cfg.Master.ModelDir = m.cfg.Master.ModelDir
+	restarted.loadModels(ctx)
+	assert.NotNil(t, restarted.cfModel)
+	assert.Equal(t, 2, restarted.matchModelVersion)
+	assert.True(t, restarted.matchModels.Pinned)
+	assert.Equal(t, 3, len(restarted.matchModels.Versions))
+	assert.NotNil(t, restarted.rankModel)
+	assert.Equal(t, 3, restarted.rankModelVersion)
+	assert.False(t, restarted.rankModels.Pinned)
+	// models of other tenants aren't reloaded
+	tenant := newMockMaster(t)
+	defer tenant.Close(t)
+	tenant.cfg.Master.ModelDir = m.cfg.Master.ModelDir
+	tenant.tenant = "shop"
+	tenant.loadModels(ctx)
+	assert.Nil(t, tenant.cfModel)
+	assert.Nil(t, tenant.rankModel)
+	// match models of other types aren't served
+	changed := newMockMaster(t)
+	defer changed.Close(t)
+	changed.cfg.Master.ModelDir = m.cfg.Master.ModelDir
+	changed.cfg.CF.CFModel = "bpr"
+	changed.loadModels(ctx)
+	assert.Nil(t, changed.cfModel)
+	assert.False(t, changed.matchModels.Pinned)
+	assert.NotNil(t, changed.rankModel)
+	// versions are saved to their own files
+	for _, name := range []string{"match_model", "match_model_1", "match_model_2", "match_model_3", "rank_model_3"} {
+		_, err = os.Stat(filepath.Join(m.cfg.Master.ModelDir, name))
+		assert.Nil(t, err)
+	}
+	// files of removed versions are deleted
+	m.matchModelMutex.Lock()
+	m.matchModels.Versions = m.matchModels.Versions[1:]
+	m.matchModelMutex.Unlock()
+	m.saveModels(MatchModel)
+	_, err = os.Stat(filepath.Join(m.cfg.Master.ModelDir, "match_model_1"))
+	assert.True(t, os.IsNotExist(err))
+	reloaded := newMockMaster(t)
+	defer reloaded.Close(t)
+	reloaded.cfg.Master.ModelDir = m.cfg.Master.ModelDir
+	reloaded.loadModels(ctx)
+	assert.Equal(t, 2, len(reloaded.matchModels.Versions))
+	assert.Equal(t, 2, reloaded.matchModelVersion)
+}
+
+func TestMaster_PurgeModels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	m := newMockMaster(t)
+	defer m.Close(t)
+	ctx := context.Background()
+	m.cfg.Master.ModelDir = filepath.Join(dir, "models")
+	registerModels(t, m, 3)
+	_, err = m.PromoteModel(ctx, &protocol.ModelQuery{Type: MatchModel, Version: 2})
+	assert.Nil(t, err)
+	m.saveModels(RankModel)
+	// versions and their files are purged once users are erased
+	err = m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LastErasureTime, "2021-01-01T00:00:00Z")
+	assert.Nil(t, err)
+	assert.True(t, m.checkErasure(ctx))
+	assert.Empty(t, m.matchModels.Versions)
+	assert.False(t, m.matchModels.Pinned)
+	assert.Empty(t, m.rankModels.Versions)
+	for _, name := range []string{"match_model_1", "match_model_2", "match_model_3", "rank_model_3"} {
+		_, err = os.Stat(filepath.Join(m.cfg.Master.ModelDir, name))
+		assert.True(t, os.IsNotExist(err))
+	}
+	// the refitted model is served and numbered after the serving version
+	serving := m.registerMatchModel(modelVersion{MatchScore: cf.Score{NDCG: 0.01}}, m.cfModel, true)
+	assert.Equal(t, 3, serving)
+	// registries purged for the erasure aren't purged again after restart
+	m.saveModels(MatchModel)
+	restarted := newMockMaster(t)
+	defer restarted.Close(t)
+	restarted.cfg.Master.ModelDir = m.cfg.Master.ModelDir
+	restarted.loadModels(ctx)
+	restarted.purgeModels(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 1, len(restarted.matchModels.Versions))
+}
+
+// serveMaster starts the rpc server of a master on a random port.
+func serveMaster(t *testing.T, m *mockMaster) *grpc.Server {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	m.cfg.Master.Host = "127.0.0.1"
+	m.cfg.Master.Port = lis.Addr().(*net.TCPAddr).Port
+	server := grpc.NewServer(grpc.UnaryInterceptor(m.intercept))
+	protocol.RegisterMasterServer(server, m)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	return server
+}
+
+func TestMaster_Leader(t *testing.T) {
+	ctx := context.Background()
+	leader := newMockMaster(t)
+	defer leader.Close(t)
+	leaderServer := serveMaster(t, leader)
+	defer leaderServer.Stop()
+	follower := newMockMaster(t)
+	defer follower.Close(t)
+	followerServer := serveMaster(t, follower)
+	defer followerServer.Stop()
+	// elect leader
+	isLeader, err := leader.campaign(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, isLeader)
+	isLeader, err = follower.campaign(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, isLeader)
+	assert.Equal(t, leader.address(), follower.leader)
+	leader.rankModel = rank.NewFM(rank.FMTask(leader.cfg.Rank.Task), nil)
+	leader.rankModelVersion = 3
+	// read-only calls are forwarded to the leader
+	conn, err := grpc.Dial(follower.address(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+	followerClient := protocol.NewMasterClient(conn)
+	model, err := followerClient.GetRankModelVersion(ctx, &protocol.Void{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), model.Version)
+	// other calls are rejected by the follower
+	_, err = followerClient.RollbackModel(ctx, &protocol.ModelQuery{Type: RankModel})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	// cluster info isn't forwarded, since the leader would take the follower as the caller
+	_, err = followerClient.GetCluster(ctx, &protocol.Void{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	// clients fail over to the leader
+	failoverConn, err := protocol.DialMasters([]string{follower.address(), leader.address()}, grpc.WithInsecure())
+	assert.Nil(t, err)
+	client := protocol.NewMasterClient(failoverConn)
+	cluster, err := client.GetCluster(ctx, &protocol.Void{})
+	assert.Nil(t, err)
+	assert.Equal(t, leader.address(), cluster.Master)
+	assert.NotEqual(t, follower.address(), cluster.Me)
+	_, err = client.RollbackModel(ctx, &protocol.ModelQuery{Type: RankModel})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	// a new leader is elected once the lease expires
+	_, err = leader.campaign(ctx, 100*time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	isLeader, err = follower.campaign(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, isLeader)
+	isLeader, err = leader.campaign(ctx, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, isLeader)
+	assert.Equal(t, follower.address(), leader.leader)
+	err = follower.cacheStore.Unlock(ctx, cache.LeaderLock, follower.address())
+	assert.Nil(t, err)
+}
+
+func TestMaster_Address(t *testing.T) {
+	m := newMockMaster(t)
+	defer m.Close(t)
+	m.cfg.Master.Host, m.cfg.Master.Port = "127.0.0.1", 8086
+	assert.Equal(t, "127.0.0.1:8086", m.address())
+	// the hostname identifies masters binding to unspecified hosts
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+	m.cfg.Master.Host = "0.0.0.0"
+	assert.Equal(t, net.JoinHostPort(hostname, "8086"), m.address())
+	// the advertise address is preferred
+	m.cfg.Master.AdvertiseAddress = "10.0.0.1:8086"
+	assert.Equal(t, "10.0.0.1:8086", m.address())
+}
@@ -0,0 +1,532 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/cf"
+	"github.com/zhenghaoz/gorse/model/rank"
+	"github.com/zhenghaoz/gorse/protocol"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Types of models in the model registry.
+const (
+	MatchModel = "match"
+	RankModel  = "rank"
+)
+
+const (
+	matchModelFile = "match_model"
+	rankModelFile  = "rank_model"
+)
+
+// modelVersion is a version of a model in the model registry.
+type modelVersion struct {
+	Version int
+	// Name is the name of the model, which is required to decode collaborative filtering models.
+	Name    string
+	FitTime time.Time
+	// MatchScore is the validation score of a match model, while RankScore is the one of a rank model.
+	MatchScore cf.Score
+	RankScore  rank.Score
+	Params     model.Params
+	// UserCount, ItemCount and FeedbackCount are sizes of the dataset the model is fitted on.
+	UserCount     int
+	ItemCount     int
+	FeedbackCount int
+	// Model is the model encoded by cf.EncodeModel or rank.EncodeModel.
+	Model []byte
+	// Rejected is true if the validation score regresses beyond the tolerance from the serving version when fitted.
+	// Rejected versions are served only if they are promoted explicitly.
+	Rejected bool
+}
+
+// modelRegistry keeps the last versions of a model.
+type modelRegistry struct {
+	// Versions are sorted in ascending order.
+	Versions []modelVersion
+	// Serving is the version pulled by workers and servers, which is 0 if no version is served.
+	Serving int
+	// Pinned is true if the serving version is chosen by promotion or rollback. Versions fitted later aren't served
+	// until they are promoted.
+	Pinned bool
+	// ErasureTime is the time of the last erasure of users the registry has been purged for.
+	ErasureTime time.Time
+}
+
+// nextVersion returns the version of the next model. Versions continue from current if the registry is empty.
+func (r *modelRegistry) nextVersion(current int) int {
+	if len(r.Versions) > 0 {
+		return r.Versions[len(r.Versions)-1].Version + 1
+	}
+	return current + 1
+}
+
+// add appends a version to the registry. The oldest versions are removed if there are more than n versions, except
+// the serving version and the appended version.
+func (r *modelRegistry) add(version modelVersion, n int) {
+	r.Versions = append(r.Versions, version)
+	for i := 0; len(r.Versions) > n && i < len(r.Versions)-1; {
+		if r.Versions[i].Version == r.Serving {
+			i++
+			continue
+		}
+		r.Versions = append(r.Versions[:i:i], r.Versions[i+1:]...)
+	}
+}
+
+// purge removes all versions from the registry once users are erased, since every version might be fitted on feedback
+// of erased users. It returns false if the registry has been purged for the erasure or a later one. The serving model
+// is kept in memory until a new version is fitted.
+func (r *modelRegistry) purge(erasureTime time.Time) bool {
+	if !erasureTime.After(r.ErasureTime) {
+		return false
+	}
+	r.Versions, r.Pinned, r.ErasureTime = nil, false, erasureTime
+	return true
+}
+
+// find returns a version in the registry.
+func (r *modelRegistry) find(version int) (modelVersion, bool) {
+	for _, v := range r.Versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return modelVersion{}, false
+}
+
+// latest returns the latest version not rejected in the registry.
+func (r *modelRegistry) latest() (modelVersion, bool) {
+	if len(r.Versions) == 0 {
+		return modelVersion{}, false
+	}
+	return r.previous(r.Versions[len(r.Versions)-1].Version + 1)
+}
+
+// previous returns the latest version not rejected before a version in the registry.
+func (r *modelRegistry) previous(version int) (modelVersion, bool) {
+	for i := len(r.Versions) - 1; i >= 0; i-- {
+		if r.Versions[i].Version < version && !r.Versions[i].Rejected {
+			return r.Versions[i], true
+		}
+	}
+	return modelVersion{}, false
+}
+
+// baseline returns the serving version, either pinned or current, as the baseline of new versions. There is no baseline
+// if the serving version has been purged, and rejected versions are never the baseline.
+func (r *modelRegistry) baseline() (modelVersion, bool) {
+	version, exist := r.find(r.Serving)
+	if !exist || version.Rejected {
+		return modelVersion{}, false
+	}
+	return version, true
+}
+
+// baselineMatchScore returns the baseline of new match models, which is the score of the serving version.
+func (r *modelRegistry) baselineMatchScore() (cf.Score, bool) {
+	version, exist := r.baseline()
+	return version.MatchScore, exist
+}
+
+// baselineRankScore returns the baseline of new rank models, which is the score of the serving version.
+func (r *modelRegistry) baselineRankScore() (rank.Score, bool) {
+	version, exist := r.baseline()
+	return version.RankScore, exist
+}
+
+// acceptMatchScore returns true if the NDCG of a new match model doesn't regress beyond the tolerance from the baseline.
+func acceptMatchScore(score, baseline cf.Score, tolerance float64) bool {
+	return float64(score.NDCG) >= float64(baseline.NDCG)*(1-tolerance)
+}
+
+// acceptRankScore returns true if the score of a new rank model doesn't regress beyond the tolerance from the baseline.
+// The new model is accepted if there is no baseline or the baseline is of another task.
+func acceptRankScore(score, baseline rank.Score, tolerance float64) bool {
+	if baseline.Task == "" || score.Task != baseline.Task {
+		return true
+	}
+	threshold := baseline
+	threshold.RMSE *= float32(1 + tolerance)
+	threshold.Precision *= float32(1 - tolerance)
+	return !threshold.BetterThan(score)
+}
+
+// registry returns the model registry of a type of models with the mutex guarding it.
+func (m *Master) registry(modelType string) (*sync.Mutex, *modelRegistry, error) {
+	switch modelType {
+	case MatchModel:
+		return &m.matchModelMutex, &m.matchModels, nil
+	case RankModel:
+		return &m.rankModelMutex, &m.rankModels, nil
+	}
+	return nil, nil, status.Errorf(codes.InvalidArgument, "unknown model type (%v)", modelType)
+}
+
+// hasModel returns true if a model of a type is served. Models are replaced by rpc calls concurrently, so they are read
+// with the mutex held.
+func (m *Master) hasModel(modelType string) bool {
+	mutex, _, _ := m.registry(modelType)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if modelType == MatchModel {
+		return m.cfModel != nil
+	}
+	return m.rankModel != nil
+}
+
+// registerMatchModel numbers a new version of the match model, adds it to the registry and returns the serving
+// version. The new version is served unless it regresses beyond the tolerance from the baseline or another version is
+// pinned. A forced version is served regardless and unpins the registry, which is required once users are erased.
+func (m *Master) registerMatchModel(version modelVersion, matchModel cf.MatrixFactorization, force bool) int {
+	m.matchModelMutex.Lock()
+	defer m.matchModelMutex.Unlock()
+	version.Version = m.matchModels.nextVersion(m.matchModelVersion)
+	if force {
+		m.matchModels.Pinned = false
+	} else if baseline, exist := m.matchModels.baselineMatchScore(); exist &&
+		!acceptMatchScore(version.MatchScore, baseline, m.cfg.Master.ModelTolerance) {
+		version.Rejected = true
+		log.Warnf("master: reject match model (tenant = %q, version = %x, NDCG = %v, baseline NDCG = %v)", m.tenant,
+			version.Version, version.MatchScore.NDCG, baseline.NDCG)
+	}
+	if !version.Rejected && !m.matchModels.Pinned {
+		m.cfModel, m.matchModelVersion, m.matchModels.Serving = matchModel, version.Version, version.Version
+	}
+	m.matchModels.add(version, m.cfg.Master.NumModelVersions)
+	return m.matchModelVersion
+}
+
+// registerRankModel adds a new version of the rank model to the registry and returns the serving version like
+// registerMatchModel.
+func (m *Master) registerRankModel(version modelVersion, rankModel rank.FactorizationMachine, force bool) int {
+	m.rankModelMutex.Lock()
+	defer m.rankModelMutex.Unlock()
+	version.Version = m.rankModels.nextVersion(m.rankModelVersion)
+	if force {
+		m.rankModels.Pinned = false
+	} else if baseline, exist := m.rankModels.baselineRankScore(); exist &&
+		!acceptRankScore(version.RankScore, baseline, m.cfg.Master.ModelTolerance) {
+		version.Rejected = true
+		log.Warnf("master: reject rank model (tenant = %q, version = %x, %v = %v, baseline %v = %v)", m.tenant,
+			version.Version, version.RankScore.GetName(), version.RankScore.GetValue(), baseline.GetName(), baseline.GetValue())
+	}
+	if !version.Rejected && !m.rankModels.Pinned {
+		m.rankModel, m.rankModelVersion, m.rankModels.Serving = rankModel, version.Version, version.Version
+	}
+	m.rankModels.add(version, m.cfg.Master.NumModelVersions)
+	return m.rankModelVersion
+}
+
+// purgeModels purges registries of models for an erasure of users and deletes files of purged versions.
+func (m *Master) purgeModels(erasureTime time.Time) {
+	for _, modelType := range []string{MatchModel, RankModel} {
+		mutex, registry, _ := m.registry(modelType)
+		mutex.Lock()
+		purged := registry.purge(erasureTime)
+		mutex.Unlock()
+		if purged {
+			log.Infof("master: purged %v models (tenant = %q, erasure time = %v)", modelType, m.tenant, erasureTime)
+			m.saveModels(modelType)
+		}
+	}
+}
+
+// serve decodes a version of a model and serves it to workers and servers. The mutex of the model must be held.
+func (m *Master) serve(ctx context.Context, modelType string, version modelVersion) error {
+	switch modelType {
+	case MatchModel:
+		if version.Name != m.cfg.CF.CFModel {
+			return status.Errorf(codes.FailedPrecondition, "model %v mismatches configured model %v", version.Name, m.cfg.CF.CFModel)
+		}
+		matchModel, err := cf.DecodeModel(version.Name, version.Model)
+		if err != nil {
+			return err
+		}
+		m.cfModel, m.matchModelVersion, m.matchModels.Serving = matchModel, version.Version, version.Version
+		return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LatestCFModelVersion, fmt.Sprintf("%x", version.Version))
+	case RankModel:
+		rankModel, err := rank.DecodeModel(version.Model)
+		if err != nil {
+			return err
+		}
+		m.rankModel, m.rankModelVersion, m.rankModels.Serving = rankModel, version.Version, version.Version
+		return m.cacheStore.SetString(ctx, cache.GlobalMeta, cache.LatestRankModelVersion, fmt.Sprintf("%x", version.Version))
+	}
+	return status.Errorf(codes.InvalidArgument, "unknown model type (%v)", modelType)
+}
+
+// promote serves a version of a model and pins it. The latest version not rejected is served and versions fitted later
+// are served again if the version is 0.
+func (m *Master) promote(ctx context.Context, modelType string, version int) (*protocol.ModelVersion, error) {
+	mutex, registry, err := m.registry(modelType)
+	if err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	var target modelVersion
+	if version == 0 {
+		var exist bool
+		if target, exist = registry.latest(); !exist {
+			mutex.Unlock()
+			return nil, status.Errorf(codes.NotFound, "no %v model", modelType)
+		}
+	} else if target, err = m.findVersion(registry, modelType, version); err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	if err = m.serve(ctx, modelType, target); err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	registry.Pinned = version != 0
+	log.Infof("master: promote %v model (tenant = %q, version = %x, pinned = %v)", modelType, m.tenant, target.Version, registry.Pinned)
+	info := m.versionInfo(modelType, registry, target)
+	mutex.Unlock()
+	m.saveModels(modelType)
+	return info, nil
+}
+
+// rollback serves and pins the version not rejected before the serving version of a model.
+func (m *Master) rollback(ctx context.Context, modelType string) (*protocol.ModelVersion, error) {
+	mutex, registry, err := m.registry(modelType)
+	if err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	serving := registry.Serving
+	target, exist := registry.previous(serving)
+	mutex.Unlock()
+	if !exist {
+		return nil, status.Errorf(codes.FailedPrecondition, "no %v model before version %x", modelType, serving)
+	}
+	return m.promote(ctx, modelType, target.Version)
+}
+
+// findVersion finds a version of a model in the registry.
+func (m *Master) findVersion(registry *modelRegistry, modelType string, version int) (modelVersion, error) {
+	target, exist := registry.find(version)
+	if !exist {
+		return modelVersion{}, status.Errorf(codes.NotFound, "%v model not exist (version = %x)", modelType, version)
+	}
+	return target, nil
+}
+
+// versionInfo converts a version of a model to the message of the rpc.
+func (m *Master) versionInfo(modelType string, registry *modelRegistry, version modelVersion) *protocol.ModelVersion {
+	var score interface{} = version.MatchScore
+	if modelType == RankModel {
+		score = version.RankScore
+	}
+	scoreJson, _ := json.Marshal(score)
+	paramsJson, _ := json.Marshal(version.Params)
+	return &protocol.ModelVersion{
+		Version:       int64(version.Version),
+		Name:          version.Name,
+		FitTime:       version.FitTime.Format(time.RFC3339),
+		Score:         string(scoreJson),
+		Params:        string(paramsJson),
+		UserCount:     int64(version.UserCount),
+		ItemCount:     int64(version.ItemCount),
+		FeedbackCount: int64(version.FeedbackCount),
+		Serving:       version.Version == registry.Serving,
+		Rejected:      version.Rejected,
+	}
+}
+
+// ListModels returns versions of a model in the registry from the latest to the oldest.
+func (m *Master) ListModels(ctx context.Context, query *protocol.ModelQuery) (*protocol.ModelVersions, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mutex, registry, err := tenant.registry(query.Type)
+	if err != nil {
+		return nil, err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	versions := &protocol.ModelVersions{Pinned: registry.Pinned}
+	for i := len(registry.Versions) - 1; i >= 0; i-- {
+		versions.Versions = append(versions.Versions, tenant.versionInfo(query.Type, registry, registry.Versions[i]))
+	}
+	return versions, nil
+}
+
+// PromoteModel serves a version of a model to workers and servers, and pins it until another version is promoted.
+// The latest version not rejected is served and pinning is cancelled if the version is 0.
+func (m *Master) PromoteModel(ctx context.Context, query *protocol.ModelQuery) (*protocol.ModelVersion, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.promote(ctx, query.Type, int(query.Version))
+}
+
+// RollbackModel serves the version not rejected before the serving version of a model, and pins it until another
+// version is promoted.
+func (m *Master) RollbackModel(ctx context.Context, query *protocol.ModelQuery) (*protocol.ModelVersion, error) {
+	tenant, err := m.tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.rollback(ctx, query.Type)
+}
+
+// modelPath returns the path of a persisted model of the tenant.
+func (m *Master) modelPath(name string) string {
+	if m.tenant != "" {
+		name = m.tenant + "_" + name
+	}
+	return filepath.Join(m.cfg.Master.ModelDir, name)
+}
+
+// registryFiles tracks files of a model registry in the model directory. Files are written outside the mutex of the
+// model, so writes are serialized by the mutex of files instead.
+type registryFiles struct {
+	sync.Mutex
+	// versions are versions written to files or loaded from files.
+	versions map[int]bool
+}
+
+// files returns the registry file name and the files of a type of models.
+func (m *Master) files(modelType string) (string, *registryFiles) {
+	if modelType == RankModel {
+		return rankModelFile, &m.rankModelFiles
+	}
+	return matchModelFile, &m.matchModelFiles
+}
+
+// versionFile returns the file name of a version of a model.
+func versionFile(name string, version int) string {
+	return fmt.Sprintf("%s_%x", name, version)
+}
+
+// saveModels persists the registry of a model to the model directory. It's a no-op if the model directory isn't set.
+// The registry is written without models from a snapshot, and each version is written to its own file once, so that
+// the mutex of the model isn't held during writing. Files of versions removed from the registry are deleted. Failures
+// are logged only since models are still served from memory. The mutex of the model must not be held.
+func (m *Master) saveModels(modelType string) {
+	if m.cfg.Master.ModelDir == "" {
+		return
+	}
+	name, files := m.files(modelType)
+	files.Lock()
+	defer files.Unlock()
+	// snapshot the registry, encoded models are never modified
+	mutex, registry, _ := m.registry(modelType)
+	mutex.Lock()
+	snapshot := *registry
+	snapshot.Versions = append([]modelVersion(nil), registry.Versions...)
+	mutex.Unlock()
+	if err := m.writeModels(name, files, snapshot); err != nil {
+		log.Errorf("master: failed to save %v models (%v)", modelType, err)
+	}
+}
+
+// writeModels writes new versions and the registry, and deletes files of versions removed from the registry. The mutex
+// of files must be held.
+func (m *Master) writeModels(name string, files *registryFiles, registry modelRegistry) error {
+	if err := os.MkdirAll(m.cfg.Master.ModelDir, os.ModePerm); err != nil {
+		return err
+	}
+	if files.versions == nil {
+		files.versions = make(map[int]bool)
+	}
+	kept := make(map[int]bool, len(registry.Versions))
+	for i, version := range registry.Versions {
+		if !files.versions[version.Version] {
+			if err := base.WriteGob(m.modelPath(versionFile(name, version.Version)), version.Model); err != nil {
+				return err
+			}
+			files.versions[version.Version] = true
+		}
+		kept[version.Version] = true
+		registry.Versions[i].Model = nil
+	}
+	if err := base.WriteGob(m.modelPath(name), registry); err != nil {
+		return err
+	}
+	for version := range files.versions {
+		if !kept[version] {
+			if err := os.Remove(m.modelPath(versionFile(name, version))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(files.versions, version)
+		}
+	}
+	return nil
+}
+
+// loadModels reloads registries of models persisted in the model directory, and serves their serving versions.
+// Models missing or failed to load are fitted by the loop later, as well as match models of other types than the
+// configured one.
+func (m *Master) loadModels(ctx context.Context) {
+	if m.cfg.Master.ModelDir == "" {
+		return
+	}
+	for _, modelType := range []string{MatchModel, RankModel} {
+		name, files := m.files(modelType)
+		files.Lock()
+		var loaded modelRegistry
+		if err := base.ReadGob(m.modelPath(name), &loaded); err != nil {
+			if !os.IsNotExist(err) {
+				log.Errorf("master: failed to load %v models (%v)", modelType, err)
+			}
+			files.Unlock()
+			continue
+		}
+		// versions failed to load are dropped
+		files.versions = make(map[int]bool)
+		versions := loaded.Versions[:0]
+		for _, version := range loaded.Versions {
+			if err := base.ReadGob(m.modelPath(versionFile(name, version.Version)), &version.Model); err != nil {
+				log.Errorf("master: failed to load %v model (version = %x, %v)", modelType, version.Version, err)
+				continue
+			}
+			files.versions[version.Version] = true
+			versions = append(versions, version)
+		}
+		loaded.Versions = versions
+		files.Unlock()
+		mutex, registry, _ := m.registry(modelType)
+		mutex.Lock()
+		*registry = loaded
+		registry.Serving = 0
+		if serving, exist := loaded.find(loaded.Serving); !exist {
+			registry.Pinned = false
+		} else if err := m.serve(ctx, modelType, serving); err != nil {
+			log.Errorf("master: failed to serve %v model (%v)", modelType, err)
+			registry.Pinned = false
+		} else {
+			log.Infof("master: loaded %v model (tenant = %q, version = %x, fit time = %v)",
+				modelType, m.tenant, serving.Version, serving.FitTime)
+		}
+		mutex.Unlock()
+	}
+}
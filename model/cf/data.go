@@ -15,6 +15,7 @@ package cf
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/model"
@@ -22,6 +23,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 const batchSize = 1000
@@ -35,6 +37,19 @@ type DataSet struct {
 	UserFeedback  [][]int
 	ItemFeedback  [][]int
 	Negatives     [][]int
+	// UserFeedbackValues and ItemFeedbackValues are values of feedback in UserFeedback and ItemFeedback, which are
+	// used as confidence weights.
+	UserFeedbackValues [][]float32
+	ItemFeedbackValues [][]float32
+	// FeedbackTimestamps are timestamps of feedback, which are available for datasets loaded from database.
+	FeedbackTimestamps []time.Time
+	// FeedbackCounts are counts of feedback, which are available for datasets loaded from database.
+	FeedbackCounts []int
+	// latest timestamps of items and feedback pulled from database, which are nil before the first pull
+	latestItemTime     *time.Time
+	latestFeedbackTime *time.Time
+	// feedbackPositions are positions of feedback pulled from database
+	feedbackPositions map[data.FeedbackKey]int
 }
 
 // NewMapIndexDataset creates a data set.
@@ -67,21 +82,21 @@ func NewDirectIndexDataset() *DataSet {
 
 func (dataset *DataSet) AddUser(userId string) {
 	dataset.UserIndex.Add(userId)
-	userIndex := dataset.UserIndex.ToNumber(userId)
-	for userIndex >= len(dataset.UserFeedback) {
-		dataset.UserFeedback = append(dataset.UserFeedback, make([]int, 0))
-	}
+	dataset.growUsers(dataset.UserIndex.ToNumber(userId))
 }
 
 func (dataset *DataSet) AddItem(itemId string) {
 	dataset.ItemIndex.Add(itemId)
-	itemIndex := dataset.ItemIndex.ToNumber(itemId)
-	for itemIndex >= len(dataset.ItemFeedback) {
-		dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int, 0))
-	}
+	dataset.growItems(dataset.ItemIndex.ToNumber(itemId))
+}
+
+// AddFeedback adds a feedback record with the default value. It returns false if the user or the item doesn't exist.
+func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool) bool {
+	return dataset.AddFeedbackWithValue(userId, itemId, data.DefaultFeedbackValue, insertUserItem)
 }
 
-func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool) {
+// AddFeedbackWithValue adds a feedback record with a value. It returns false if the user or the item doesn't exist.
+func (dataset *DataSet) AddFeedbackWithValue(userId, itemId string, value float32, insertUserItem bool) bool {
 	if insertUserItem {
 		dataset.UserIndex.Add(userId)
 	}
@@ -91,17 +106,63 @@ func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool)
 	userIndex := dataset.UserIndex.ToNumber(userId)
 	itemIndex := dataset.ItemIndex.ToNumber(itemId)
 	if userIndex != base.NotId && itemIndex != base.NotId {
-		dataset.FeedbackUsers = append(dataset.FeedbackUsers, userIndex)
-		dataset.FeedbackItems = append(dataset.FeedbackItems, itemIndex)
-		for itemIndex >= len(dataset.ItemFeedback) {
-			dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int, 0))
+		dataset.growUsers(userIndex)
+		dataset.growItems(itemIndex)
+		dataset.appendFeedback(userIndex, itemIndex, value)
+		return true
+	}
+	return false
+}
+
+// appendFeedback appends a feedback record by the user index and the item index.
+func (dataset *DataSet) appendFeedback(userIndex, itemIndex int, value float32) {
+	dataset.FeedbackUsers = append(dataset.FeedbackUsers, userIndex)
+	dataset.FeedbackItems = append(dataset.FeedbackItems, itemIndex)
+	dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
+	dataset.UserFeedbackValues[userIndex] = append(dataset.UserFeedbackValues[userIndex], value)
+	dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
+	dataset.ItemFeedbackValues[itemIndex] = append(dataset.ItemFeedbackValues[itemIndex], value)
+}
+
+func (dataset *DataSet) growUsers(userIndex int) {
+	for userIndex >= len(dataset.UserFeedback) {
+		dataset.UserFeedback = append(dataset.UserFeedback, make([]int, 0))
+	}
+	for userIndex >= len(dataset.UserFeedbackValues) {
+		dataset.UserFeedbackValues = append(dataset.UserFeedbackValues, make([]float32, 0))
+	}
+}
+
+func (dataset *DataSet) growItems(itemIndex int) {
+	for itemIndex >= len(dataset.ItemFeedback) {
+		dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int, 0))
+	}
+	for itemIndex >= len(dataset.ItemFeedbackValues) {
+		dataset.ItemFeedbackValues = append(dataset.ItemFeedbackValues, make([]float32, 0))
+	}
+}
+
+// HasFeedback checks whether a feedback record has been pulled from database.
+func (dataset *DataSet) HasFeedback(key data.FeedbackKey) bool {
+	_, exist := dataset.feedbackPositions[key]
+	return exist
+}
+
+// updateFeedback replaces the value, the timestamp and the count of the feedback at a position.
+func (dataset *DataSet) updateFeedback(position int, value float32, timestamp time.Time, count int) {
+	userIndex, itemIndex := dataset.FeedbackUsers[position], dataset.FeedbackItems[position]
+	for i, index := range dataset.UserFeedback[userIndex] {
+		if index == itemIndex {
+			dataset.UserFeedbackValues[userIndex][i] = value
 		}
-		dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
-		for userIndex >= len(dataset.UserFeedback) {
-			dataset.UserFeedback = append(dataset.UserFeedback, make([]int, 0))
+	}
+	for i, index := range dataset.ItemFeedback[itemIndex] {
+		if index == userIndex {
+			dataset.ItemFeedbackValues[itemIndex][i] = value
 		}
-		dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
 	}
+	dataset.FeedbackTimestamps[position] = timestamp
+	dataset.FeedbackCounts[position] = count
 }
 
 func (dataset *DataSet) SetNegatives(userId string, negatives []string) {
@@ -134,14 +195,6 @@ func (dataset *DataSet) ItemCount() int {
 	return dataset.ItemIndex.Len()
 }
 
-func createSliceOfSlice(n int) [][]int {
-	x := make([][]int, n)
-	for i := range x {
-		x[i] = make([]int, 0)
-	}
-	return x
-}
-
 func (dataset *DataSet) NegativeSample(excludeSet *DataSet, numCandidates int) [][]int {
 	if len(dataset.Negatives) == 0 {
 		rng := base.NewRandomGenerator(0)
@@ -162,23 +215,19 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 	trainSet, testSet := new(DataSet), new(DataSet)
 	trainSet.UserIndex, testSet.UserIndex = dataset.UserIndex, dataset.UserIndex
 	trainSet.ItemIndex, testSet.ItemIndex = dataset.ItemIndex, dataset.ItemIndex
-	trainSet.UserFeedback, testSet.UserFeedback = createSliceOfSlice(dataset.UserCount()), createSliceOfSlice(dataset.UserCount())
-	trainSet.ItemFeedback, testSet.ItemFeedback = createSliceOfSlice(dataset.ItemCount()), createSliceOfSlice(dataset.ItemCount())
+	trainSet.growUsers(dataset.UserCount() - 1)
+	trainSet.growItems(dataset.ItemCount() - 1)
+	testSet.growUsers(dataset.UserCount() - 1)
+	testSet.growItems(dataset.ItemCount() - 1)
 	rng := base.NewRandomGenerator(seed)
 	if numTestUsers >= dataset.UserCount() || numTestUsers <= 0 {
 		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
 			if len(dataset.UserFeedback[userIndex]) > 0 {
 				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers = append(testSet.FeedbackUsers, userIndex)
-				testSet.FeedbackItems = append(testSet.FeedbackItems, dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
+				testSet.appendFeedback(userIndex, dataset.UserFeedback[userIndex][k], dataset.UserFeedbackValues[userIndex][k])
 				for i, itemIndex := range dataset.UserFeedback[userIndex] {
 					if i != k {
-						trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-						trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+						trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValues[userIndex][i])
 					}
 				}
 			}
@@ -188,16 +237,10 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 		for _, userIndex := range testUsers {
 			if len(dataset.UserFeedback[userIndex]) > 0 {
 				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers = append(testSet.FeedbackUsers, userIndex)
-				testSet.FeedbackItems = append(testSet.FeedbackItems, dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
+				testSet.appendFeedback(userIndex, dataset.UserFeedback[userIndex][k], dataset.UserFeedbackValues[userIndex][k])
 				for i, itemIndex := range dataset.UserFeedback[userIndex] {
 					if i != k {
-						trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-						trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+						trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValues[userIndex][i])
 					}
 				}
 			}
@@ -205,11 +248,8 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 		testUserSet := base.NewSet(testUsers...)
 		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
 			if !testUserSet.Contain(userIndex) {
-				for _, itemIndex := range dataset.UserFeedback[userIndex] {
-					trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-					trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-					trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-					trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+				for i, itemIndex := range dataset.UserFeedback[userIndex] {
+					trainSet.appendFeedback(userIndex, itemIndex, dataset.UserFeedbackValues[userIndex][i])
 				}
 			}
 		}
@@ -259,17 +299,47 @@ func LoadDataFromCSV(fileName string, sep string, hasHeader bool) *DataSet {
 	return dataset
 }
 
-func LoadDataFromDatabase(database data.Database, feedbackTypes []string) (*DataSet, []data.Item, error) {
+// LoadDataFromDatabase loads users, items and feedback from the database.
+func LoadDataFromDatabase(ctx context.Context, database data.Database, feedbackTypes []string) (*DataSet, []data.Item, error) {
 	dataset := NewMapIndexDataset()
-	cursor := ""
+	items, err := dataset.PullDataFromDatabase(ctx, database, feedbackTypes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataset, items, nil
+}
+
+// PullDataFromDatabase appends users, items and feedback from the database to the dataset. All users are pulled while
+// only items and feedback in data.PullWindow before the latest ones in the dataset or newer are pulled. Feedback pulled
+// again replace pulled ones since they might be counted again. It returns pulled items.
+func (dataset *DataSet) PullDataFromDatabase(ctx context.Context, database data.Database, feedbackTypes []string) ([]data.Item, error) {
+	pullTime := time.Now()
+	// indices might be shared with trained models
+	dataset.UserIndex, dataset.ItemIndex = dataset.UserIndex.Clone(), dataset.ItemIndex.Clone()
+	if dataset.feedbackPositions == nil {
+		dataset.feedbackPositions = make(map[data.FeedbackKey]int)
+	}
+	var itemTimeLimit, feedbackTimeLimit *time.Time
+	latestItemTime, latestFeedbackTime := time.Time{}, time.Time{}
+	if dataset.latestItemTime != nil {
+		latestItemTime = *dataset.latestItemTime
+		timeLimit := latestItemTime.Add(-data.PullWindow)
+		itemTimeLimit = &timeLimit
+	}
+	if dataset.latestFeedbackTime != nil {
+		latestFeedbackTime = *dataset.latestFeedbackTime
+		timeLimit := latestFeedbackTime.Add(-data.PullWindow)
+		feedbackTimeLimit = &timeLimit
+	}
 	var err error
 	allItems := make([]data.Item, 0)
 	// pull users
+	cursor := ""
 	for {
 		var users []data.User
-		cursor, users, err = database.GetUsers(cursor, batchSize)
+		cursor, users, err = database.GetUsers(ctx, cursor, batchSize)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		for _, user := range users {
 			dataset.AddUser(user.UserId)
@@ -281,13 +351,16 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string) (*Data
 	// pull items
 	for {
 		var items []data.Item
-		cursor, items, err = database.GetItems(cursor, batchSize)
-		allItems = append(allItems, items...)
+		cursor, items, err = database.GetItems(ctx, cursor, batchSize, itemTimeLimit)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
+		allItems = append(allItems, items...)
 		for _, item := range items {
 			dataset.AddItem(item.ItemId)
+			if item.Timestamp.After(latestItemTime) {
+				latestItemTime = item.Timestamp
+			}
 		}
 		if cursor == "" {
 			break
@@ -297,19 +370,51 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string) (*Data
 	for _, feedbackType := range feedbackTypes {
 		for {
 			var feedback []data.Feedback
-			cursor, feedback, err = database.GetFeedback(feedbackType, cursor, batchSize)
+			cursor, feedback, err = database.GetFeedback(ctx, feedbackType, cursor, batchSize, feedbackTimeLimit)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 			for _, v := range feedback {
-				dataset.AddFeedback(v.UserId, v.ItemId, false)
+				// repeated feedback are weighted by counts
+				value := float32(v.Value) * float32(v.Count)
+				if position, exist := dataset.feedbackPositions[v.FeedbackKey]; exist {
+					dataset.updateFeedback(position, value, v.Timestamp, v.Count)
+				} else {
+					// items might be inserted after items are pulled
+					if feedbackTimeLimit != nil && dataset.ItemIndex.ToNumber(v.ItemId) == base.NotId {
+						item, err := database.GetItem(ctx, v.ItemId)
+						if err != nil && err.Error() != data.ErrItemNotExist {
+							return nil, err
+						} else if err == nil {
+							allItems = append(allItems, item)
+							dataset.AddItem(item.ItemId)
+						}
+					}
+					if !dataset.AddFeedbackWithValue(v.UserId, v.ItemId, value, false) {
+						continue
+					}
+					dataset.feedbackPositions[v.FeedbackKey] = len(dataset.FeedbackUsers) - 1
+					dataset.FeedbackTimestamps = append(dataset.FeedbackTimestamps, v.Timestamp)
+					dataset.FeedbackCounts = append(dataset.FeedbackCounts, v.Count)
+				}
+				if v.Timestamp.After(latestFeedbackTime) {
+					latestFeedbackTime = v.Timestamp
+				}
 			}
 			if cursor == "" {
 				break
 			}
 		}
 	}
-	return dataset, allItems, nil
+	// timestamps in the future are not trusted
+	if latestItemTime.After(pullTime) {
+		latestItemTime = pullTime
+	}
+	if latestFeedbackTime.After(pullTime) {
+		latestFeedbackTime = pullTime
+	}
+	dataset.latestItemTime, dataset.latestFeedbackTime = &latestItemTime, &latestFeedbackTime
+	return allItems, nil
 }
 
 func loadTest(dataset *DataSet, path string) error {
@@ -14,14 +14,18 @@
 package cf
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/storage/data"
 	"io"
 	"log"
 	"os"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewMapIndexDataset(t *testing.T) {
@@ -40,6 +44,105 @@ func TestNewMapIndexDataset(t *testing.T) {
 	assert.Equal(t, 6, dataSet.ItemCount())
 }
 
+func TestDataSet_Split(t *testing.T) {
+	dataSet := NewMapIndexDataset()
+	for i := 0; i < 4; i++ {
+		for j := i; j < 5; j++ {
+			dataSet.AddFeedbackWithValue(strconv.Itoa(i), strconv.Itoa(j), float32(i*10+j), true)
+		}
+	}
+	trainSet, testSet := dataSet.Split(0, 0)
+	assert.Equal(t, 4, testSet.Count())
+	assert.Equal(t, 10, trainSet.Count())
+	// values follow feedback
+	for _, subset := range []*DataSet{trainSet, testSet} {
+		for userIndex, items := range subset.UserFeedback {
+			for i, itemIndex := range items {
+				userId, itemId := subset.UserIndex.ToName(userIndex), subset.ItemIndex.ToName(itemIndex)
+				u, _ := strconv.Atoi(userId)
+				v, _ := strconv.Atoi(itemId)
+				assert.Equal(t, float32(u*10+v), subset.UserFeedbackValues[userIndex][i])
+			}
+		}
+		for itemIndex, users := range subset.ItemFeedback {
+			for i, userIndex := range users {
+				userId, itemId := subset.UserIndex.ToName(userIndex), subset.ItemIndex.ToName(itemIndex)
+				u, _ := strconv.Atoi(userId)
+				v, _ := strconv.Atoi(itemId)
+				assert.Equal(t, float32(u*10+v), subset.ItemFeedbackValues[itemIndex][i])
+			}
+		}
+	}
+}
+
+func TestDataSet_PullDataFromDatabase(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer s.Close()
+	database, err := data.Open("redis://"+s.Addr(), "")
+	assert.Nil(t, err)
+	defer database.Close()
+	timestamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = database.BatchInsertItem(context.Background(), []data.Item{{ItemId: "0", Timestamp: timestamp}, {ItemId: "1", Timestamp: timestamp}})
+	assert.Nil(t, err)
+	err = database.BatchInsertFeedback(context.Background(), []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Timestamp: timestamp},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "1"}, Timestamp: timestamp},
+	}, true, false)
+	assert.Nil(t, err)
+	// load dataset
+	dataSet, items, err := LoadDataFromDatabase(context.Background(), database, []string{"click"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, 2, dataSet.UserCount())
+	assert.Equal(t, 2, dataSet.ItemCount())
+	assert.Equal(t, 2, dataSet.Count())
+	// pull nothing new
+	items, err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dataSet.Count())
+	// pull new feedback, late feedback in the pull window and an item inserted after items are pulled
+	err = database.InsertItem(context.Background(), data.Item{ItemId: "2", Timestamp: timestamp.AddDate(0, 0, -1)})
+	assert.Nil(t, err)
+	err = database.BatchInsertFeedback(context.Background(), []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Timestamp: timestamp.Add(time.Hour)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "2"}, Timestamp: timestamp.Add(time.Hour)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "0"}, Timestamp: timestamp.Add(-data.PullWindow / 2)},
+	}, true, false)
+	assert.Nil(t, err)
+	items, err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click"})
+	assert.Nil(t, err)
+	assert.Contains(t, items, data.Item{ItemId: "2", Timestamp: timestamp.AddDate(0, 0, -1)})
+	assert.Equal(t, 3, dataSet.UserCount())
+	assert.Equal(t, 3, dataSet.ItemCount())
+	assert.Equal(t, 5, dataSet.Count())
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}))
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "2"}))
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "0"}))
+	// pull feedback of another type on the same user and item
+	err = database.InsertFeedback(context.Background(), data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "1"}, Timestamp: timestamp.Add(time.Hour), Value: 1, Count: 1,
+	}, true, false)
+	assert.Nil(t, err)
+	_, err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click", "like"})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, dataSet.Count())
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "1"}))
+	// pull counted feedback, including feedback appended by incremental pulls
+	err = database.BatchCountFeedback(context.Background(), []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Timestamp: timestamp.Add(2 * time.Hour)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Timestamp: timestamp.Add(2 * time.Hour)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "2"}, Timestamp: timestamp.Add(2 * time.Hour)},
+	}, true, false)
+	assert.Nil(t, err)
+	_, err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click", "like"})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, dataSet.Count())
+	assert.Equal(t, []int{3, 1, 1, 1, 2, 1}, dataSet.FeedbackCounts)
+	assert.Equal(t, timestamp.Add(2*time.Hour), dataSet.FeedbackTimestamps[0])
+	assert.Equal(t, timestamp.Add(2*time.Hour), dataSet.FeedbackTimestamps[4])
+}
+
 func md5Sum(fileName string) string {
 	// Open file
 	f, err := os.Open(fileName)
@@ -103,6 +103,9 @@ func EncodeModel(m MatrixFactorization) ([]byte, error) {
 	if err := encoder.Encode(m); err != nil {
 		return nil, err
 	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -335,12 +338,15 @@ func (bpr *BPR) Init(trainSet *DataSet) {
 // varying confidence levels. This leads to a factor model which is especially
 // tailored for implicit feedback recommenders. Authors also proposed a
 // scalable optimization procedure, which scales linearly with the data size.
+// The confidence level of positive preference is 1 + ConfidenceWeight * (value - 1),
+// which is 1 for feedback with the default value.
 // Hyper-parameters:
-//   NFactors   - The number of latent factors. Default is 10.
-//   NEpochs    - The number of training epochs. Default is 50.
-//   InitMean   - The mean of initial latent factors. Default is 0.
-//   InitStdDev - The standard deviation of initial latent factors. Default is 0.1.
-//   Reg        - The strength of regularization.
+//   NFactors         - The number of latent factors. Default is 10.
+//   NEpochs          - The number of training epochs. Default is 50.
+//   InitMean         - The mean of initial latent factors. Default is 0.
+//   InitStdDev       - The standard deviation of initial latent factors. Default is 0.1.
+//   Reg              - The strength of regularization.
+//   ConfidenceWeight - The weight of values of feedback in confidence. Default is 1.
 type ALS struct {
 	BaseMatrixFactorization
 	// Model parameters
@@ -353,6 +359,8 @@ type ALS struct {
 	initMean   float64
 	initStdDev float64
 	weight     float64
+	// confidenceWeight scales values of feedback into confidence
+	confidenceWeight float64
 }
 
 // NewALS creates a ALS model.
@@ -371,6 +379,7 @@ func (als *ALS) SetParams(params model.Params) {
 	als.initStdDev = float64(als.Params.GetFloat32(model.InitStdDev, 0.1))
 	als.reg = float64(als.Params.GetFloat32(model.Reg, 0.06))
 	als.weight = float64(als.Params.GetFloat32(model.Alpha, 0.001))
+	als.confidenceWeight = float64(als.Params.GetFloat32(model.ConfidenceWeight, 1))
 }
 
 func (als *ALS) GetParamsGrid() model.ParamsGrid {
@@ -436,12 +445,13 @@ func (als *ALS) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		err := base.Parallel(trainSet.UserCount(), config.Jobs, func(workerId, userIndex int) error {
 			a[workerId].Copy(c)
 			b := mat.NewVecDense(als.nFactors, nil)
-			for _, itemIndex := range trainSet.UserFeedback[userIndex] {
+			for i, itemIndex := range trainSet.UserFeedback[userIndex] {
+				confidence := 1 + als.confidenceWeight*(float64(trainSet.UserFeedbackValues[userIndex][i])-1)
 				// Y^T (C^u-I) Y
-				temp1[workerId].Outer(1, als.ItemFactor.RowView(itemIndex), als.ItemFactor.RowView(itemIndex))
+				temp1[workerId].Outer(confidence, als.ItemFactor.RowView(itemIndex), als.ItemFactor.RowView(itemIndex))
 				a[workerId].Add(a[workerId], temp1[workerId])
 				// Y^T C^u p(u)
-				temp2[workerId].ScaleVec(1+als.weight, als.ItemFactor.RowView(itemIndex))
+				temp2[workerId].ScaleVec(confidence+als.weight, als.ItemFactor.RowView(itemIndex))
 				b.AddVec(b, temp2[workerId])
 			}
 			a[workerId].Add(a[workerId], regI)
@@ -460,12 +470,13 @@ func (als *ALS) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		err = base.Parallel(trainSet.ItemCount(), config.Jobs, func(workerId, itemIndex int) error {
 			a[workerId].Copy(c)
 			b := mat.NewVecDense(als.nFactors, nil)
-			for _, index := range trainSet.ItemFeedback[itemIndex] {
+			for i, index := range trainSet.ItemFeedback[itemIndex] {
+				confidence := 1 + als.confidenceWeight*(float64(trainSet.ItemFeedbackValues[itemIndex][i])-1)
 				// X^T (C^i-I) X
-				temp1[workerId].Outer(1, als.UserFactor.RowView(index), als.UserFactor.RowView(index))
+				temp1[workerId].Outer(confidence, als.UserFactor.RowView(index), als.UserFactor.RowView(index))
 				a[workerId].Add(a[workerId], temp1[workerId])
 				// X^T C^i p(i)
-				temp2[workerId].ScaleVec(1+als.weight, als.UserFactor.RowView(index))
+				temp2[workerId].ScaleVec(confidence+als.weight, als.UserFactor.RowView(index))
 				b.AddVec(b, temp2[workerId])
 			}
 			a[workerId].Add(a[workerId], regI)
@@ -529,6 +540,9 @@ func (als *ALS) Init(trainSet *DataSet) {
 	als.BaseMatrixFactorization.Init(trainSet)
 }
 
+// CCD is the element-wise ALS (eALS) optimized by coordinate descent. The
+// confidence level of positive preference is 1 + ConfidenceWeight * (value - 1),
+// which is 1 for feedback with the default value.
 type CCD struct {
 	BaseMatrixFactorization
 	// Model parameters
@@ -541,6 +555,8 @@ type CCD struct {
 	initMean   float32
 	initStdDev float32
 	weight     float32
+	// confidenceWeight scales values of feedback into confidence
+	confidenceWeight float32
 }
 
 // NewCCD creates a eALS model.
@@ -559,6 +575,7 @@ func (ccd *CCD) SetParams(params model.Params) {
 	ccd.initStdDev = ccd.Params.GetFloat32(model.InitStdDev, 0.1)
 	ccd.reg = ccd.Params.GetFloat32(model.Reg, 0.06)
 	ccd.weight = ccd.Params.GetFloat32(model.Alpha, 0.001)
+	ccd.confidenceWeight = ccd.Params.GetFloat32(model.ConfidenceWeight, 1)
 }
 
 func (ccd *CCD) GetParamsGrid() model.ParamsGrid {
@@ -668,9 +685,10 @@ func (ccd *CCD) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 				}
 				// p_{uf} <-
 				a, b, c := float32(0), float32(0), float32(0)
-				for _, i := range userFeedback {
-					a += (1 - (1-ccd.weight)*userRes[workerId][i]) * ccd.ItemFactor[i][f]
-					c += (1 - ccd.weight) * ccd.ItemFactor[i][f] * ccd.ItemFactor[i][f]
+				for j, i := range userFeedback {
+					confidence := 1 + ccd.confidenceWeight*(trainSet.UserFeedbackValues[userIndex][j]-1)
+					a += (confidence - (confidence-ccd.weight)*userRes[workerId][i]) * ccd.ItemFactor[i][f]
+					c += (confidence - ccd.weight) * ccd.ItemFactor[i][f] * ccd.ItemFactor[i][f]
 				}
 				for k := 0; k < ccd.nFactors; k++ {
 					if k != f {
@@ -707,9 +725,10 @@ func (ccd *CCD) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 				}
 				// q_{if} <-
 				a, b, c := float32(0), float32(0), float32(0)
-				for _, u := range itemFeedback {
-					a += (1 - (1-ccd.weight)*itemRes[workerId][u]) * ccd.UserFactor[u][f]
-					c += (1 - ccd.weight) * ccd.UserFactor[u][f] * ccd.UserFactor[u][f]
+				for j, u := range itemFeedback {
+					confidence := 1 + ccd.confidenceWeight*(trainSet.ItemFeedbackValues[itemIndex][j]-1)
+					a += (confidence - (confidence-ccd.weight)*itemRes[workerId][u]) * ccd.UserFactor[u][f]
+					c += (confidence - ccd.weight) * ccd.UserFactor[u][f] * ccd.UserFactor[u][f]
 				}
 				for k := 0; k < ccd.nFactors; k++ {
 					if k != f {
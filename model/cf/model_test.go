@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/model"
 	"runtime"
+	"strconv"
 	"testing"
 )
 
@@ -150,3 +151,48 @@ func TestCCD_Pinterest(t *testing.T) {
 	score := m.Fit(trainSet, testSet, fitConfig)
 	assertEpsilon(t, 0.52, score.NDCG)
 }
+
+// newValuedDataset creates a small dataset and splits it, where feedback have the given value.
+func newValuedDataset(value float32) (*DataSet, *DataSet) {
+	dataset := NewMapIndexDataset()
+	for u := 0; u < 10; u++ {
+		for i := 0; i < 10; i++ {
+			if (u+i)%3 == 0 {
+				dataset.AddFeedbackWithValue(strconv.Itoa(u), strconv.Itoa(i), value, true)
+			}
+		}
+	}
+	return dataset.Split(2, 0)
+}
+
+func TestALS_DefaultConfidence(t *testing.T) {
+	// feedback with default values are weighted as if values were ignored
+	trainSet, testSet := newValuedDataset(1)
+	m := NewALS(model.Params{model.NEpochs: 3})
+	m.Fit(trainSet, testSet, fitConfig)
+	ignored := NewALS(model.Params{model.NEpochs: 3, model.ConfidenceWeight: 0})
+	ignored.Fit(trainSet, testSet, fitConfig)
+	assert.Equal(t, ignored.UserFactor.RawMatrix().Data, m.UserFactor.RawMatrix().Data)
+	assert.Equal(t, ignored.ItemFactor.RawMatrix().Data, m.ItemFactor.RawMatrix().Data)
+	// feedback with greater values are more confident
+	trainSet, testSet = newValuedDataset(2)
+	m.Clear()
+	m.Fit(trainSet, testSet, fitConfig)
+	assert.NotEqual(t, ignored.UserFactor.RawMatrix().Data, m.UserFactor.RawMatrix().Data)
+}
+
+func TestCCD_DefaultConfidence(t *testing.T) {
+	// feedback with default values are weighted as if values were ignored
+	trainSet, testSet := newValuedDataset(1)
+	m := NewCCD(model.Params{model.NEpochs: 3})
+	m.Fit(trainSet, testSet, fitConfig)
+	ignored := NewCCD(model.Params{model.NEpochs: 3, model.ConfidenceWeight: 0})
+	ignored.Fit(trainSet, testSet, fitConfig)
+	assert.Equal(t, ignored.UserFactor, m.UserFactor)
+	assert.Equal(t, ignored.ItemFactor, m.ItemFactor)
+	// feedback with greater values are more confident
+	trainSet, testSet = newValuedDataset(2)
+	m.Clear()
+	m.Fit(trainSet, testSet, fitConfig)
+	assert.NotEqual(t, ignored.UserFactor, m.UserFactor)
+}
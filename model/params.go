@@ -26,14 +26,15 @@ type ParamName string
 
 // Predefined hyper-parameter names
 const (
-	Lr          ParamName = "Lr"          // learning rate
-	Reg         ParamName = "Reg"         // regularization strength
-	NEpochs     ParamName = "NEpochs"     // number of epochs
-	NFactors    ParamName = "NFactors"    // number of factors
-	RandomState ParamName = "RandomState" // random state (seed)
-	InitMean    ParamName = "InitMean"    // mean of gaussian initial parameter
-	InitStdDev  ParamName = "InitStdDev"  // standard deviation of gaussian initial parameter
-	Alpha       ParamName = "Alpha"       // weight for negative samples in ALS
+	Lr               ParamName = "Lr"               // learning rate
+	Reg              ParamName = "Reg"              // regularization strength
+	NEpochs          ParamName = "NEpochs"          // number of epochs
+	NFactors         ParamName = "NFactors"         // number of factors
+	RandomState      ParamName = "RandomState"      // random state (seed)
+	InitMean         ParamName = "InitMean"         // mean of gaussian initial parameter
+	InitStdDev       ParamName = "InitStdDev"       // standard deviation of gaussian initial parameter
+	Alpha            ParamName = "Alpha"            // weight for negative samples in ALS
+	ConfidenceWeight ParamName = "ConfidenceWeight" // weight of feedback values in confidence of ALS
 )
 
 // Params stores hyper-parameters for an model. It is a map between strings
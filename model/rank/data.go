@@ -15,9 +15,11 @@ package rank
 
 import (
 	"bufio"
+	"context"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zhenghaoz/gorse/base"
@@ -37,6 +39,11 @@ type Dataset struct {
 	PositiveCount      int
 	UserFeedbackItems  [][]int
 	UserFeedbackTarget [][]float32
+	// latest timestamps of items and feedback pulled from database, which are nil before the first pull
+	latestItemTime     *time.Time
+	latestFeedbackTime *time.Time
+	// feedbackPositions are positions of feedback pulled from database in UserFeedbackItems
+	feedbackPositions map[data.FeedbackKey]int
 }
 
 func (dataset *Dataset) UserCount() int {
@@ -122,8 +129,43 @@ func LoadDataFromBuiltIn(name string) (train *Dataset, test *Dataset, err error)
 	return
 }
 
-func LoadDataFromDatabase(database data.Database, feedbackTypes []string) (*Dataset, error) {
-	unifiedIndex := NewUnifiedMapIndexBuilder()
+// LoadDataFromDatabase loads users, items and feedback from the database.
+func LoadDataFromDatabase(ctx context.Context, database data.Database, feedbackTypes []string) (*Dataset, error) {
+	dataSet := NewMapIndexDataset()
+	if err := dataSet.PullDataFromDatabase(ctx, database, feedbackTypes); err != nil {
+		return nil, err
+	}
+	return dataSet, nil
+}
+
+// NewMapIndexDataset creates an empty dataset with map index.
+func NewMapIndexDataset() *Dataset {
+	return &Dataset{
+		UnifiedIndex:   NewUnifiedMapIndexBuilder().Build(),
+		FeedbackTarget: make([]float32, 0),
+	}
+}
+
+// PullDataFromDatabase appends users, items and feedback from the database to the dataset. All users are pulled while
+// only items and feedback in data.PullWindow before the latest ones in the dataset or newer are pulled. Feedback pulled
+// again replace pulled ones.
+func (dataset *Dataset) PullDataFromDatabase(ctx context.Context, database data.Database, feedbackTypes []string) error {
+	pullTime := time.Now()
+	if dataset.feedbackPositions == nil {
+		dataset.feedbackPositions = make(map[data.FeedbackKey]int)
+	}
+	var itemTimeLimit, feedbackTimeLimit *time.Time
+	latestItemTime, latestFeedbackTime := time.Time{}, time.Time{}
+	if dataset.latestItemTime != nil {
+		latestItemTime = *dataset.latestItemTime
+		timeLimit := latestItemTime.Add(-data.PullWindow)
+		itemTimeLimit = &timeLimit
+	}
+	if dataset.latestFeedbackTime != nil {
+		latestFeedbackTime = *dataset.latestFeedbackTime
+		timeLimit := latestFeedbackTime.Add(-data.PullWindow)
+		feedbackTimeLimit = &timeLimit
+	}
 	cursor := ""
 	var err error
 	users := make([]data.User, 0)
@@ -131,17 +173,11 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string) (*Data
 	// pull users
 	for {
 		var batchUsers []data.User
-		cursor, batchUsers, err = database.GetUsers(cursor, batchSize)
+		cursor, batchUsers, err = database.GetUsers(ctx, cursor, batchSize)
 		if err != nil {
-			return nil, err
-		}
-		for _, user := range batchUsers {
-			users = append(users, user)
-			unifiedIndex.AddUser(user.UserId)
-			for _, label := range user.Labels {
-				unifiedIndex.AddLabel(label)
-			}
+			return err
 		}
+		users = append(users, batchUsers...)
 		if cursor == "" {
 			break
 		}
@@ -149,74 +185,184 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string) (*Data
 	// pull items
 	for {
 		var batchItems []data.Item
-		cursor, batchItems, err = database.GetItems(cursor, batchSize)
+		cursor, batchItems, err = database.GetItems(ctx, cursor, batchSize, itemTimeLimit)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		for _, item := range batchItems {
 			items = append(items, item)
-			unifiedIndex.AddItem(item.ItemId)
-			for _, label := range item.Labels {
-				unifiedIndex.AddLabel(label)
+			if item.Timestamp.After(latestItemTime) {
+				latestItemTime = item.Timestamp
 			}
 		}
 		if cursor == "" {
 			break
 		}
 	}
-	// create dataset
-	dataSet := &Dataset{
-		UnifiedIndex:   unifiedIndex.Build(),
-		FeedbackTarget: make([]float32, 0),
-	}
-	// insert users
-	dataSet.UserItemLabels = make([][]int, dataSet.UnifiedIndex.CountItems()+dataSet.UnifiedIndex.CountUsers())
-	for _, user := range users {
-		userId := dataSet.UnifiedIndex.EncodeUser(user.UserId)
-		dataSet.UserItemLabels[userId] = make([]int, len(user.Labels))
-		for i := range user.Labels {
-			dataSet.UserItemLabels[userId][i] = dataSet.UnifiedIndex.EncodeLabel(user.Labels[i])
+	dataset.AddUsersAndItems(users, items)
+	// insert feedback
+	pendingFeedback := make([]data.Feedback, 0)
+	addFeedback := func(v data.Feedback) {
+		userIndex := dataset.UnifiedIndex.EncodeUser(v.UserId)
+		if position, exist := dataset.feedbackPositions[v.FeedbackKey]; exist {
+			dataset.UserFeedbackTarget[userIndex][position] = float32(v.Value)
+		} else if dataset.AddFeedback(v.UserId, v.ItemId, float32(v.Value)) {
+			dataset.feedbackPositions[v.FeedbackKey] = len(dataset.UserFeedbackItems[userIndex]) - 1
+		} else {
+			return
 		}
-	}
-	// insert items
-	for _, item := range items {
-		itemId := dataSet.UnifiedIndex.EncodeItem(item.ItemId)
-		dataSet.UserItemLabels[itemId] = make([]int, len(item.Labels))
-		for i := range item.Labels {
-			dataSet.UserItemLabels[itemId][i] = dataSet.UnifiedIndex.EncodeLabel(item.Labels[i])
+		if v.Timestamp.After(latestFeedbackTime) {
+			latestFeedbackTime = v.Timestamp
 		}
 	}
-	// insert feedback
-	dataSet.UserFeedbackItems = base.NewMatrixInt(dataSet.UnifiedIndex.CountUsers(), 0)
-	dataSet.UserFeedbackTarget = base.NewMatrix32(dataSet.UnifiedIndex.CountUsers(), 0)
 	for _, feedbackType := range feedbackTypes {
 		for {
 			var batchFeedback []data.Feedback
-			cursor, batchFeedback, err = database.GetFeedback(feedbackType, cursor, batchSize)
+			cursor, batchFeedback, err = database.GetFeedback(ctx, feedbackType, cursor, batchSize, feedbackTimeLimit)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			for _, v := range batchFeedback {
-				userId := dataSet.UnifiedIndex.EncodeUser(v.UserId)
-				if userId == base.NotId {
+				if dataset.UnifiedIndex.EncodeUser(v.UserId) == base.NotId {
 					log.Warnf("user (%v) not found", v.UserId)
 					continue
 				}
-				itemId := dataSet.UnifiedIndex.EncodeItem(v.ItemId)
-				if itemId == base.NotId {
-					log.Warnf("item (%v) not found", v.ItemId)
+				if dataset.UnifiedIndex.EncodeItem(v.ItemId) == base.NotId {
+					if itemTimeLimit != nil {
+						// items might be inserted after items are pulled
+						pendingFeedback = append(pendingFeedback, v)
+					} else {
+						log.Warnf("item (%v) not found", v.ItemId)
+					}
 					continue
 				}
-				dataSet.PositiveCount++
-				dataSet.UserFeedbackItems[userId] = append(dataSet.UserFeedbackItems[userId], itemId)
-				dataSet.UserFeedbackTarget[userId] = append(dataSet.UserFeedbackTarget[userId], 1)
+				addFeedback(v)
 			}
 			if cursor == "" {
 				break
 			}
 		}
 	}
-	return dataSet, nil
+	// insert feedback of items inserted after items are pulled
+	if len(pendingFeedback) > 0 {
+		pendingItems := make([]data.Item, 0)
+		pendingItemSet := base.NewStringSet()
+		for _, v := range pendingFeedback {
+			if !pendingItemSet.Contain(v.ItemId) {
+				pendingItemSet.Add(v.ItemId)
+				item, err := database.GetItem(ctx, v.ItemId)
+				if err != nil && err.Error() != data.ErrItemNotExist {
+					return err
+				} else if err == nil {
+					pendingItems = append(pendingItems, item)
+				}
+			}
+		}
+		dataset.AddUsersAndItems(nil, pendingItems)
+		for _, v := range pendingFeedback {
+			if dataset.UnifiedIndex.EncodeItem(v.ItemId) == base.NotId {
+				log.Warnf("item (%v) not found", v.ItemId)
+				continue
+			}
+			addFeedback(v)
+		}
+	}
+	// timestamps in the future are not trusted
+	if latestItemTime.After(pullTime) {
+		latestItemTime = pullTime
+	}
+	if latestFeedbackTime.After(pullTime) {
+		latestFeedbackTime = pullTime
+	}
+	dataset.latestItemTime, dataset.latestFeedbackTime = &latestItemTime, &latestFeedbackTime
+	return nil
+}
+
+// AddUsersAndItems adds users and items to the dataset. Labels of existing users and items are replaced. The index
+// is copied since it might be shared with trained models, then encoded items and labels are shifted.
+func (dataset *Dataset) AddUsersAndItems(users []data.User, items []data.Item) {
+	oldIndex, ok := dataset.UnifiedIndex.(*UnifiedMapIndex)
+	if !ok {
+		panic("only datasets with map index support adding users and items")
+	}
+	newIndex := &UnifiedMapIndex{
+		UserIndex:  oldIndex.UserIndex.Clone(),
+		ItemIndex:  oldIndex.ItemIndex.Clone(),
+		LabelIndex: oldIndex.LabelIndex.Clone(),
+	}
+	for _, user := range users {
+		newIndex.UserIndex.Add(user.UserId)
+		for _, label := range user.Labels {
+			newIndex.LabelIndex.Add(label)
+		}
+	}
+	for _, item := range items {
+		newIndex.ItemIndex.Add(item.ItemId)
+		for _, label := range item.Labels {
+			newIndex.LabelIndex.Add(label)
+		}
+	}
+	// shift encoded items and labels
+	itemShift := newIndex.CountUsers() - oldIndex.CountUsers()
+	labelShift := itemShift + newIndex.CountItems() - oldIndex.CountItems()
+	userItemLabels := make([][]int, newIndex.CountUsers()+newIndex.CountItems())
+	for i, labels := range dataset.UserItemLabels {
+		j := i
+		if i >= oldIndex.CountUsers() {
+			j += itemShift
+		}
+		userItemLabels[j] = make([]int, len(labels))
+		for k, label := range labels {
+			userItemLabels[j][k] = label + labelShift
+		}
+	}
+	for userId := range dataset.UserFeedbackItems {
+		for i := range dataset.UserFeedbackItems[userId] {
+			dataset.UserFeedbackItems[userId][i] += itemShift
+		}
+	}
+	for len(dataset.UserFeedbackItems) < newIndex.CountUsers() {
+		dataset.UserFeedbackItems = append(dataset.UserFeedbackItems, make([]int, 0))
+		dataset.UserFeedbackTarget = append(dataset.UserFeedbackTarget, make([]float32, 0))
+	}
+	dataset.UnifiedIndex = newIndex
+	dataset.UserItemLabels = userItemLabels
+	// insert users
+	for _, user := range users {
+		userId := dataset.UnifiedIndex.EncodeUser(user.UserId)
+		dataset.UserItemLabels[userId] = make([]int, len(user.Labels))
+		for i := range user.Labels {
+			dataset.UserItemLabels[userId][i] = dataset.UnifiedIndex.EncodeLabel(user.Labels[i])
+		}
+	}
+	// insert items
+	for _, item := range items {
+		itemId := dataset.UnifiedIndex.EncodeItem(item.ItemId)
+		dataset.UserItemLabels[itemId] = make([]int, len(item.Labels))
+		for i := range item.Labels {
+			dataset.UserItemLabels[itemId][i] = dataset.UnifiedIndex.EncodeLabel(item.Labels[i])
+		}
+	}
+}
+
+// AddFeedback adds a positive feedback record whose value is the target. It returns false if the user or the item
+// doesn't exist.
+func (dataset *Dataset) AddFeedback(userId, itemId string, value float32) bool {
+	userIndex := dataset.UnifiedIndex.EncodeUser(userId)
+	itemIndex := dataset.UnifiedIndex.EncodeItem(itemId)
+	if userIndex == base.NotId || itemIndex == base.NotId {
+		return false
+	}
+	dataset.PositiveCount++
+	dataset.UserFeedbackItems[userIndex] = append(dataset.UserFeedbackItems[userIndex], itemIndex)
+	dataset.UserFeedbackTarget[userIndex] = append(dataset.UserFeedbackTarget[userIndex], value)
+	return true
+}
+
+// HasFeedback checks whether a positive feedback record has been pulled from database.
+func (dataset *Dataset) HasFeedback(key data.FeedbackKey) bool {
+	_, exist := dataset.feedbackPositions[key]
+	return exist
 }
 
 func (dataset *Dataset) Split(ratio float32, seed int64) (*Dataset, *Dataset) {
@@ -0,0 +1,94 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rank
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"testing"
+	"time"
+)
+
+func TestDataset_PullDataFromDatabase(t *testing.T) {
+	s, err := miniredis.Run()
+	assert.Nil(t, err)
+	defer s.Close()
+	database, err := data.Open("redis://"+s.Addr(), "")
+	assert.Nil(t, err)
+	defer database.Close()
+	timestamp := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = database.InsertUser(context.Background(), data.User{UserId: "0", Labels: []string{"a"}})
+	assert.Nil(t, err)
+	err = database.InsertItem(context.Background(), data.Item{ItemId: "0", Timestamp: timestamp, Labels: []string{"b"}})
+	assert.Nil(t, err)
+	err = database.InsertFeedback(context.Background(), data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"},
+		Timestamp:   timestamp,
+		Value:       5,
+	}, false, false)
+	assert.Nil(t, err)
+	// load dataset
+	dataSet, err := LoadDataFromDatabase(context.Background(), database, []string{"click"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, dataSet.UserCount())
+	assert.Equal(t, 1, dataSet.ItemCount())
+	assert.Equal(t, 2, dataSet.LabelCount())
+	assert.Equal(t, 1, dataSet.PositiveCount)
+	assert.Equal(t, []float32{5}, dataSet.UserFeedbackTarget[0])
+	index := dataSet.UnifiedIndex
+	// pull nothing new
+	err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, dataSet.PositiveCount)
+	// pull new users, items and feedback
+	err = database.InsertUser(context.Background(), data.User{UserId: "1", Labels: []string{"c"}})
+	assert.Nil(t, err)
+	err = database.InsertItem(context.Background(), data.Item{ItemId: "1", Timestamp: timestamp.AddDate(0, 0, -1), Labels: []string{"d"}})
+	assert.Nil(t, err)
+	err = database.BatchInsertFeedback(context.Background(), []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Timestamp: timestamp.Add(time.Hour)},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "0"}, Timestamp: timestamp.Add(time.Hour)},
+	}, false, false)
+	assert.Nil(t, err)
+	err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dataSet.UserCount())
+	assert.Equal(t, 2, dataSet.ItemCount())
+	assert.Equal(t, 4, dataSet.LabelCount())
+	assert.Equal(t, 3, dataSet.PositiveCount)
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}))
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}))
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "0"}))
+	// check encoding
+	assert.Equal(t, []int{dataSet.UnifiedIndex.EncodeLabel("a")}, dataSet.UserItemLabels[dataSet.UnifiedIndex.EncodeUser("0")])
+	assert.Equal(t, []int{dataSet.UnifiedIndex.EncodeLabel("b")}, dataSet.UserItemLabels[dataSet.UnifiedIndex.EncodeItem("0")])
+	assert.Equal(t, []int{dataSet.UnifiedIndex.EncodeLabel("c")}, dataSet.UserItemLabels[dataSet.UnifiedIndex.EncodeUser("1")])
+	assert.Equal(t, []int{dataSet.UnifiedIndex.EncodeLabel("d")}, dataSet.UserItemLabels[dataSet.UnifiedIndex.EncodeItem("1")])
+	// the previous index is unchanged
+	assert.Equal(t, 1, index.CountUsers())
+	assert.Equal(t, 1, index.EncodeItem("0"))
+	// pull feedback of another type on the same user and item, and feedback pulled again with a new value
+	err = database.BatchInsertFeedback(context.Background(), []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "0"}, Timestamp: timestamp.Add(time.Hour), Value: 2},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Timestamp: timestamp.Add(time.Hour), Value: 3},
+	}, false, false)
+	assert.Nil(t, err)
+	err = dataSet.PullDataFromDatabase(context.Background(), database, []string{"click", "like"})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, dataSet.PositiveCount)
+	assert.True(t, dataSet.HasFeedback(data.FeedbackKey{FeedbackType: "like", UserId: "0", ItemId: "0"}))
+	assert.ElementsMatch(t, []float32{5, 3, 2}, dataSet.UserFeedbackTarget[dataSet.UnifiedIndex.EncodeUser("0")])
+}
@@ -237,6 +237,12 @@ func (fm *FM) Fit(trainSet *Dataset, testSet *Dataset, config *FitConfig) Score
 					grad = prediction - target
 					cost += grad * grad / 2
 				case FMClassification:
+					// values of positive feedback are treated as positive labels
+					if target > 0 {
+						target = 1
+					} else {
+						target = -1
+					}
 					grad = -target * (1 - 1/(1+math32.Exp(-target*prediction)))
 				default:
 					log.Fatal("FM.Fit: unknown task ", fm.Task)
@@ -342,6 +348,9 @@ func EncodeModel(m FactorizationMachine) ([]byte, error) {
 	if err := encoder.Encode(m); err != nil {
 		return nil, err
 	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -0,0 +1,90 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MasterAddresses parses addresses of masters separated by commas. The port is used by addresses without ports.
+func MasterAddresses(hosts string, port int) []string {
+	var addresses []string
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		addresses = append(addresses, host)
+	}
+	return addresses
+}
+
+// failoverConn is a connection to masters. Calls are made to the current master and fail over to the next master if
+// the current master is unavailable, including followers rejecting calls served by the leader.
+type failoverConn struct {
+	conns []*grpc.ClientConn
+	// current is the index of the current master.
+	current uint32
+}
+
+// DialMasters connects to masters, and calls fail over between masters. Calls rejected by all masters fail with the
+// error of the last master.
+func DialMasters(addresses []string, opts ...grpc.DialOption) (grpc.ClientConnInterface, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no master address")
+	}
+	c := new(failoverConn)
+	for _, address := range addresses {
+		conn, err := grpc.Dial(address, opts...)
+		if err != nil {
+			for _, conn := range c.conns {
+				conn.Close()
+			}
+			return nil, err
+		}
+		c.conns = append(c.conns, conn)
+	}
+	return c, nil
+}
+
+func (c *failoverConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{},
+	opts ...grpc.CallOption) error {
+	var err error
+	for i := 0; i < len(c.conns); i++ {
+		current := atomic.LoadUint32(&c.current)
+		if err = c.conns[current].Invoke(ctx, method, args, reply, opts...); status.Code(err) != codes.Unavailable {
+			return err
+		}
+		atomic.CompareAndSwapUint32(&c.current, current, (current+1)%uint32(len(c.conns)))
+	}
+	return err
+}
+
+// NewStream creates a stream to the current master. Streams don't fail over.
+func (c *failoverConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.conns[atomic.LoadUint32(&c.current)].NewStream(ctx, desc, method, opts...)
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasterAddresses(t *testing.T) {
+	assert.Equal(t, []string{"127.0.0.1:8086"}, MasterAddresses("127.0.0.1", 8086))
+	assert.Equal(t, []string{"10.0.0.1:8086", "10.0.0.2:9000", "[::1]:8086"},
+		MasterAddresses("10.0.0.1, 10.0.0.2:9000,::1,", 8086))
+}
@@ -28,6 +28,10 @@ type MasterClient interface {
 	GetCluster(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Cluster, error)
 	RegisterServer(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error)
 	RegisterWorker(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Void, error)
+	// model registry
+	ListModels(ctx context.Context, in *ModelQuery, opts ...grpc.CallOption) (*ModelVersions, error)
+	PromoteModel(ctx context.Context, in *ModelQuery, opts ...grpc.CallOption) (*ModelVersion, error)
+	RollbackModel(ctx context.Context, in *ModelQuery, opts ...grpc.CallOption) (*ModelVersion, error)
 }
 
 type masterClient struct {
@@ -110,6 +114,33 @@ func (c *masterClient) RegisterWorker(ctx context.Context, in *Void, opts ...grp
 	return out, nil
 }
 
+func (c *masterClient) ListModels(ctx context.Context, in *ModelQuery, opts ...grpc.CallOption) (*ModelVersions, error) {
+	out := new(ModelVersions)
+	err := c.cc.Invoke(ctx, "/protocol.Master/ListModels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) PromoteModel(ctx context.Context, in *ModelQuery, opts ...grpc.CallOption) (*ModelVersion, error) {
+	out := new(ModelVersion)
+	err := c.cc.Invoke(ctx, "/protocol.Master/PromoteModel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) RollbackModel(ctx context.Context, in *ModelQuery, opts ...grpc.CallOption) (*ModelVersion, error) {
+	out := new(ModelVersion)
+	err := c.cc.Invoke(ctx, "/protocol.Master/RollbackModel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MasterServer is the server API for Master service.
 // All implementations must embed UnimplementedMasterServer
 // for forward compatibility
@@ -125,6 +156,10 @@ type MasterServer interface {
 	GetCluster(context.Context, *Void) (*Cluster, error)
 	RegisterServer(context.Context, *Void) (*Void, error)
 	RegisterWorker(context.Context, *Void) (*Void, error)
+	// model registry
+	ListModels(context.Context, *ModelQuery) (*ModelVersions, error)
+	PromoteModel(context.Context, *ModelQuery) (*ModelVersion, error)
+	RollbackModel(context.Context, *ModelQuery) (*ModelVersion, error)
 	mustEmbedUnimplementedMasterServer()
 }
 
@@ -156,6 +191,15 @@ func (UnimplementedMasterServer) RegisterServer(context.Context, *Void) (*Void,
 func (UnimplementedMasterServer) RegisterWorker(context.Context, *Void) (*Void, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RegisterWorker not implemented")
 }
+func (UnimplementedMasterServer) ListModels(context.Context, *ModelQuery) (*ModelVersions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListModels not implemented")
+}
+func (UnimplementedMasterServer) PromoteModel(context.Context, *ModelQuery) (*ModelVersion, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PromoteModel not implemented")
+}
+func (UnimplementedMasterServer) RollbackModel(context.Context, *ModelQuery) (*ModelVersion, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackModel not implemented")
+}
 func (UnimplementedMasterServer) mustEmbedUnimplementedMasterServer() {}
 
 // UnsafeMasterServer may be embedded to opt out of forward compatibility for this service.
@@ -313,6 +357,60 @@ func _Master_RegisterWorker_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Master_ListModels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModelQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).ListModels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.Master/ListModels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).ListModels(ctx, req.(*ModelQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_PromoteModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModelQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).PromoteModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.Master/PromoteModel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).PromoteModel(ctx, req.(*ModelQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_RollbackModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModelQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).RollbackModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.Master/RollbackModel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).RollbackModel(ctx, req.(*ModelQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Master_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protocol.Master",
 	HandlerType: (*MasterServer)(nil),
@@ -349,6 +447,18 @@ var _Master_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RegisterWorker",
 			Handler:    _Master_RegisterWorker_Handler,
 		},
+		{
+			MethodName: "ListModels",
+			Handler:    _Master_ListModels_Handler,
+		},
+		{
+			MethodName: "PromoteModel",
+			Handler:    _Master_PromoteModel_Handler,
+		},
+		{
+			MethodName: "RollbackModel",
+			Handler:    _Master_RollbackModel_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "protocol.proto",
@@ -0,0 +1,44 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package protocol
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// tenantKey is the key of the tenant in metadata of rpc calls.
+const tenantKey = "tenant"
+
+// WithTenant returns a context for rpc calls on behalf of a tenant. Calls are made on behalf of the default tenant if
+// the tenant is empty.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, tenantKey, tenant)
+}
+
+// TenantFromContext returns the tenant of an incoming rpc call. The default tenant is empty.
+func TenantFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(tenantKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
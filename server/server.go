@@ -16,6 +16,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/araddon/dateparse"
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
@@ -48,6 +49,10 @@ type Server struct {
 	MasterPort int
 	ServerHost string
 	ServerPort int
+
+	// Tenant is the name of the tenant served by the server, which is empty for the default tenant. Routes of a tenant
+	// are prefixed by "/tenant/{name}".
+	Tenant string
 }
 
 func NewServer(masterHost string, masterPort int, serverHost string, serverPort int) *Server {
@@ -60,8 +65,8 @@ func NewServer(masterHost string, masterPort int, serverHost string, serverPort
 }
 
 func (s *Server) Serve() {
-	// connect to master
-	conn, err := grpc.Dial(fmt.Sprintf("%v:%v", s.MasterHost, s.MasterPort), grpc.WithInsecure())
+	// connect to masters
+	conn, err := protocol.DialMasters(protocol.MasterAddresses(s.MasterHost, s.MasterPort), grpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("server: failed to connect master (%v)", err)
 	}
@@ -77,15 +82,8 @@ func (s *Server) Serve() {
 		log.Fatalf("server: failed to parse master config (%v)", err)
 	}
 
-	// connect to data store
-	if s.DataStore, err = data.Open(s.Config.Database.DataStore); err != nil {
-		log.Fatalf("server: failed to connect data store (%v)", err)
-	}
-
-	// connect to cache store
-	if s.CacheStore, err = cache.Open(s.Config.Database.CacheStore); err != nil {
-		log.Fatalf("server: failed to connect cache store (%v)", err)
-	}
+	// connect to databases
+	s.connect()
 
 	// register to master
 	go s.Register()
@@ -95,6 +93,12 @@ func (s *Server) Serve() {
 	// register restful APIs
 	ws := s.CreateWebService()
 	restful.DefaultContainer.Add(ws)
+	for name := range s.Config.Tenants {
+		tenant := s.newTenant(name)
+		tenant.connect()
+		go tenant.Sync()
+		restful.DefaultContainer.Add(tenant.CreateWebService())
+	}
 
 	// register swagger UI
 	specConfig := restfulspec.Config{
@@ -109,33 +113,43 @@ func (s *Server) Serve() {
 	log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort), nil))
 }
 
+// newTenant creates the server of a tenant, which shares the connection to the master.
+func (s *Server) newTenant(name string) *Server {
+	tenant := NewServer(s.MasterHost, s.MasterPort, s.ServerHost, s.ServerPort)
+	tenant.Config, _ = s.Config.Tenant(name)
+	tenant.MasterClient = s.MasterClient
+	tenant.Tenant = name
+	return tenant
+}
+
+// connect connects to databases in the namespace of the tenant.
+func (s *Server) connect() {
+	var err error
+	if s.DataStore, err = data.OpenWithReplica(s.Config.Database.DataStore, s.Config.Database.DataStoreReplica, s.Tenant); err != nil {
+		log.Fatalf("server: failed to connect data store (%v)", err)
+	}
+	if s.CacheStore, err = cache.Open(s.Config.Database.CacheStore, s.Tenant); err != nil {
+		log.Fatalf("server: failed to connect cache store (%v)", err)
+	}
+}
+
 func (s *Server) Sync() {
 	for {
-		ctx := context.Background()
+		ctx := protocol.WithTenant(context.Background(), s.Tenant)
 
 		// pull model version
 		log.Debug("server: check model version")
 		modelVersion, err := s.MasterClient.GetRankModelVersion(ctx, &protocol.Void{})
 		if err != nil {
-			log.Fatalf("server: failed to check model version (%v)", err)
-		}
-
-		// pull model
-		if modelVersion.Version != s.RankModelVersion {
+			log.Errorf("server: failed to check model version (%v)", err)
+		} else if modelVersion.Version != s.RankModelVersion {
+			// pull model
 			log.Infof("server: sync model")
-			modelData, err := s.MasterClient.GetRankModel(ctx, &protocol.Void{}, grpc.MaxCallRecvMsgSize(10e9))
-			if err != nil {
-				log.Fatalf("server: failed to sync model (%v)", err)
+			if err = s.syncRankModel(ctx); err != nil {
+				log.Errorf("server: failed to sync model (%v)", err)
+			} else {
+				log.Infof("server: complete sync model")
 			}
-			nextModel, err := rank.DecodeModel(modelData.Model)
-			if err != nil {
-				log.Fatalf("server: failed to decode model (%v)", err)
-			}
-			s.RankModelMutex.Lock()
-			s.RankModel = nextModel
-			s.RankModelVersion = modelData.Version
-			s.RankModelMutex.Unlock()
-			log.Infof("server: complete sync model")
 		}
 
 		// sleep
@@ -143,10 +157,29 @@ func (s *Server) Sync() {
 	}
 }
 
+// syncRankModel pulls the rank model from the master.
+func (s *Server) syncRankModel(ctx context.Context) error {
+	modelData, err := s.MasterClient.GetRankModel(ctx, &protocol.Void{}, grpc.MaxCallRecvMsgSize(10e9))
+	if err != nil {
+		return err
+	}
+	nextModel, err := rank.DecodeModel(modelData.Model)
+	if err != nil {
+		return err
+	}
+	s.RankModelMutex.Lock()
+	s.RankModel = nextModel
+	s.RankModelVersion = modelData.Version
+	s.RankModelMutex.Unlock()
+	return nil
+}
+
+// Register keeps the server registered to the master. Failures are retried in the next period, during which masters
+// might fail over.
 func (s *Server) Register() {
 	for {
 		if _, err := s.MasterClient.RegisterServer(context.Background(), &protocol.Void{}); err != nil {
-			log.Fatal("server:", err)
+			log.Errorf("server: failed to register (%v)", err)
 		}
 		time.Sleep(time.Duration(s.Config.Master.ClusterMetaTimeout/2) * time.Second)
 	}
@@ -156,6 +189,9 @@ func (s *Server) CreateWebService() *restful.WebService {
 	// Create a server
 	ws := new(restful.WebService)
 	ws.Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	if s.Tenant != "" {
+		ws.Path("/tenant/" + s.Tenant)
+	}
 
 	/* Interactions with data store */
 
@@ -181,12 +217,39 @@ func (s *Server) CreateWebService() *restful.WebService {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
 		Param(ws.QueryParameter("cursor", "cursor of iteration").DataType("string")).
 		Writes(UserIterator{}))
+	// Insert or replace a user
+	ws.Route(ws.PUT("/user/{user-id}").To(s.upsertUser).
+		Doc("Insert or replace a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Reads(data.User{}).
+		Writes(Success{}))
+	// Modify a user
+	ws.Route(ws.PATCH("/user/{user-id}").To(s.updateUser).
+		Doc("Modify a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Reads(data.UserPatch{}).
+		Writes(Success{}))
 	// Delete a user
 	ws.Route(ws.DELETE("/user/{user-id}").To(s.deleteUser).
 		Doc("Delete a user.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
 		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
 		Writes(Success{}))
+	// Erase a user
+	ws.Route(ws.POST("/user/{user-id}/erasure").To(s.eraseUser).
+		Doc("Erase a user and traces of the user in the cache store and models.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		AllowedMethodsWithoutContentType([]string{http.MethodPost}).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Writes(data.Erasure{}))
+	// Get the erasure of a user
+	ws.Route(ws.GET("/user/{user-id}/erasure").To(s.getErasure).
+		Doc("Get the audit record of erasing a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"user"}).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Writes(data.Erasure{}))
 
 	// Insert an item
 	ws.Route(ws.POST("/item").To(s.insertItem).
@@ -211,6 +274,20 @@ func (s *Server) CreateWebService() *restful.WebService {
 		Doc("Insert items.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"item"}).
 		Reads([]Item{}))
+	// Insert or replace an item
+	ws.Route(ws.PUT("/item/{item-id}").To(s.upsertItem).
+		Doc("Insert or replace an item.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"item"}).
+		Param(ws.PathParameter("item-id", "identifier of the item").DataType("string")).
+		Reads(Item{}).
+		Writes(Success{}))
+	// Modify an item
+	ws.Route(ws.PATCH("/item/{item-id}").To(s.updateItem).
+		Doc("Modify an item. The expire time is removed if it's null.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"item"}).
+		Param(ws.PathParameter("item-id", "identifier of the item").DataType("string")).
+		Reads(data.ItemPatch{}).
+		Writes(Success{}))
 	// Delete item
 	ws.Route(ws.DELETE("/item/{item-id}").To(s.deleteItem).
 		Doc("Delete a item.").
@@ -223,6 +300,14 @@ func (s *Server) CreateWebService() *restful.WebService {
 		Doc("Insert feedback.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"feedback"}).
 		Reads(data.Feedback{}))
+	// Delete feedback
+	ws.Route(ws.DELETE("/feedback").To(s.deleteFeedback).
+		Doc("Delete feedback.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"feedback"}).
+		Param(ws.QueryParameter("feedback-type", "feedback type").DataType("string")).
+		Param(ws.QueryParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("item-id", "identifier of the item").DataType("string")).
+		Writes(Success{}))
 	// Get feedback
 	ws.Route(ws.GET("/feedback").To(s.getFeedback).
 		Doc("Get feedback.").
@@ -257,34 +342,34 @@ func (s *Server) CreateWebService() *restful.WebService {
 
 	// Get matched items by user id
 	ws.Route(ws.GET("/user/{user-id}/match").To(s.getRecommendCache).
-		Doc("get the top list for a user").
+		Doc("get the top list for a user with scores").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
 		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
 		Param(ws.FormParameter("n", "the number of recommendations").DataType("int")).
 		Param(ws.FormParameter("offset", "the offset of list").DataType("int")).
-		Writes([]string{}))
+		Writes([]cache.ScoredItem{}))
 	// Get popular items
 	ws.Route(ws.GET("/popular").To(s.getPopular).
-		Doc("get popular items").
+		Doc("get popular items with scores").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
 		Param(ws.FormParameter("n", "the number of popular items").DataType("int")).
 		Param(ws.FormParameter("offset", "the offset of list").DataType("int")).
-		Writes([]string{}))
+		Writes([]cache.ScoredItem{}))
 	// Get latest items
 	ws.Route(ws.GET("/latest").To(s.getLatest).
-		Doc("get latest items").
+		Doc("get latest items with timestamps as scores").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
 		Param(ws.FormParameter("n", "the number of latest items").DataType("int")).
 		Param(ws.FormParameter("offset", "the offset of list").DataType("int")).
-		Writes([]string{}))
+		Writes([]cache.ScoredItem{}))
 	// Get neighbors
 	ws.Route(ws.GET("/item/{item-id}/neighbors").To(s.getNeighbors).
-		Doc("get neighbors of a item").
+		Doc("get neighbors of a item with similarities as scores").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
 		Param(ws.PathParameter("item-id", "identifier of the item").DataType("string")).
 		Param(ws.FormParameter("n", "the number of neighbors").DataType("int")).
 		Param(ws.FormParameter("offset", "the offset of list").DataType("int")).
-		Writes([]string{}))
+		Writes([]cache.ScoredItem{}))
 
 	/* Rank recommendation */
 
@@ -309,6 +394,7 @@ func parseInt(request *restful.Request, name string, fallback int) (value int, e
 
 // getPopular gets popular items from database.
 func (s *Server) getPopular(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	var n, offset int
 	var err error
 	if n, err = parseInt(request, "n", 10); err != nil {
@@ -320,7 +406,7 @@ func (s *Server) getPopular(request *restful.Request, response *restful.Response
 		return
 	}
 	// Get the popular list
-	items, err := s.CacheStore.GetList(cache.PopularItems, "", n, offset)
+	items, err := s.CacheStore.GetScores(ctx, cache.PopularItems, "", n, offset)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -330,6 +416,7 @@ func (s *Server) getPopular(request *restful.Request, response *restful.Response
 }
 
 func (s *Server) getLatest(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	var n, offset int
 	var err error
 	if n, err = parseInt(request, "n", 10); err != nil {
@@ -341,7 +428,7 @@ func (s *Server) getLatest(request *restful.Request, response *restful.Response)
 		return
 	}
 	// Get the popular list
-	items, err := s.CacheStore.GetList(cache.LatestItems, "", n, offset)
+	items, err := s.CacheStore.GetScores(ctx, cache.LatestItems, "", n, offset)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -352,9 +439,10 @@ func (s *Server) getLatest(request *restful.Request, response *restful.Response)
 
 // get feedback by item-id with feedback type
 func (s *Server) getTypedFeedbackByItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	feedbackType := request.PathParameter("feedback-type")
 	itemId := request.PathParameter("item-id")
-	feedback, err := s.DataStore.GetItemFeedback(feedbackType, itemId)
+	feedback, err := s.DataStore.GetItemFeedback(ctx, feedbackType, itemId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -364,8 +452,9 @@ func (s *Server) getTypedFeedbackByItem(request *restful.Request, response *rest
 
 // get feedback by item-id
 func (s *Server) getFeedbackByItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	itemId := request.PathParameter("item-id")
-	feedback, err := s.DataStore.GetItemFeedback("", itemId)
+	feedback, err := s.DataStore.GetItemFeedback(ctx, "", itemId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -375,6 +464,7 @@ func (s *Server) getFeedbackByItem(request *restful.Request, response *restful.R
 
 // getNeighbors gets neighbors of a item from database.
 func (s *Server) getNeighbors(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// Get item id
 	itemId := request.PathParameter("item-id")
 	// Get the number and offset
@@ -389,7 +479,7 @@ func (s *Server) getNeighbors(request *restful.Request, response *restful.Respon
 		return
 	}
 	// Get recommended items
-	items, err := s.CacheStore.GetList(cache.SimilarItems, itemId, n, offset)
+	items, err := s.CacheStore.GetScores(ctx, cache.SimilarItems, itemId, n, offset)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -400,6 +490,7 @@ func (s *Server) getNeighbors(request *restful.Request, response *restful.Respon
 
 // getRecommendCache gets cached recommended items from database.
 func (s *Server) getRecommendCache(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// Get user id
 	userId := request.PathParameter("user-id")
 	// Get the number and offset
@@ -414,7 +505,7 @@ func (s *Server) getRecommendCache(request *restful.Request, response *restful.R
 		return
 	}
 	// Get recommended items
-	items, err := s.CacheStore.GetList(cache.MatchedItems, userId, n, offset)
+	items, err := s.CacheStore.GetScores(ctx, cache.MatchedItems, userId, n, offset)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -424,6 +515,7 @@ func (s *Server) getRecommendCache(request *restful.Request, response *restful.R
 }
 
 func (s *Server) getRecommend(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	start := time.Now()
 	userId := request.PathParameter("user-id")
 	n, err := parseInt(request, "n", 0)
@@ -432,7 +524,7 @@ func (s *Server) getRecommend(request *restful.Request, response *restful.Respon
 		return
 	}
 	// load feedback
-	userFeedback, err := s.DataStore.GetUserFeedback("", userId)
+	userFeedback, err := s.DataStore.GetUserFeedback(ctx, "", userId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -443,48 +535,55 @@ func (s *Server) getRecommend(request *restful.Request, response *restful.Respon
 	}
 	// load popular
 	candidateItems := make([]string, 0)
-	popularItems, err := s.CacheStore.GetList(cache.PopularItems, "", s.Config.Popular.NumPopular, 0)
+	popularItems, err := s.CacheStore.GetScores(ctx, cache.PopularItems, "", s.Config.Popular.NumPopular, 0)
 	if err != nil {
 		internalServerError(response, err)
 		return
 	}
-	for _, itemId := range popularItems {
+	for _, itemId := range cache.RemoveScores(popularItems) {
 		if !excludeSet.Contain(itemId) {
 			candidateItems = append(candidateItems, itemId)
 			excludeSet.Add(itemId)
 		}
 	}
 	// load latest
-	latestItems, err := s.CacheStore.GetList(cache.LatestItems, "", s.Config.Latest.NumLatest, 0)
+	latestItems, err := s.CacheStore.GetScores(ctx, cache.LatestItems, "", s.Config.Latest.NumLatest, 0)
 	if err != nil {
 		internalServerError(response, err)
 		return
 	}
-	for _, itemId := range latestItems {
+	for _, itemId := range cache.RemoveScores(latestItems) {
 		if !excludeSet.Contain(itemId) {
 			candidateItems = append(candidateItems, itemId)
 			excludeSet.Add(itemId)
 		}
 	}
 	// load matched
-	matchedItems, err := s.CacheStore.GetList(cache.MatchedItems, userId, s.Config.CF.NumCF, 0)
+	matchedItems, err := s.CacheStore.GetScores(ctx, cache.MatchedItems, userId, s.Config.CF.NumCF, 0)
 	if err != nil {
 		internalServerError(response, err)
 		return
 	}
-	for _, itemId := range matchedItems {
+	for _, itemId := range cache.RemoveScores(matchedItems) {
 		if !excludeSet.Contain(itemId) {
 			candidateItems = append(candidateItems, itemId)
 			excludeSet.Add(itemId)
 		}
 	}
 	log.Infof("server: recommend from (#candidate = %v)", len(candidateItems))
-	// collect item features
-	candidateFeaturedItems := make([]data.Item, len(candidateItems))
-	for i, itemId := range candidateItems {
-		candidateFeaturedItems[i], err = s.DataStore.GetItem(itemId)
+	// collect item features, deleted, hidden or expired items are filtered out since cached items might be outdated
+	candidateFeaturedItems := make([]data.Item, 0, len(candidateItems))
+	for _, itemId := range candidateItems {
+		item, err := s.DataStore.GetItem(ctx, itemId)
 		if err != nil {
+			if err.Error() == data.ErrItemNotExist {
+				continue
+			}
 			internalServerError(response, err)
+			return
+		}
+		if item.IsAvailable(start) {
+			candidateFeaturedItems = append(candidateFeaturedItems, item)
 		}
 	}
 	// online predict
@@ -501,24 +600,64 @@ func (s *Server) getRecommend(request *restful.Request, response *restful.Respon
 	ok(response, result)
 }
 
+// Item is the payload of items. Timestamps are parsed from any formats of dates, and missing timestamps are zero.
 type Item struct {
-	ItemId    string
-	Timestamp string
-	Labels    []string
+	ItemId     string
+	Timestamp  string
+	Labels     []string
+	ExpireTime string
+	Hidden     bool
+}
+
+// parseItem parses timestamps of an item from the payload.
+func parseItem(temp Item) (data.Item, error) {
+	item := data.Item{ItemId: temp.ItemId, Labels: temp.Labels, Hidden: temp.Hidden}
+	if temp.Timestamp != "" {
+		timestamp, err := dateparse.ParseAny(temp.Timestamp)
+		if err != nil {
+			return data.Item{}, err
+		}
+		item.Timestamp = timestamp
+	}
+	if temp.ExpireTime != "" {
+		expireTime, err := dateparse.ParseAny(temp.ExpireTime)
+		if err != nil {
+			return data.Item{}, err
+		}
+		item.ExpireTime = &expireTime
+	}
+	return item, nil
 }
 
 type Success struct {
 	RowAffected int
+	// Failures are rows failed in batch insertions.
+	Failures []Failure `json:",omitempty"`
+}
+
+// Failure is a row failed in a batch insertion.
+type Failure struct {
+	Index int
+	Error string
 }
 
 func (s *Server) insertUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	temp := data.User{}
 	// get userInfo from request and put into temp
 	if err := request.ReadEntity(&temp); err != nil {
 		badRequest(response, err)
 		return
 	}
-	if err := s.DataStore.InsertUser(temp); err != nil {
+	// erased users can't be inserted again
+	if erased, err := s.isErased(ctx, temp.UserId); err != nil {
+		internalServerError(response, err)
+		return
+	} else if erased {
+		badRequest(response, fmt.Errorf("user %v has been erased", temp.UserId))
+		return
+	}
+	if err := s.DataStore.InsertUser(ctx, temp); err != nil {
 		internalServerError(response, err)
 		return
 	}
@@ -526,10 +665,11 @@ func (s *Server) insertUser(request *restful.Request, response *restful.Response
 }
 
 func (s *Server) getUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// get user id
 	userId := request.PathParameter("user-id")
 	// get user
-	user, err := s.DataStore.GetUser(userId)
+	user, err := s.DataStore.GetUser(ctx, userId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -538,16 +678,27 @@ func (s *Server) getUser(request *restful.Request, response *restful.Response) {
 }
 
 func (s *Server) insertUsers(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	temp := new([]data.User)
 	// get param from request and put into temp
 	if err := request.ReadEntity(temp); err != nil {
 		badRequest(response, err)
 		return
 	}
+	// erased users can't be inserted again
+	for i, user := range *temp {
+		if erased, err := s.isErased(ctx, user.UserId); err != nil {
+			internalServerError(response, err)
+			return
+		} else if erased {
+			badRequest(response, fmt.Errorf("invalid user at %d (user %v has been erased)", i, user.UserId))
+			return
+		}
+	}
 	var count int
 	// range temp and achieve user
 	for _, user := range *temp {
-		if err := s.DataStore.InsertUser(user); err != nil {
+		if err := s.DataStore.InsertUser(ctx, user); err != nil {
 			internalServerError(response, err)
 			return
 		}
@@ -556,20 +707,64 @@ func (s *Server) insertUsers(request *restful.Request, response *restful.Respons
 	ok(response, Success{RowAffected: count})
 }
 
+// upsertUser inserts a user or replaces the existing one.
+func (s *Server) upsertUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	user := data.User{}
+	if err := request.ReadEntity(&user); err != nil {
+		badRequest(response, err)
+		return
+	}
+	user.UserId = request.PathParameter("user-id")
+	// erased users can't be inserted again
+	if erased, err := s.isErased(ctx, user.UserId); err != nil {
+		internalServerError(response, err)
+		return
+	} else if erased {
+		badRequest(response, fmt.Errorf("user %v has been erased", user.UserId))
+		return
+	}
+	if err := s.DataStore.UpsertUser(ctx, user); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	ok(response, Success{RowAffected: 1})
+}
+
+// updateUser modifies fields of an existing user.
+func (s *Server) updateUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	patch := data.UserPatch{}
+	if err := request.ReadEntity(&patch); err != nil {
+		badRequest(response, err)
+		return
+	}
+	if err := s.DataStore.UpdateUser(ctx, request.PathParameter("user-id"), patch); err != nil {
+		if err.Error() == data.ErrUserNotExist {
+			notFound(response, err)
+		} else {
+			internalServerError(response, err)
+		}
+		return
+	}
+	ok(response, Success{RowAffected: 1})
+}
+
 type UserIterator struct {
 	Cursor string
 	Users  []data.User
 }
 
 func (s *Server) getUsers(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	cursor := request.QueryParameter("cursor")
-	n, err := parseInt(request, "n", 0)
+	n, err := parseInt(request, "n", 100)
 	if err != nil {
 		badRequest(response, err)
 		return
 	}
 	// get all users
-	cursor, users, err := s.DataStore.GetUsers(cursor, n)
+	cursor, users, err := s.DataStore.GetUsers(ctx, cursor, n)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -579,20 +774,89 @@ func (s *Server) getUsers(request *restful.Request, response *restful.Response)
 
 // delete a user by user-id
 func (s *Server) deleteUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// get user-id and put into temp
 	userId := request.PathParameter("user-id")
-	if err := s.DataStore.DeleteUser(userId); err != nil {
+	if err := s.DataStore.DeleteUser(ctx, userId); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	if err := s.modified(ctx); err != nil {
 		internalServerError(response, err)
 		return
 	}
 	ok(response, Success{RowAffected: 1})
 }
 
+// eraseUser removes a user, feedback of the user and matched items of the user. A tombstone is recorded before the
+// erasure and the master is notified to refit models without the user after the erasure.
+func (s *Server) eraseUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	erasure := data.Erasure{UserId: request.PathParameter("user-id"), RequestedAt: time.Now().UTC()}
+	// record a tombstone
+	if err := s.DataStore.PutErasure(ctx, erasure); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	// remove the user and feedback
+	if err := s.DataStore.DeleteUser(ctx, erasure.UserId); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	// remove matched items
+	if err := s.CacheStore.Delete(ctx, cache.MatchedItems, erasure.UserId); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	// notify the master
+	if err := s.CacheStore.SetString(ctx, cache.GlobalMeta, cache.LastErasureTime, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	// record the completion
+	completedAt := time.Now().UTC()
+	erasure.CompletedAt = &completedAt
+	if err := s.DataStore.PutErasure(ctx, erasure); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	log.Infof("server: erased user (user_id = %v)", erasure.UserId)
+	ok(response, erasure)
+}
+
+// getErasure gets the audit record of erasing a user.
+func (s *Server) getErasure(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	userId := request.PathParameter("user-id")
+	erasure, err := s.DataStore.GetErasure(ctx, userId)
+	if err != nil {
+		if err.Error() == data.ErrErasureNotExist {
+			notFound(response, err)
+		} else {
+			internalServerError(response, err)
+		}
+		return
+	}
+	ok(response, erasure)
+}
+
+// isErased returns true if a user has been erased.
+func (s *Server) isErased(ctx context.Context, userId string) (bool, error) {
+	if _, err := s.DataStore.GetErasure(ctx, userId); err != nil {
+		if err.Error() == data.ErrErasureNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // get feedback by user-id with feedback type
 func (s *Server) getTypedFeedbackByUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	feedbackType := request.PathParameter("feedback-type")
 	userId := request.PathParameter("user-id")
-	feedback, err := s.DataStore.GetUserFeedback(feedbackType, userId)
+	feedback, err := s.DataStore.GetUserFeedback(ctx, feedbackType, userId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -602,8 +866,9 @@ func (s *Server) getTypedFeedbackByUser(request *restful.Request, response *rest
 
 // get feedback by user-id
 func (s *Server) getFeedbackByUser(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	userId := request.PathParameter("user-id")
-	feedback, err := s.DataStore.GetUserFeedback("", userId)
+	feedback, err := s.DataStore.GetUserFeedback(ctx, "", userId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -613,6 +878,7 @@ func (s *Server) getFeedbackByUser(request *restful.Request, response *restful.R
 
 // putItems puts items into the database.
 func (s *Server) insertItems(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// Add ratings
 	temp := new([]Item)
 	if err := request.ReadEntity(temp); err != nil {
@@ -623,38 +889,89 @@ func (s *Server) insertItems(request *restful.Request, response *restful.Respons
 	var err error
 	items := make([]data.Item, len(*temp))
 	for i, v := range *temp {
-		items[i].ItemId = v.ItemId
-		items[i].Timestamp, err = dateparse.ParseAny(v.Timestamp)
-		items[i].Labels = v.Labels
-		if err != nil {
+		if items[i], err = parseItem(v); err != nil {
 			badRequest(response, err)
+			return
+		}
+	}
+	// Insert items
+	err = s.DataStore.BatchInsertItem(ctx, items)
+	if lateItems(items) {
+		if err := s.modified(ctx); err != nil {
+			internalServerError(response, err)
+			return
 		}
 	}
-	// Get status before change
+	batchInserted(response, len(items), err)
+}
+
+func (s *Server) insertItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	temp := new(Item)
+	if err := request.ReadEntity(temp); err != nil {
+		badRequest(response, err)
+		return
+	}
+	item, err := parseItem(*temp)
 	if err != nil {
+		badRequest(response, err)
+		return
+	}
+	if err = s.DataStore.InsertItem(ctx, item); err != nil {
 		internalServerError(response, err)
 		return
 	}
-
-	// Insert items
-	var count int
-	for _, item := range items {
-		err = s.DataStore.InsertItem(data.Item{ItemId: item.ItemId, Timestamp: item.Timestamp, Labels: item.Labels})
-		count++
-		if err != nil {
+	if lateItems([]data.Item{item}) {
+		if err := s.modified(ctx); err != nil {
 			internalServerError(response, err)
 			return
 		}
 	}
-	ok(response, Success{RowAffected: count})
+	ok(response, Success{RowAffected: 1})
 }
-func (s *Server) insertItem(request *restful.Request, response *restful.Response) {
-	temp := new(data.Item)
+
+// upsertItem inserts an item or replaces the existing one.
+func (s *Server) upsertItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	temp := new(Item)
 	if err := request.ReadEntity(temp); err != nil {
 		badRequest(response, err)
 		return
 	}
-	if err := s.DataStore.InsertItem(*temp); err != nil {
+	item, err := parseItem(*temp)
+	if err != nil {
+		badRequest(response, err)
+		return
+	}
+	item.ItemId = request.PathParameter("item-id")
+	if err = s.DataStore.UpsertItem(ctx, item); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	if err := s.modified(ctx); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	ok(response, Success{RowAffected: 1})
+}
+
+// updateItem modifies fields of an existing item.
+func (s *Server) updateItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	patch := data.ItemPatch{}
+	if err := request.ReadEntity(&patch); err != nil {
+		badRequest(response, err)
+		return
+	}
+	if err := s.DataStore.UpdateItem(ctx, request.PathParameter("item-id"), patch); err != nil {
+		if err.Error() == data.ErrItemNotExist {
+			notFound(response, err)
+		} else {
+			internalServerError(response, err)
+		}
+		return
+	}
+	if err := s.modified(ctx); err != nil {
 		internalServerError(response, err)
 		return
 	}
@@ -667,13 +984,14 @@ type ItemIterator struct {
 }
 
 func (s *Server) getItems(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	cursor := request.QueryParameter("cursor")
-	n, err := parseInt(request, "n", 0)
+	n, err := parseInt(request, "n", 100)
 	if err != nil {
 		badRequest(response, err)
 		return
 	}
-	cursor, items, err := s.DataStore.GetItems(cursor, n)
+	cursor, items, err := s.DataStore.GetItems(ctx, cursor, n, nil)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -682,10 +1000,11 @@ func (s *Server) getItems(request *restful.Request, response *restful.Response)
 }
 
 func (s *Server) getItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// Get item id
 	itemId := request.PathParameter("item-id")
 	// Get item
-	item, err := s.DataStore.GetItem(itemId)
+	item, err := s.DataStore.GetItem(ctx, itemId)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -694,8 +1013,13 @@ func (s *Server) getItem(request *restful.Request, response *restful.Response) {
 }
 
 func (s *Server) deleteItem(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	itemId := request.PathParameter("item-id")
-	if err := s.DataStore.DeleteItem(itemId); err != nil {
+	if err := s.DataStore.DeleteItem(ctx, itemId); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	if err := s.modified(ctx); err != nil {
 		internalServerError(response, err)
 		return
 	}
@@ -704,26 +1028,97 @@ func (s *Server) deleteItem(request *restful.Request, response *restful.Response
 
 // putFeedback puts new ratings into the database.
 func (s *Server) insertFeedback(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// Add ratings
 	ratings := new([]data.Feedback)
 	if err := request.ReadEntity(ratings); err != nil {
 		badRequest(response, err)
 		return
 	}
-	var err error
+	checked := make(map[string]bool)
+	for i, feedback := range *ratings {
+		if err := data.ValidateFeedbackValue(feedback.Value); err != nil {
+			badRequest(response, fmt.Errorf("invalid feedback at %d (%v)", i, err))
+			return
+		}
+		// erased users can't be inserted again along with feedback
+		if s.Config.Database.AutoInsertUser && !checked[feedback.UserId] {
+			if erased, err := s.isErased(ctx, feedback.UserId); err != nil {
+				internalServerError(response, err)
+				return
+			} else if erased {
+				badRequest(response, fmt.Errorf("invalid feedback at %d (user %v has been erased)", i, feedback.UserId))
+				return
+			}
+			checked[feedback.UserId] = true
+		}
+	}
 	// Insert feedback
-	var count int
-	for _, feedback := range *ratings {
-		err = s.DataStore.InsertFeedback(feedback,
-			s.Config.Database.AutoInsertUser,
-			s.Config.Database.AutoInsertItem)
-		count++
-		if err != nil {
+	insert := s.DataStore.BatchInsertFeedback
+	if s.Config.Database.CountFeedback {
+		insert = s.DataStore.BatchCountFeedback
+	}
+	err := insert(ctx, *ratings,
+		s.Config.Database.AutoInsertUser,
+		s.Config.Database.AutoInsertItem)
+	if lateFeedback(*ratings) {
+		if err := s.modified(ctx); err != nil {
 			internalServerError(response, err)
 			return
 		}
 	}
-	ok(response, Success{RowAffected: count})
+	batchInserted(response, len(*ratings), err)
+}
+
+// deleteFeedback removes a piece of feedback from the database.
+func (s *Server) deleteFeedback(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
+	key := data.FeedbackKey{
+		FeedbackType: request.QueryParameter("feedback-type"),
+		UserId:       request.QueryParameter("user-id"),
+		ItemId:       request.QueryParameter("item-id"),
+	}
+	if key.FeedbackType == "" || key.UserId == "" || key.ItemId == "" {
+		badRequest(response, errors.New("feedback-type, user-id and item-id are required"))
+		return
+	}
+	if err := s.DataStore.DeleteFeedback(ctx, key); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	if err := s.modified(ctx); err != nil {
+		internalServerError(response, err)
+		return
+	}
+	ok(response, Success{RowAffected: 1})
+}
+
+// modified notifies the master that data have been modified in ways incremental pulls miss, so that the master pulls
+// datasets entirely. It must be called after modifications.
+func (s *Server) modified(ctx context.Context) error {
+	return s.CacheStore.SetString(ctx, cache.GlobalMeta, cache.LastModifyTime, time.Now().UTC().Format(time.RFC3339Nano))
+}
+
+// lateItems checks whether some items are older than data.PullWindow, which are missed by incremental pulls.
+func lateItems(items []data.Item) bool {
+	windowBegin := time.Now().Add(-data.PullWindow)
+	for _, item := range items {
+		if item.Timestamp.Before(windowBegin) {
+			return true
+		}
+	}
+	return false
+}
+
+// lateFeedback checks whether some feedback are older than data.PullWindow, which are missed by incremental pulls.
+func lateFeedback(feedback []data.Feedback) bool {
+	windowBegin := time.Now().Add(-data.PullWindow)
+	for _, f := range feedback {
+		if f.Timestamp.Before(windowBegin) {
+			return true
+		}
+	}
+	return false
 }
 
 type FeedbackIterator struct {
@@ -733,15 +1128,16 @@ type FeedbackIterator struct {
 
 // Get feedback
 func (s *Server) getFeedback(request *restful.Request, response *restful.Response) {
+	ctx := request.Request.Context()
 	// Parse parameters
 	feedbackType := request.QueryParameter("feedback-type")
 	cursor := request.QueryParameter("cursor")
-	n, err := parseInt(request, "n", 0)
+	n, err := parseInt(request, "n", 100)
 	if err != nil {
 		badRequest(response, err)
 		return
 	}
-	cursor, feedback, err := s.DataStore.GetFeedback(feedbackType, cursor, n)
+	cursor, feedback, err := s.DataStore.GetFeedback(ctx, feedbackType, cursor, n, nil)
 	if err != nil {
 		internalServerError(response, err)
 		return
@@ -749,6 +1145,21 @@ func (s *Server) getFeedback(request *restful.Request, response *restful.Respons
 	ok(response, FeedbackIterator{Cursor: cursor, Feedback: feedback})
 }
 
+// batchInserted sends the result of inserting n rows in a batch. Failed rows are reported if some rows failed.
+func batchInserted(response *restful.Response, n int, err error) {
+	if batchError, isBatchError := err.(*data.BatchError); isBatchError {
+		failures := make([]Failure, 0, len(batchError.Errors))
+		for _, i := range batchError.Indices() {
+			failures = append(failures, Failure{Index: i, Error: batchError.Errors[i].Error()})
+		}
+		ok(response, Success{RowAffected: n - len(failures), Failures: failures})
+	} else if err != nil {
+		internalServerError(response, err)
+	} else {
+		ok(response, Success{RowAffected: n})
+	}
+}
+
 func badRequest(response *restful.Response, err error) {
 	log.Error("server:", err)
 	if err = response.WriteError(400, err); err != nil {
@@ -756,6 +1167,13 @@ func badRequest(response *restful.Response, err error) {
 	}
 }
 
+func notFound(response *restful.Response, err error) {
+	log.Error("server:", err)
+	if err = response.WriteError(404, err); err != nil {
+		log.Error("server:", err)
+	}
+}
+
 func internalServerError(response *restful.Response, err error) {
 	log.Error("server:", err)
 	if err = response.WriteError(500, err); err != nil {
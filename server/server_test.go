@@ -14,22 +14,24 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
-	"github.com/alicebob/miniredis/v2"
+	"errors"
 	restful "github.com/emicklei/go-restful/v3"
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/rank"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 )
 
 type mockServer struct {
-	dataStoreServer  *miniredis.Miniredis
-	cacheStoreServer *miniredis.Miniredis
+	server           *Server
 	dataStoreClient  data.Database
 	cacheStoreClient cache.Database
 	handler          *restful.Container
@@ -37,25 +39,20 @@ type mockServer struct {
 
 func newMockServer(t *testing.T) *mockServer {
 	s := new(mockServer)
-	// create mock redis server
-	var err error
-	s.dataStoreServer, err = miniredis.Run()
-	assert.Nil(t, err)
-	s.cacheStoreServer, err = miniredis.Run()
-	assert.Nil(t, err)
 	// open database
-	s.dataStoreClient, err = data.Open("redis://" + s.dataStoreServer.Addr())
+	var err error
+	s.dataStoreClient, err = data.Open("memory://", "")
 	assert.Nil(t, err)
-	s.cacheStoreClient, err = cache.Open("redis://" + s.cacheStoreServer.Addr())
+	s.cacheStoreClient, err = cache.Open("memory://", "")
 	assert.Nil(t, err)
 	// create server
-	server := &Server{
+	s.server = &Server{
 		DataStore:  s.dataStoreClient,
 		CacheStore: s.cacheStoreClient,
 		Config:     (*config.Config)(nil).LoadDefaultIfNil(),
 	}
-	server.Config = server.Config.LoadDefaultIfNil()
-	ws := server.CreateWebService()
+	s.server.Config = s.server.Config.LoadDefaultIfNil()
+	ws := s.server.CreateWebService()
 	// create handler
 	s.handler = restful.NewContainer()
 	s.handler.Add(ws)
@@ -65,6 +62,8 @@ func newMockServer(t *testing.T) *mockServer {
 func (s *mockServer) Close(t *testing.T) {
 	err := s.dataStoreClient.Close()
 	assert.Nil(t, err)
+	err = s.cacheStoreClient.Close()
+	assert.Nil(t, err)
 }
 
 func marshal(t *testing.T, v interface{}) string {
@@ -120,6 +119,38 @@ func TestServer_Users(t *testing.T) {
 			Users:  users,
 		})).
 		End()
+	// replace user
+	apitest.New().
+		Handler(s.handler).
+		Put("/user/0").
+		JSON(data.User{Labels: []string{"a"}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	// modify user
+	apitest.New().
+		Handler(s.handler).
+		Patch("/user/0").
+		JSON(`{"Labels": ["b"]}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/user/0").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.User{UserId: "0", Labels: []string{"b"}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Patch("/user/5").
+		JSON(`{"Labels": ["b"]}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
 	apitest.New().
 		Handler(s.handler).
 		Delete("/user/0").
@@ -139,6 +170,7 @@ func TestServer_Items(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
 	// Items
+	expireTime := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
 	items := []data.Item{
 		{
 			ItemId:    "0",
@@ -156,14 +188,16 @@ func TestServer_Items(t *testing.T) {
 			Labels:    []string{"a", "b"},
 		},
 		{
-			ItemId:    "6",
-			Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
-			Labels:    []string{"b"},
+			ItemId:     "6",
+			Timestamp:  time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
+			Labels:     []string{"b"},
+			ExpireTime: &expireTime,
 		},
 		{
 			ItemId:    "8",
 			Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
 			Labels:    []string{"b"},
+			Hidden:    true,
 		},
 	}
 	// insert items
@@ -199,6 +233,87 @@ func TestServer_Items(t *testing.T) {
 			Items:  items,
 		})).
 		End()
+	// replace item
+	apitest.New().
+		Handler(s.handler).
+		Put("/item/0").
+		JSON(data.Item{Timestamp: time.Date(1996, 4, 8, 0, 0, 0, 0, time.UTC), Labels: []string{"c"}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/item/0").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.Item{ItemId: "0", Timestamp: time.Date(1996, 4, 8, 0, 0, 0, 0, time.UTC), Labels: []string{"c"}})).
+		End()
+	// modify item
+	apitest.New().
+		Handler(s.handler).
+		Patch("/item/0").
+		JSON(`{"Labels": ["d", "e"]}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/item/0").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.Item{ItemId: "0", Timestamp: time.Date(1996, 4, 8, 0, 0, 0, 0, time.UTC), Labels: []string{"d", "e"}})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Patch("/item/1").
+		JSON(`{"Labels": ["d", "e"]}`).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	// clear expire time
+	apitest.New().
+		Handler(s.handler).
+		Patch("/item/6").
+		JSON(`{"ExpireTime": null}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/item/6").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.Item{ItemId: "6", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Labels: []string{"b"}})).
+		End()
+	// items are inserted or replaced by the same payload
+	apitest.New().
+		Handler(s.handler).
+		Post("/item").
+		JSON(`{"ItemId": "10", "Timestamp": "1996-03-15", "ExpireTime": "2030-01-01"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Put("/item/12").
+		JSON(`{"Timestamp": "1996-03-15", "ExpireTime": "2030-01-01"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	for _, itemId := range []string{"10", "12"} {
+		apitest.New().
+			Handler(s.handler).
+			Get("/item/" + itemId).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(marshal(t, data.Item{ItemId: itemId, Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), ExpireTime: &expireTime})).
+			End()
+	}
 	// delete item
 	apitest.New().
 		Handler(s.handler).
@@ -221,11 +336,11 @@ func TestServer_Feedback(t *testing.T) {
 	defer s.Close(t)
 	// Insert ret
 	feedback := []data.Feedback{
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "3", ItemId: "6"}},
-		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "4", ItemId: "8"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Value: 1, Count: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "2"}, Value: 1, Count: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "4"}, Value: 1, Count: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "3", ItemId: "6"}, Value: 1, Count: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "4", ItemId: "8"}, Value: 1, Count: 1},
 	}
 	//BatchInsertFeedback
 	apitest.New().
@@ -288,17 +403,158 @@ func TestServer_Feedback(t *testing.T) {
 		Get("/user/2/feedback/click").
 		Expect(t).
 		Status(http.StatusOK).
-		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z"}]`).
+		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z", "Value": 1, "Count": 1}]`).
 		End()
 	apitest.New().
 		Handler(s.handler).
 		Get("/item/4/feedback/click").
 		Expect(t).
 		Status(http.StatusOK).
-		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z"}]`).
+		Body(`[{"FeedbackType":"click", "UserId": "2", "ItemId": "4", "Timestamp":"0001-01-01T00:00:00Z", "Value": 1, "Count": 1}]`).
+		End()
+	// delete feedback
+	apitest.New().
+		Handler(s.handler).
+		Delete("/feedback").
+		QueryParams(map[string]string{
+			"feedback-type": "click",
+			"user-id":       "2",
+			"item-id":       "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/user/2/feedback/click").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`[]`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Delete("/feedback").
+		QueryParams(map[string]string{
+			"feedback-type": "click",
+			"user-id":       "2",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_CountFeedback(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.Config.Database.CountFeedback = true
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "0", ItemId: "0"}, Value: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "0", ItemId: "0"}, Value: 1},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 2}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/user/0/feedback/read").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`[{"FeedbackType":"read", "UserId": "0", "ItemId": "0", "Timestamp":"0001-01-01T00:00:00Z", "Value": 1, "Count": 2}]`).
 		End()
 }
 
+// failedDataStore fails to insert feedback of user "1".
+type failedDataStore struct {
+	data.Database
+}
+
+func (db failedDataStore) BatchInsertFeedback(ctx context.Context, feedback []data.Feedback, insertUser, insertItem bool) error {
+	batchError := &data.BatchError{Errors: make(map[int]error)}
+	for i, f := range feedback {
+		if f.UserId == "1" {
+			batchError.Errors[i] = errors.New("failed to insert feedback")
+		} else if err := db.InsertFeedback(ctx, f, insertUser, insertItem); err != nil {
+			batchError.Errors[i] = err
+		}
+	}
+	return batchError
+}
+
+func TestServer_InsertFeedbackFailure(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.DataStore = failedDataStore{s.dataStoreClient}
+	feedback := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Value: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "0"}, Value: 1},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "0"}, Value: 1},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON(feedback).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 2, "Failures": [{"Index": 1, "Error": "failed to insert feedback"}]}`).
+		End()
+}
+
+func TestServer_InsertInvalidFeedback(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON(`[{"FeedbackType":"click", "UserId": "0", "ItemId": "0"}, {"FeedbackType":"click", "UserId": "1", "ItemId": "0", "Value": -1}]`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	_, feedback, err := s.dataStoreClient.GetFeedback(context.Background(), "click", "", 100, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, feedback)
+}
+
+func TestServer_Modified(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// recent feedback are pulled incrementally
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}, Timestamp: time.Now(), Value: 1}}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	_, err := s.cacheStoreClient.GetString(context.Background(), cache.GlobalMeta, cache.LastModifyTime)
+	assert.Equal(t, cache.ErrObjectNotExist, err.Error())
+	// late feedback are missed by incremental pulls
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Timestamp: time.Now().Add(-2 * data.PullWindow), Value: 1}}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	lateTime, err := s.cacheStoreClient.GetString(context.Background(), cache.GlobalMeta, cache.LastModifyTime)
+	assert.Nil(t, err)
+	// deletions are missed by incremental pulls
+	apitest.New().
+		Handler(s.handler).
+		Delete("/item/0").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	deleteTime, err := s.cacheStoreClient.GetString(context.Background(), cache.GlobalMeta, cache.LastModifyTime)
+	assert.Nil(t, err)
+	assert.NotEqual(t, lateTime, deleteTime)
+}
+
 func TestServer_List(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -316,8 +572,14 @@ func TestServer_List(t *testing.T) {
 
 	for _, operator := range operators {
 		// Put items
-		items := []string{"0", "1", "2", "3", "4"}
-		if err := s.cacheStoreClient.SetList(operator.Prefix, operator.Label, items); err != nil {
+		items := []cache.ScoredItem{
+			{ItemId: "0", Score: 100},
+			{ItemId: "1", Score: 99},
+			{ItemId: "2", Score: 98},
+			{ItemId: "3", Score: 97},
+			{ItemId: "4", Score: 96},
+		}
+		if err := s.cacheStoreClient.SetScores(context.Background(), operator.Prefix, operator.Label, items); err != nil {
 			t.Fatal(err)
 		}
 		apitest.New().
@@ -325,7 +587,7 @@ func TestServer_List(t *testing.T) {
 			Get(operator.Get).
 			Expect(t).
 			Status(http.StatusOK).
-			Body(`["0", "1", "2", "3", "4"]`).
+			Body(marshal(t, items)).
 			End()
 		apitest.New().
 			Handler(s.handler).
@@ -335,7 +597,7 @@ func TestServer_List(t *testing.T) {
 				"offset": "0"}).
 			Expect(t).
 			Status(http.StatusOK).
-			Body(`["0", "1", "2"]`).
+			Body(marshal(t, items[:3])).
 			End()
 		apitest.New().
 			Handler(s.handler).
@@ -345,7 +607,7 @@ func TestServer_List(t *testing.T) {
 				"offset": "1"}).
 			Expect(t).
 			Status(http.StatusOK).
-			Body(`["1", "2", "3"]`).
+			Body(marshal(t, items[1:4])).
 			End()
 		// get empty
 		apitest.New().
@@ -430,3 +692,189 @@ func TestServer_List(t *testing.T) {
 //		Body(marshal(t, items[8:])).
 //		End()
 //}
+
+// mockFactorizationMachine predicts scores of items by their identifiers.
+type mockFactorizationMachine struct {
+	rank.FactorizationMachine
+}
+
+func (m mockFactorizationMachine) Predict(userId, itemId string, labels []string) float32 {
+	score, _ := strconv.Atoi(itemId)
+	return float32(score)
+}
+
+func TestServer_GetRecommend(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.RankModel = mockFactorizationMachine{}
+	// item 0: seen
+	// item 2: hidden
+	// item 3: expired
+	// item 5: deleted
+	expireTime := time.Now().Add(-time.Hour)
+	err := s.dataStoreClient.BatchInsertItem(context.Background(), []data.Item{
+		{ItemId: "0"}, {ItemId: "1"}, {ItemId: "2", Hidden: true}, {ItemId: "3", ExpireTime: &expireTime}, {ItemId: "4"},
+	})
+	assert.Nil(t, err)
+	err = s.dataStoreClient.InsertFeedback(context.Background(), data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"},
+	}, true, false)
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(context.Background(), cache.PopularItems, "", []cache.ScoredItem{{ItemId: "0", Score: 2}, {ItemId: "2", Score: 1}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(context.Background(), cache.LatestItems, "", []cache.ScoredItem{{ItemId: "3", Score: 2}, {ItemId: "1", Score: 1}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(context.Background(), cache.MatchedItems, "0", []cache.ScoredItem{{ItemId: "5", Score: 2}, {ItemId: "4", Score: 1}})
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/recommend/0").
+		QueryParams(map[string]string{"n": "10"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`["4", "1"]`).
+		End()
+}
+
+func TestServer_EraseUser(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	err := s.dataStoreClient.InsertFeedback(context.Background(), data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"},
+	}, true, true)
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(context.Background(), cache.MatchedItems, "0", []cache.ScoredItem{{ItemId: "1", Score: 2}, {ItemId: "2", Score: 1}})
+	assert.Nil(t, err)
+	// no erasure
+	apitest.New().
+		Handler(s.handler).
+		Get("/user/0/erasure").
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+	// erase user
+	apitest.New().
+		Handler(s.handler).
+		Post("/user/0/erasure").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	erasure, err := s.dataStoreClient.GetErasure(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "0", erasure.UserId)
+	assert.NotNil(t, erasure.CompletedAt)
+	apitest.New().
+		Handler(s.handler).
+		Get("/user/0/erasure").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, erasure)).
+		End()
+	// user, feedback and matched items are removed
+	_, err = s.dataStoreClient.GetUser(context.Background(), "0")
+	assert.Equal(t, data.ErrUserNotExist, err.Error())
+	feedback, err := s.dataStoreClient.GetItemFeedback(context.Background(), "", "0")
+	assert.Nil(t, err)
+	assert.Empty(t, feedback)
+	matchedItems, err := s.cacheStoreClient.GetScores(context.Background(), cache.MatchedItems, "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, matchedItems)
+	// the master is notified
+	erasureTime, err := s.cacheStoreClient.GetString(context.Background(), cache.GlobalMeta, cache.LastErasureTime)
+	assert.Nil(t, err)
+	_, err = time.Parse(time.RFC3339Nano, erasureTime)
+	assert.Nil(t, err)
+	// the erased user can't be inserted again
+	apitest.New().
+		Handler(s.handler).
+		Post("/user").
+		JSON(data.User{UserId: "0"}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/users").
+		JSON([]data.User{{UserId: "1"}, {UserId: "0"}}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Put("/user/0").
+		JSON(data.User{}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	s.server.Config.Database.AutoInsertUser = true
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Value: 1}}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	_, err = s.dataStoreClient.GetUser(context.Background(), "0")
+	assert.Equal(t, data.ErrUserNotExist, err.Error())
+	_, err = s.dataStoreClient.GetUser(context.Background(), "1")
+	assert.Equal(t, data.ErrUserNotExist, err.Error())
+	// feedback of erased users are accepted if users aren't inserted automatically
+	s.server.Config.Database.AutoInsertUser = false
+	apitest.New().
+		Handler(s.handler).
+		Post("/feedback").
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Value: 1}}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestServer_Tenant(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// create the server of a tenant
+	s.server.Config.Database.DataStore = "memory://"
+	s.server.Config.Database.CacheStore = "memory://"
+	s.server.Config.Tenants = map[string]*config.TenantConfig{"shop": {}}
+	tenant := s.server.newTenant("shop")
+	tenant.connect()
+	defer tenant.DataStore.Close()
+	defer tenant.CacheStore.Close()
+	s.handler.Add(tenant.CreateWebService())
+	// insert users into the default tenant and the tenant
+	apitest.New().
+		Handler(s.handler).
+		Post("/user").
+		JSON(data.User{UserId: "0"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected":1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/tenant/shop/user").
+		JSON(data.User{UserId: "1"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected":1}`).
+		End()
+	// users are isolated
+	apitest.New().
+		Handler(s.handler).
+		Get("/tenant/shop/user/1").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.User{UserId: "1"})).
+		End()
+	_, err := tenant.DataStore.GetUser(context.Background(), "0")
+	assert.Equal(t, data.ErrUserNotExist, err.Error())
+	_, err = s.dataStoreClient.GetUser(context.Background(), "1")
+	assert.Equal(t, data.ErrUserNotExist, err.Error())
+	// tenant not existed
+	apitest.New().
+		Handler(s.handler).
+		Get("/tenant/none/user/1").
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+}
@@ -14,11 +14,16 @@
 package cache
 
 import (
-	"github.com/go-redis/redis/v8"
+	"context"
 	"github.com/pkg/errors"
+	"github.com/zhenghaoz/gorse/storage/sqlutil"
 	"strings"
+	"time"
 )
 
+// ErrObjectNotExist is the error message of getting an object not existed.
+const ErrObjectNotExist = "object not exist"
+
 const (
 	PopularItems = "popular_items"
 	LatestItems  = "latest_items"
@@ -33,27 +38,98 @@ const (
 	LastFitRankModelTime   = "last_fit_rank_model_time"
 	LatestCFModelVersion   = "latest_match_model_version"
 	LatestRankModelVersion = "latest_rank_model_version"
+	LastErasureTime        = "last_erasure_time"
+	// LastModifyTime is the last time data were modified in ways incremental pulls miss, which are updates, deletions
+	// and insertions of rows older than data.PullWindow.
+	LastModifyTime = "last_modify_time"
 )
 
+// LeaderLock is the lock held by the leader of masters.
+const LeaderLock = "leader"
+
+// ScoredItem is an item with a score, such as popularity, timestamp, similarity or predicted preference.
+type ScoredItem struct {
+	ItemId string
+	Score  float64
+}
+
+// CreateScoredItems zips identifiers and scores of items.
+func CreateScoredItems(itemIds []string, scores []float32) []ScoredItem {
+	items := make([]ScoredItem, len(itemIds))
+	for i := range items {
+		items[i].ItemId = itemIds[i]
+		items[i].Score = float64(scores[i])
+	}
+	return items
+}
+
+// RemoveScores returns identifiers of scored items.
+func RemoveScores(items []ScoredItem) []string {
+	itemIds := make([]string, len(items))
+	for i := range items {
+		itemIds[i] = items[i].ItemId
+	}
+	return itemIds
+}
+
+// Database is the interface of cache stores. Queries are cancelled once ctx is done.
 type Database interface {
 	Close() error
-	SetList(prefix, name string, items []string) error
-	GetList(prefix, name string, n int, offset int) ([]string, error)
-	GetString(prefix, name string) (string, error)
-	SetString(prefix, name string, val string) error
-	GetInt(prefix, name string) (int, error)
-	SetInt(prefix, name string, val int) error
+	SetList(ctx context.Context, prefix, name string, items []string) error
+	GetList(ctx context.Context, prefix, name string, n int, offset int) ([]string, error)
+	// SetScores replaces a scored list. Items in a scored list are sorted by scores in descending order.
+	SetScores(ctx context.Context, prefix, name string, items []ScoredItem) error
+	// GetScores returns n items from the offset of a scored list. All items from the offset are returned if n is 0.
+	GetScores(ctx context.Context, prefix, name string, n int, offset int) ([]ScoredItem, error)
+	// GetString returns a string. ErrObjectNotExist is returned if the string doesn't exist.
+	GetString(ctx context.Context, prefix, name string) (string, error)
+	SetString(ctx context.Context, prefix, name string, val string) error
+	GetInt(ctx context.Context, prefix, name string) (int, error)
+	SetInt(ctx context.Context, prefix, name string, val int) error
+	// Delete removes a list, a scored list or a value. It's a no-op if the key doesn't exist.
+	Delete(ctx context.Context, prefix, name string) error
+	// Lock acquires a lock for an owner, or renews the lock if it's held by the owner. The lock expires after ttl unless
+	// it's renewed. It returns false if the lock is held by another owner.
+	Lock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Unlock releases a lock. It's a no-op if the lock isn't held by the owner.
+	Unlock(ctx context.Context, name, owner string) error
+	// GetLock returns the owner of a lock, which is empty if the lock isn't held.
+	GetLock(ctx context.Context, name string) (string, error)
 }
 
-const redisPrefix = "redis://"
+const (
+	redisPrefix          = "redis://"
+	redissPrefix         = "rediss://"
+	redisSentinelPrefix  = "redis+sentinel://"
+	redissSentinelPrefix = "rediss+sentinel://"
+	redisClusterPrefix   = "redis+cluster://"
+	redissClusterPrefix  = "rediss+cluster://"
+)
+const (
+	mySQLPrefix    = "mysql://"
+	postgresPrefix = "postgres://"
+	sqlitePrefix   = "sqlite://"
+	mongoPrefix    = "mongodb://"
+	memoryPrefix   = "memory://"
+)
 
-// Open a connection to a database.
-func Open(path string) (Database, error) {
-	if strings.HasPrefix(path, redisPrefix) {
-		addr := path[len(redisPrefix):]
-		database := new(Redis)
-		database.client = redis.NewClient(&redis.Options{Addr: addr})
-		return database, nil
+// Open a connection to a database. The path of a memory store is "memory://" followed by an optional snapshot path,
+// and the path of a Redis store is a Redis URL (see Redis). SQL and MongoDB stores are opened by the same paths as data
+// stores, and tables of SQL stores are created once opened.
+// Keys are isolated by the namespace, and the default namespace is empty.
+func Open(path, namespace string) (Database, error) {
+	if isRedisURL(path) {
+		return openRedis(path, namespace)
+	} else if strings.HasPrefix(path, mySQLPrefix) {
+		return openSQL(sqlutil.MySQL, "mysql", path[len(mySQLPrefix):], namespace)
+	} else if strings.HasPrefix(path, postgresPrefix) {
+		return openSQL(sqlutil.Postgres, "postgres", path, namespace)
+	} else if strings.HasPrefix(path, sqlitePrefix) {
+		return openSQL(sqlutil.SQLite, "sqlite", path[len(sqlitePrefix):], namespace)
+	} else if strings.HasPrefix(path, mongoPrefix) {
+		return openMongo(path, namespace)
+	} else if strings.HasPrefix(path, memoryPrefix) {
+		return openMemory(path[len(memoryPrefix):], namespace)
 	}
 	return nil, errors.Errorf("Unknown database: %s", path)
 }
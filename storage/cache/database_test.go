@@ -14,33 +14,36 @@
 package cache
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func testMeta(t *testing.T, db Database) {
 	// Set meta string
-	if err := db.SetString("meta", "1", "2"); err != nil {
+	if err := db.SetString(context.Background(), "meta", "1", "2"); err != nil {
 		t.Fatal(err)
 	}
 	// Get meta string
-	value, err := db.GetString("meta", "1")
+	value, err := db.GetString(context.Background(), "meta", "1")
 	if err != nil {
 		t.Fatal(err)
 	}
 	assert.Equal(t, "2", value)
 	// Get meta not existed
-	value, err = db.GetString("meta", "NULL")
+	value, err = db.GetString(context.Background(), "meta", "NULL")
 	if err == nil {
 		t.Fatal(err)
 	}
+	assert.Equal(t, ErrObjectNotExist, err.Error())
 	assert.Equal(t, "", value)
 	// Set meta int
-	if err = db.SetInt("meta", "1", 2); err != nil {
+	if err = db.SetInt(context.Background(), "meta", "1", 2); err != nil {
 		t.Fatal(err)
 	}
 	// Get meta int
-	if value, err := db.GetInt("meta", "1"); err != nil {
+	if value, err := db.GetInt(context.Background(), "meta", "1"); err != nil {
 		t.Fatal(err)
 	} else {
 		assert.Equal(t, 2, value)
@@ -50,29 +53,155 @@ func testMeta(t *testing.T, db Database) {
 func testList(t *testing.T, db Database) {
 	// Put items
 	items := []string{"0", "1", "2", "3", "4"}
-	err := db.SetList("list", "0", items)
+	err := db.SetList(context.Background(), "list", "0", items)
 	assert.Nil(t, err)
 	// Get items
-	totalItems, err := db.GetList("list", "0", 0, 0)
+	totalItems, err := db.GetList(context.Background(), "list", "0", 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, items, totalItems)
 	// Get n items
-	headItems, err := db.GetList("list", "0", 3, 0)
+	headItems, err := db.GetList(context.Background(), "list", "0", 3, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, items[:3], headItems)
 	// Get n items with offset
-	offsetItems, err := db.GetList("list", "0", 3, 1)
+	offsetItems, err := db.GetList(context.Background(), "list", "0", 3, 1)
 	assert.Nil(t, err)
 	assert.Equal(t, items[1:4], offsetItems)
 	// Get empty
-	noItems, err := db.GetList("list", "1", 0, 0)
+	noItems, err := db.GetList(context.Background(), "list", "1", 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(noItems))
 	// test overwrite
 	overwriteItems := []string{"10", "11", "12", "13", "14"}
-	err = db.SetList("list", "0", overwriteItems)
+	err = db.SetList(context.Background(), "list", "0", overwriteItems)
 	assert.Nil(t, err)
-	totalItems, err = db.GetList("list", "0", 0, 0)
+	totalItems, err = db.GetList(context.Background(), "list", "0", 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, overwriteItems, totalItems)
 }
+
+func testScores(t *testing.T, db Database) {
+	// Put items
+	items := []ScoredItem{{"0", 0}, {"1", 1.1}, {"2", 2.2}, {"3", 3.3}, {"4", 4.4}}
+	err := db.SetScores(context.Background(), "scores", "0", items)
+	assert.Nil(t, err)
+	// Get items sorted by scores
+	totalItems, err := db.GetScores(context.Background(), "scores", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredItem{{"4", 4.4}, {"3", 3.3}, {"2", 2.2}, {"1", 1.1}, {"0", 0}}, totalItems)
+	// Get n items with offset
+	offsetItems, err := db.GetScores(context.Background(), "scores", "0", 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredItem{{"3", 3.3}, {"2", 2.2}, {"1", 1.1}}, offsetItems)
+	// Get items from offset
+	tailItems, err := db.GetScores(context.Background(), "scores", "0", 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredItem{{"1", 1.1}, {"0", 0}}, tailItems)
+	// Get empty
+	noItems, err := db.GetScores(context.Background(), "scores", "1", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, noItems)
+	// test overwrite
+	err = db.SetScores(context.Background(), "scores", "0", []ScoredItem{{"10", 10}})
+	assert.Nil(t, err)
+	totalItems, err = db.GetScores(context.Background(), "scores", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredItem{{"10", 10}}, totalItems)
+}
+
+func testDelete(t *testing.T, db Database) {
+	err := db.SetList(context.Background(), "list", "0", []string{"0", "1"})
+	assert.Nil(t, err)
+	err = db.SetScores(context.Background(), "scores", "0", []ScoredItem{{"0", 0}})
+	assert.Nil(t, err)
+	err = db.SetString(context.Background(), "meta", "0", "a")
+	assert.Nil(t, err)
+	// delete list
+	err = db.Delete(context.Background(), "list", "0")
+	assert.Nil(t, err)
+	items, err := db.GetList(context.Background(), "list", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+	// delete scored list
+	err = db.Delete(context.Background(), "scores", "0")
+	assert.Nil(t, err)
+	scores, err := db.GetScores(context.Background(), "scores", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, scores)
+	// delete string
+	err = db.Delete(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	_, err = db.GetString(context.Background(), "meta", "0")
+	assert.Equal(t, ErrObjectNotExist, err.Error())
+	// delete key not existed
+	err = db.Delete(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+}
+
+// testLock tests locks. Time elapses by sleep, which is replaced for stores not expiring keys by the clock.
+func testLock(t *testing.T, db Database, sleep func(time.Duration)) {
+	ctx := context.Background()
+	// acquire lock
+	acquired, err := db.Lock(ctx, "lock", "a", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	owner, err := db.GetLock(ctx, "lock")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", owner)
+	// lock held by another owner
+	acquired, err = db.Lock(ctx, "lock", "b", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	// renew lock
+	acquired, err = db.Lock(ctx, "lock", "a", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	// unlock by another owner
+	err = db.Unlock(ctx, "lock", "b")
+	assert.Nil(t, err)
+	owner, err = db.GetLock(ctx, "lock")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", owner)
+	// unlock
+	err = db.Unlock(ctx, "lock", "a")
+	assert.Nil(t, err)
+	owner, err = db.GetLock(ctx, "lock")
+	assert.Nil(t, err)
+	assert.Equal(t, "", owner)
+	// lock expired
+	acquired, err = db.Lock(ctx, "lock", "a", 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	sleep(200 * time.Millisecond)
+	owner, err = db.GetLock(ctx, "lock")
+	assert.Nil(t, err)
+	assert.Equal(t, "", owner)
+	acquired, err = db.Lock(ctx, "lock", "b", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+func testNamespace(t *testing.T, db, tenantDB Database) {
+	err := db.SetList(context.Background(), "list", "0", []string{"0", "1"})
+	assert.Nil(t, err)
+	err = db.SetString(context.Background(), "meta", "0", "a")
+	assert.Nil(t, err)
+	err = tenantDB.SetString(context.Background(), "meta", "0", "b")
+	assert.Nil(t, err)
+	// objects are isolated
+	items, err := tenantDB.GetList(context.Background(), "list", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+	val, err := db.GetString(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+	val, err = tenantDB.GetString(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", val)
+	// delete objects in a namespace
+	err = tenantDB.Delete(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	val, err = db.GetString(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+}
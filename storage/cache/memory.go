@@ -0,0 +1,271 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zhenghaoz/gorse/base"
+)
+
+// memoryStoreKey identifies a memory store by its snapshot path and its namespace.
+type memoryStoreKey struct {
+	snapshot  string
+	namespace string
+}
+
+// memoryStores are opened memory stores.
+var memoryStores = struct {
+	sync.Mutex
+	stores map[memoryStoreKey]*Memory
+}{stores: make(map[memoryStoreKey]*Memory)}
+
+// Memory is a cache store in memory. Memory stores opened with the same snapshot path and the same namespace share data
+// in a process. If the snapshot path isn't empty, data are loaded from the snapshot once opened and saved to the
+// snapshot once the last reference is closed.
+type Memory struct {
+	mutex    sync.RWMutex
+	key      memoryStoreKey
+	snapshot string
+	refs     int
+	lists    map[string][]string
+	scores   map[string][]ScoredItem
+	strings  map[string]string
+	// locks aren't saved to the snapshot.
+	locks map[string]memoryLock
+}
+
+// memoryLock is a lock held by an owner until it expires.
+type memoryLock struct {
+	owner    string
+	expireAt time.Time
+}
+
+// memorySnapshot is the content of a snapshot of a memory store.
+type memorySnapshot struct {
+	Lists   map[string][]string
+	Scores  map[string][]ScoredItem
+	Strings map[string]string
+}
+
+// openMemory opens a memory store. The snapshot of a namespace is saved to the snapshot path suffixed by the namespace.
+func openMemory(snapshot, namespace string) (*Memory, error) {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	key := memoryStoreKey{snapshot: snapshot, namespace: namespace}
+	if db, exist := memoryStores.stores[key]; exist {
+		db.refs++
+		return db, nil
+	}
+	if snapshot != "" && namespace != "" {
+		snapshot += "." + namespace
+	}
+	db := &Memory{
+		key:      key,
+		snapshot: snapshot,
+		refs:     1,
+		lists:    make(map[string][]string),
+		scores:   make(map[string][]ScoredItem),
+		strings:  make(map[string]string),
+		locks:    make(map[string]memoryLock),
+	}
+	if snapshot != "" {
+		var data memorySnapshot
+		if err := base.ReadGob(snapshot, &data); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for key, list := range data.Lists {
+			db.lists[key] = list
+		}
+		for key, list := range data.Scores {
+			db.scores[key] = list
+		}
+		for key, val := range data.Strings {
+			db.strings[key] = val
+		}
+	}
+	memoryStores.stores[key] = db
+	return db, nil
+}
+
+// Close releases a reference to the memory store. The memory store is saved to its snapshot and discarded once the
+// last reference is released.
+func (db *Memory) Close() error {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	if db.refs--; db.refs > 0 {
+		return nil
+	}
+	delete(memoryStores.stores, db.key)
+	if db.snapshot == "" {
+		return nil
+	}
+	return db.Snapshot()
+}
+
+// Snapshot saves the memory store to its snapshot.
+func (db *Memory) Snapshot() error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return base.WriteGob(db.snapshot, memorySnapshot{Lists: db.lists, Scores: db.scores, Strings: db.strings})
+}
+
+func (db *Memory) SetList(ctx context.Context, prefix, name string, items []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.lists[prefix+"/"+name] = append([]string{}, items...)
+	return nil
+}
+
+func (db *Memory) GetList(ctx context.Context, prefix, name string, n int, offset int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	list := db.lists[prefix+"/"+name]
+	if offset > len(list) {
+		offset = len(list)
+	}
+	end := len(list)
+	if n > 0 && offset+n < end {
+		end = offset + n
+	}
+	return append([]string{}, list[offset:end]...), nil
+}
+
+func (db *Memory) SetScores(ctx context.Context, prefix, name string, items []ScoredItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	list := append([]ScoredItem{}, items...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.scores[prefix+"/"+name] = list
+	return nil
+}
+
+func (db *Memory) GetScores(ctx context.Context, prefix, name string, n int, offset int) ([]ScoredItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	list := db.scores[prefix+"/"+name]
+	if offset > len(list) {
+		offset = len(list)
+	}
+	end := len(list)
+	if n > 0 && offset+n < end {
+		end = offset + n
+	}
+	return append([]ScoredItem{}, list[offset:end]...), nil
+}
+
+func (db *Memory) GetString(ctx context.Context, prefix, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	val, exist := db.strings[prefix+"/"+name]
+	if !exist {
+		return "", errors.New(ErrObjectNotExist)
+	}
+	return val, nil
+}
+
+func (db *Memory) SetString(ctx context.Context, prefix, name string, val string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.strings[prefix+"/"+name] = val
+	return nil
+}
+
+func (db *Memory) GetInt(ctx context.Context, prefix, name string) (int, error) {
+	val, err := db.GetString(ctx, prefix, name)
+	if err != nil {
+		return -1, nil
+	}
+	return strconv.Atoi(val)
+}
+
+func (db *Memory) SetInt(ctx context.Context, prefix, name string, val int) error {
+	return db.SetString(ctx, prefix, name, strconv.Itoa(val))
+}
+
+func (db *Memory) Delete(ctx context.Context, prefix, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.lists, prefix+"/"+name)
+	delete(db.scores, prefix+"/"+name)
+	delete(db.strings, prefix+"/"+name)
+	return nil
+}
+
+func (db *Memory) Lock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	now := time.Now()
+	if lock, exist := db.locks[name]; exist && lock.owner != owner && lock.expireAt.After(now) {
+		return false, nil
+	}
+	db.locks[name] = memoryLock{owner: owner, expireAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (db *Memory) Unlock(ctx context.Context, name, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if lock, exist := db.locks[name]; exist && lock.owner == owner {
+		delete(db.locks, name)
+	}
+	return nil
+}
+
+func (db *Memory) GetLock(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	if lock, exist := db.locks[name]; exist && lock.expireAt.After(time.Now()) {
+		return lock.owner, nil
+	}
+	return "", nil
+}
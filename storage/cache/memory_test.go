@@ -0,0 +1,123 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testMemory struct {
+	Database
+}
+
+func newTestMemory(t *testing.T) *testMemory {
+	var err error
+	db := new(testMemory)
+	db.Database, err = Open(memoryPrefix, "")
+	assert.Nil(t, err)
+	return db
+}
+
+func (db *testMemory) Close(t *testing.T) {
+	err := db.Database.Close()
+	assert.Nil(t, err)
+}
+
+func TestMemory_Meta(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close(t)
+	testMeta(t, db.Database)
+}
+
+func TestMemory_List(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close(t)
+	testList(t, db.Database)
+}
+
+func TestMemory_Scores(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close(t)
+	testScores(t, db.Database)
+}
+
+func TestMemory_Delete(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close(t)
+	testDelete(t, db.Database)
+}
+
+func TestMemory_Lock(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close(t)
+	testLock(t, db.Database, time.Sleep)
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := memoryPrefix + filepath.Join(dir, "snapshot")
+	// insert data
+	db, err := Open(path, "")
+	assert.Nil(t, err)
+	err = db.SetList(context.Background(), "list", "0", []string{"0", "1", "2"})
+	assert.Nil(t, err)
+	err = db.SetScores(context.Background(), "scores", "0", []ScoredItem{{"0", 1}})
+	assert.Nil(t, err)
+	err = db.SetString(context.Background(), "meta", "0", "a")
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	// load data from snapshot
+	db, err = Open(path, "")
+	assert.Nil(t, err)
+	defer db.Close()
+	list, err := db.GetList(context.Background(), "list", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0", "1", "2"}, list)
+	scores, err := db.GetScores(context.Background(), "scores", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []ScoredItem{{"0", 1}}, scores)
+	val, err := db.GetString(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+	// the snapshot of a namespace is separated
+	tenantDB, err := Open(path, "tenant")
+	assert.Nil(t, err)
+	err = tenantDB.SetString(context.Background(), "meta", "0", "b")
+	assert.Nil(t, err)
+	err = tenantDB.Close()
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "snapshot.tenant"))
+	assert.Nil(t, err)
+	val, err = db.GetString(context.Background(), "meta", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+}
+
+func TestMemory_Namespace(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close(t)
+	tenantDB, err := Open(memoryPrefix, "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	testNamespace(t, db.Database, tenantDB)
+}
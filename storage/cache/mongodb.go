@@ -0,0 +1,208 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// MongoDB is a cache store in MongoDB. A list or a scored list is stored as a document with an ordered array of items,
+// which is replaced as a whole without transactions. Strings are stored as key/value documents, and locks are stored as
+// documents of owners and expire times.
+type MongoDB struct {
+	client *mongo.Client
+	dbName string
+	// namespace prefixes names of collections.
+	namespace string
+}
+
+// openMongo opens a MongoDB cache store. The database is the one in the connection string.
+func openMongo(path, namespace string) (*MongoDB, error) {
+	cs, err := connstring.ParseAndValidate(path)
+	if err != nil {
+		return nil, err
+	}
+	database := &MongoDB{dbName: cs.Database, namespace: namespace}
+	if database.client, err = mongo.Connect(context.Background(), options.Client().ApplyURI(path)); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// collection returns a collection in the namespace.
+func (db *MongoDB) collection(name string) *mongo.Collection {
+	if db.namespace != "" {
+		name = db.namespace + "_" + name
+	}
+	return db.client.Database(db.dbName).Collection(name)
+}
+
+func (db *MongoDB) Close() error {
+	return db.client.Disconnect(context.Background())
+}
+
+func (db *MongoDB) SetList(ctx context.Context, prefix, name string, items []string) error {
+	return db.replace(ctx, "cache_lists", prefix+"/"+name, len(items), items)
+}
+
+func (db *MongoDB) GetList(ctx context.Context, prefix, name string, n int, offset int) ([]string, error) {
+	var doc struct {
+		Items []string `bson:"items"`
+	}
+	if err := db.slice(ctx, "cache_lists", prefix+"/"+name, n, offset, &doc); err != nil {
+		return nil, err
+	}
+	return append([]string{}, doc.Items...), nil
+}
+
+// SetScores replaces a scored list. Items are sorted by scores before stored.
+func (db *MongoDB) SetScores(ctx context.Context, prefix, name string, items []ScoredItem) error {
+	list := append([]ScoredItem{}, items...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	return db.replace(ctx, "cache_scores", prefix+"/"+name, len(list), list)
+}
+
+func (db *MongoDB) GetScores(ctx context.Context, prefix, name string, n int, offset int) ([]ScoredItem, error) {
+	var doc struct {
+		Items []ScoredItem `bson:"items"`
+	}
+	if err := db.slice(ctx, "cache_scores", prefix+"/"+name, n, offset, &doc); err != nil {
+		return nil, err
+	}
+	return append([]ScoredItem{}, doc.Items...), nil
+}
+
+// replace replaces the document of a list of n items by a single write. The document is removed if the list is empty.
+func (db *MongoDB) replace(ctx context.Context, collection, key string, n int, items interface{}) error {
+	c := db.collection(collection)
+	if n == 0 {
+		_, err := c.DeleteOne(ctx, bson.M{"_id": key})
+		return err
+	}
+	_, err := c.ReplaceOne(ctx, bson.M{"_id": key}, bson.M{"_id": key, "items": items}, options.Replace().SetUpsert(true))
+	return err
+}
+
+// slice decodes n items from the offset of a list to doc. All items from the offset are decoded if n is 0. Nothing is
+// decoded if the list doesn't exist.
+func (db *MongoDB) slice(ctx context.Context, collection, key string, n, offset int, doc interface{}) error {
+	if n <= 0 {
+		n = math.MaxInt32
+	}
+	opt := options.FindOne().SetProjection(bson.M{"items": bson.M{"$slice": bson.A{offset, n}}})
+	err := db.collection(collection).FindOne(ctx, bson.M{"_id": key}, opt).Decode(doc)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	return err
+}
+
+func (db *MongoDB) GetString(ctx context.Context, prefix, name string) (string, error) {
+	var doc struct {
+		Value string `bson:"value"`
+	}
+	err := db.collection("cache_strings").FindOne(ctx, bson.M{"_id": prefix + "/" + name}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return "", errors.New(ErrObjectNotExist)
+	} else if err != nil {
+		return "", err
+	}
+	return doc.Value, nil
+}
+
+func (db *MongoDB) SetString(ctx context.Context, prefix, name string, val string) error {
+	_, err := db.collection("cache_strings").UpdateOne(ctx, bson.M{"_id": prefix + "/" + name},
+		bson.M{"$set": bson.M{"value": val}}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (db *MongoDB) GetInt(ctx context.Context, prefix, name string) (int, error) {
+	val, err := db.GetString(ctx, prefix, name)
+	if err != nil {
+		return -1, nil
+	}
+	return strconv.Atoi(val)
+}
+
+func (db *MongoDB) SetInt(ctx context.Context, prefix, name string, val int) error {
+	return db.SetString(ctx, prefix, name, strconv.Itoa(val))
+}
+
+func (db *MongoDB) Delete(ctx context.Context, prefix, name string) error {
+	key := prefix + "/" + name
+	for _, collection := range []string{"cache_lists", "cache_scores", "cache_strings"} {
+		if _, err := db.collection(collection).DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lock acquires or renews a lock by an upsert matching the lock held by the owner or expired. If the lock is held by
+// another owner, the upsert fails since the identifier of the lock is duplicated.
+func (db *MongoDB) Lock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.M{"_id": name, "$or": bson.A{bson.M{"owner": owner}, bson.M{"expire_at": bson.M{"$lt": now}}}}
+	update := bson.M{"$set": bson.M{"owner": owner, "expire_at": now.Add(ttl)}}
+	_, err := db.collection("cache_locks").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if isDuplicateKey(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (db *MongoDB) Unlock(ctx context.Context, name, owner string) error {
+	_, err := db.collection("cache_locks").DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	return err
+}
+
+func (db *MongoDB) GetLock(ctx context.Context, name string) (string, error) {
+	var doc struct {
+		Owner string `bson:"owner"`
+	}
+	err := db.collection("cache_locks").FindOne(ctx, bson.M{"_id": name, "expire_at": bson.M{"$gte": time.Now()}}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return doc.Owner, nil
+}
+
+// isDuplicateKey checks whether an error is caused by a duplicated key.
+func isDuplicateKey(err error) bool {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	mongoUri string
+)
+
+func init() {
+	// get environment variables
+	env := func(key, defaultValue string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+	mongoUri = env("MONGO_URI", "mongodb://127.0.0.1:27017")
+}
+
+type testMongoDatabase struct {
+	Database
+}
+
+func newTestMongoDatabase(t *testing.T, dbName string) *testMongoDatabase {
+	database := new(testMongoDatabase)
+	var err error
+	// connect database
+	database.Database, err = Open(mongoUri, "")
+	assert.Nil(t, err)
+	// drop existed database
+	dbName = "gorse_cache_" + dbName
+	mongoDatabase, ok := database.Database.(*MongoDB)
+	assert.True(t, ok)
+	err = mongoDatabase.client.Database(dbName).Drop(context.Background())
+	assert.Nil(t, err)
+	mongoDatabase.dbName = dbName
+	return database
+}
+
+func (db *testMongoDatabase) Close(t *testing.T) {
+	err := db.Database.Close()
+	assert.Nil(t, err)
+}
+
+func TestMongoDatabase_Meta(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Meta")
+	defer db.Close(t)
+	testMeta(t, db.Database)
+}
+
+func TestMongoDatabase_List(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_List")
+	defer db.Close(t)
+	testList(t, db.Database)
+}
+
+func TestMongoDatabase_Scores(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Scores")
+	defer db.Close(t)
+	testScores(t, db.Database)
+}
+
+func TestMongoDatabase_Delete(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Delete")
+	defer db.Close(t)
+	testDelete(t, db.Database)
+}
+
+func TestMongoDatabase_Lock(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Lock")
+	defer db.Close(t)
+	testLock(t, db.Database, time.Sleep)
+}
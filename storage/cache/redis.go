@@ -15,38 +15,285 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// redisNil is redis.Nil, which is shadowed by receivers of Redis.
+var redisNil = redis.Nil
+
+// redisPipeliner and redisZ are redis.Pipeliner and redis.Z, which are shadowed by receivers of Redis.
+type redisPipeliner = redis.Pipeliner
+type redisZ = redis.Z
+
+// redisLockScript acquires a lock (KEYS[1]) for an owner (ARGV[1]) or renews the lock held by the owner, with a ttl in
+// milliseconds (ARGV[2]).
+var redisLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// redisUnlockScript releases a lock (KEYS[1]) if it's held by an owner (ARGV[1]).
+var redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Redis is a cache store in Redis. A Redis cache store is opened by one of following URLs:
+//
+//	redis[s]://[[user]:password@]host[:port][/db]
+//	redis[s]+sentinel://[[user]:password@]host[:port][,host[:port]...]/master[/db][?sentinel_password=password]
+//	redis[s]+cluster://[[user]:password@]host[:port][,host[:port]...]
+//
+// The "rediss" schemes connect to Redis by TLS. A Sentinel URL lists addresses of sentinels and the name of the
+// monitored master, while a Cluster URL lists addresses of seed nodes.
 type Redis struct {
-	client *redis.Client
+	client redis.UniversalClient
+	// namespace prefixes keys.
+	namespace string
+}
+
+// key returns the key of an object in the namespace.
+func (redis *Redis) key(prefix, name string) string {
+	if redis.namespace == "" {
+		return prefix + "/" + name
+	}
+	return redis.namespace + ":" + prefix + "/" + name
+}
+
+// redisOptions are options parsed from a Redis URL.
+type redisOptions struct {
+	redis.UniversalOptions
+	cluster bool
+}
+
+// openRedis opens a Redis cache store by an URL.
+func openRedis(path, namespace string) (*Redis, error) {
+	opts, err := parseRedisURL(path)
+	if err != nil {
+		return nil, err
+	}
+	database := new(Redis)
+	if opts.cluster {
+		database.client = redis.NewClusterClient(opts.Cluster())
+	} else if opts.MasterName != "" {
+		database.client = redis.NewFailoverClient(opts.Failover())
+	} else {
+		database.client = redis.NewClient(opts.Simple())
+	}
+	database.namespace = namespace
+	return database, nil
+}
+
+// isRedisURL checks whether a path is a Redis URL.
+func isRedisURL(path string) bool {
+	for _, prefix := range []string{redisPrefix, redissPrefix, redisSentinelPrefix, redissSentinelPrefix,
+		redisClusterPrefix, redissClusterPrefix} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRedisURL parses a Redis URL to options.
+func parseRedisURL(path string) (*redisOptions, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	opts := new(redisOptions)
+	scheme := strings.SplitN(u.Scheme, "+", 2)
+	switch scheme[0] {
+	case "redis":
+	case "rediss":
+		opts.TLSConfig = &tls.Config{}
+	default:
+		return nil, fmt.Errorf("invalid redis URL scheme: %s", u.Scheme)
+	}
+	mode := ""
+	if len(scheme) > 1 {
+		mode = scheme[1]
+	}
+	// parse user and password
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	// parse addresses
+	for _, addr := range strings.Split(u.Host, ",") {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "6379"
+			if mode == "sentinel" {
+				port = "26379"
+			}
+		}
+		opts.Addrs = append(opts.Addrs, net.JoinHostPort(host, port))
+	}
+	if opts.TLSConfig != nil && len(opts.Addrs) == 1 {
+		opts.TLSConfig.ServerName, _, _ = net.SplitHostPort(opts.Addrs[0])
+	}
+	// parse master name and database
+	fields := strings.FieldsFunc(u.Path, func(r rune) bool {
+		return r == '/'
+	})
+	switch mode {
+	case "":
+		if len(opts.Addrs) > 1 {
+			return nil, fmt.Errorf("multiple redis addresses without sentinel or cluster: %s", u.Host)
+		}
+	case "sentinel":
+		if len(fields) == 0 {
+			return nil, errors.New("redis sentinel master name is required")
+		}
+		opts.MasterName, fields = fields[0], fields[1:]
+		opts.SentinelPassword = u.Query().Get("sentinel_password")
+	case "cluster":
+		if len(fields) > 0 {
+			return nil, fmt.Errorf("invalid redis cluster URL path: %s", u.Path)
+		}
+		opts.cluster = true
+	default:
+		return nil, fmt.Errorf("invalid redis URL scheme: %s", u.Scheme)
+	}
+	switch len(fields) {
+	case 0:
+	case 1:
+		if opts.DB, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid redis database number: %s", fields[0])
+		}
+	default:
+		return nil, fmt.Errorf("invalid redis URL path: %s", u.Path)
+	}
+	return opts, nil
 }
 
 func (redis *Redis) Close() error {
 	return redis.client.Close()
 }
 
-func (redis *Redis) SetList(prefix, name string, items []string) error {
-	var ctx = context.Background()
-	key := prefix + "/" + name
-	err := redis.client.Del(ctx, key).Err()
+// SetList replaces a list atomically. Items are pushed to a temporary key in bulk and the temporary key is renamed to
+// the list in a transaction, so that readers never see a partially written list.
+func (redis *Redis) SetList(ctx context.Context, prefix, name string, items []string) error {
+	key := redis.key(prefix, name)
+	if len(items) == 0 {
+		return redis.client.Del(ctx, key).Err()
+	}
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		values[i] = item
+	}
+	return redis.replace(ctx, key, func(pipe redisPipeliner, key string) {
+		pipe.RPush(ctx, key, values...)
+	})
+}
+
+// SetScores replaces a scored list atomically by a sorted set. Items are added to a temporary key in bulk and the
+// temporary key is renamed to the scored list in a transaction, so that readers never see a partially written list.
+func (redis *Redis) SetScores(ctx context.Context, prefix, name string, items []ScoredItem) error {
+	key := redis.key(prefix, name)
+	if len(items) == 0 {
+		return redis.client.Del(ctx, key).Err()
+	}
+	members := make([]*redisZ, len(items))
+	for i, item := range items {
+		members[i] = &redisZ{Member: item.ItemId, Score: item.Score}
+	}
+	return redis.replace(ctx, key, func(pipe redisPipeliner, key string) {
+		pipe.ZAdd(ctx, key, members...)
+	})
+}
+
+func (redis *Redis) GetScores(ctx context.Context, prefix, name string, n int, offset int) ([]ScoredItem, error) {
+	stop := int64(-1)
+	if n > 0 {
+		stop = int64(n + offset - 1)
+	}
+	members, err := redis.client.ZRevRangeWithScores(ctx, redis.key(prefix, name), int64(offset), stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]ScoredItem, len(members))
+	for i, member := range members {
+		items[i].ItemId = member.Member.(string)
+		items[i].Score = member.Score
+	}
+	return items, nil
+}
+
+// replace replaces the value of a key in a transaction. The value is written to a temporary key by write and then the
+// temporary key is renamed to the key. If there is no temporary key in the same hash slot, the key is deleted and
+// written directly instead.
+func (redis *Redis) replace(ctx context.Context, key string, write func(pipe redisPipeliner, key string)) error {
+	temp, ok, err := tempKey(key)
 	if err != nil {
 		return err
 	}
-	for _, itemId := range items {
-		err = redis.client.RPush(ctx, key, itemId).Err()
-		if err != nil {
-			return err
+	_, err = redis.client.TxPipelined(ctx, func(pipe redisPipeliner) error {
+		if !ok {
+			pipe.Del(ctx, key)
+			write(pipe, key)
+			return nil
 		}
+		write(pipe, temp)
+		pipe.Rename(ctx, temp, key)
+		return nil
+	})
+	return err
+}
+
+// tempKey returns a random temporary key for a key. The temporary key is hash tagged by the hashed part of the key so
+// that both keys are located in the same hash slot of Redis Cluster. It fails if the hashed part contains "}", which
+// can't be put in a hash tag.
+func tempKey(key string) (string, bool, error) {
+	hashed := hashedPart(key)
+	if strings.Contains(hashed, "}") {
+		return "", false, nil
 	}
-	return nil
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", false, err
+	}
+	return "{" + hashed + "}/temp/" + hex.EncodeToString(suffix), true, nil
+}
+
+// hashedPart returns the part of a key hashed by Redis Cluster, which is the content of the first non-empty hash tag
+// or the whole key if there is no hash tag.
+func hashedPart(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
 }
 
-func (redis *Redis) GetList(prefix, name string, n int, offset int) ([]string, error) {
-	var ctx = context.Background()
-	key := prefix + "/" + name
+func (redis *Redis) GetList(ctx context.Context, prefix, name string, n int, offset int) ([]string, error) {
+	key := redis.key(prefix, name)
 	res := make([]string, 0)
 	if n == 0 {
 		val, err := redis.client.LLen(ctx, key).Result()
@@ -65,27 +312,27 @@ func (redis *Redis) GetList(prefix, name string, n int, offset int) ([]string, e
 	return res, err
 }
 
-func (redis *Redis) GetString(prefix, name string) (string, error) {
-	var ctx = context.Background()
-	key := prefix + "/" + name
+func (redis *Redis) GetString(ctx context.Context, prefix, name string) (string, error) {
+	key := redis.key(prefix, name)
 	val, err := redis.client.Get(ctx, key).Result()
-	if err != nil {
+	if err == redisNil {
+		return "", errors.New(ErrObjectNotExist)
+	} else if err != nil {
 		return "", err
 	}
 	return val, err
 }
 
-func (redis *Redis) SetString(prefix, name string, val string) error {
-	var ctx = context.Background()
-	key := prefix + "/" + name
+func (redis *Redis) SetString(ctx context.Context, prefix, name string, val string) error {
+	key := redis.key(prefix, name)
 	if err := redis.client.Set(ctx, key, val, 0).Err(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (redis *Redis) GetInt(prefix, name string) (int, error) {
-	val, err := redis.GetString(prefix, name)
+func (redis *Redis) GetInt(ctx context.Context, prefix, name string) (int, error) {
+	val, err := redis.GetString(ctx, prefix, name)
 	if err != nil {
 		return -1, nil
 	}
@@ -96,6 +343,35 @@ func (redis *Redis) GetInt(prefix, name string) (int, error) {
 	return buf, err
 }
 
-func (redis *Redis) SetInt(prefix, name string, val int) error {
-	return redis.SetString(prefix, name, strconv.Itoa(val))
+func (redis *Redis) SetInt(ctx context.Context, prefix, name string, val int) error {
+	return redis.SetString(ctx, prefix, name, strconv.Itoa(val))
+}
+
+func (redis *Redis) Delete(ctx context.Context, prefix, name string) error {
+	return redis.client.Del(ctx, redis.key(prefix, name)).Err()
+}
+
+// Lock acquires or renews a lock by a script, so that the lock is checked and set atomically.
+func (redis *Redis) Lock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	ttlMillis := int64(ttl / time.Millisecond)
+	if ttlMillis < 1 {
+		ttlMillis = 1
+	}
+	acquired, err := redisLockScript.Run(ctx, redis.client, []string{redis.key("lock", name)}, owner, ttlMillis).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+func (redis *Redis) Unlock(ctx context.Context, name, owner string) error {
+	return redisUnlockScript.Run(ctx, redis.client, []string{redis.key("lock", name)}, owner).Err()
+}
+
+func (redis *Redis) GetLock(ctx context.Context, name string) (string, error) {
+	owner, err := redis.client.Get(ctx, redis.key("lock", name)).Result()
+	if err == redisNil {
+		return "", nil
+	}
+	return owner, err
 }
@@ -0,0 +1,309 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/zhenghaoz/gorse/storage/sqlutil"
+	_ "modernc.org/sqlite"
+)
+
+// sqlBatchSize is the maximal number of rows in a multi-row insertion.
+const sqlBatchSize = 100
+
+// SQLDatabase is a cache store in a SQL database. Items of lists and scored lists are stored as rows ordered by
+// positions, and strings are stored as key/value rows.
+type SQLDatabase struct {
+	db     *sql.DB
+	driver sqlutil.Driver
+	// namespace prefixes names of tables.
+	namespace string
+}
+
+// openSQL opens a SQL cache store. Tables are created if they don't exist.
+func openSQL(driver sqlutil.Driver, driverName, dataSourceName, namespace string) (*SQLDatabase, error) {
+	var err error
+	database := &SQLDatabase{driver: driver, namespace: namespace}
+	if database.db, err = sql.Open(driverName, dataSourceName); err != nil {
+		return nil, err
+	}
+	if driver == sqlutil.SQLite {
+		// SQLite allows only one writer at a time
+		database.db.SetMaxOpenConns(1)
+	}
+	if err = database.createTables(context.Background()); err != nil {
+		database.db.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// table returns the name of a table in the namespace.
+func (d *SQLDatabase) table(name string) string {
+	if d.namespace == "" {
+		return name
+	}
+	return d.namespace + "_" + name
+}
+
+// createTables creates tables of lists, scored lists, strings and locks.
+func (d *SQLDatabase) createTables(ctx context.Context) error {
+	scoreType := "double"
+	switch d.driver {
+	case sqlutil.Postgres:
+		scoreType = "double precision"
+	case sqlutil.SQLite:
+		scoreType = "real"
+	}
+	if _, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("cache_lists")+" ("+
+		"name varchar(512) NOT NULL,"+
+		"position integer NOT NULL,"+
+		"item_id varchar(256) NOT NULL,"+
+		"PRIMARY KEY(name, position)"+
+		")"); err != nil {
+		return err
+	}
+	if _, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("cache_scores")+" ("+
+		"name varchar(512) NOT NULL,"+
+		"position integer NOT NULL,"+
+		"item_id varchar(256) NOT NULL,"+
+		"score "+scoreType+" NOT NULL,"+
+		"PRIMARY KEY(name, position)"+
+		")"); err != nil {
+		return err
+	}
+	if _, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("cache_strings")+" ("+
+		"name varchar(512) NOT NULL,"+
+		"value text NOT NULL,"+
+		"PRIMARY KEY(name)"+
+		")"); err != nil {
+		return err
+	}
+	_, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("cache_locks")+" ("+
+		"name varchar(512) NOT NULL,"+
+		"owner varchar(256) NOT NULL,"+
+		"expire_at bigint NOT NULL,"+
+		"PRIMARY KEY(name)"+
+		")")
+	return err
+}
+
+func (d *SQLDatabase) Close() error {
+	return d.db.Close()
+}
+
+// SetList replaces a list in a transaction, so that readers never see a partially written list.
+func (d *SQLDatabase) SetList(ctx context.Context, prefix, name string, items []string) error {
+	key := prefix + "/" + name
+	return sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+		if _, err := txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("cache_lists")+" WHERE name = ?"), key); err != nil {
+			return err
+		}
+		for start := 0; start < len(items); start += sqlBatchSize {
+			end := start + sqlBatchSize
+			if end > len(items) {
+				end = len(items)
+			}
+			args := make([]interface{}, 0, (end-start)*3)
+			for i := start; i < end; i++ {
+				args = append(args, key, i, items[i])
+			}
+			if _, err := txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("cache_lists")+"(name, position, item_id) VALUES "+
+				sqlutil.Placeholders(end-start, 3)), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *SQLDatabase) GetList(ctx context.Context, prefix, name string, n int, offset int) ([]string, error) {
+	query, args := d.selectRange("SELECT item_id FROM "+d.table("cache_lists"), prefix+"/"+name, n, offset)
+	result, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	items := make([]string, 0)
+	for result.Next() {
+		var itemId string
+		if err = result.Scan(&itemId); err != nil {
+			return nil, err
+		}
+		items = append(items, itemId)
+	}
+	return items, result.Err()
+}
+
+// SetScores replaces a scored list in a transaction. Items are sorted by scores and stored with their positions.
+func (d *SQLDatabase) SetScores(ctx context.Context, prefix, name string, items []ScoredItem) error {
+	key := prefix + "/" + name
+	list := append([]ScoredItem{}, items...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Score > list[j].Score
+	})
+	return sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+		if _, err := txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("cache_scores")+" WHERE name = ?"), key); err != nil {
+			return err
+		}
+		for start := 0; start < len(list); start += sqlBatchSize {
+			end := start + sqlBatchSize
+			if end > len(list) {
+				end = len(list)
+			}
+			args := make([]interface{}, 0, (end-start)*4)
+			for i := start; i < end; i++ {
+				args = append(args, key, i, list[i].ItemId, list[i].Score)
+			}
+			if _, err := txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("cache_scores")+"(name, position, item_id, score) VALUES "+
+				sqlutil.Placeholders(end-start, 4)), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *SQLDatabase) GetScores(ctx context.Context, prefix, name string, n int, offset int) ([]ScoredItem, error) {
+	query, args := d.selectRange("SELECT item_id, score FROM "+d.table("cache_scores"), prefix+"/"+name, n, offset)
+	result, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	items := make([]ScoredItem, 0)
+	for result.Next() {
+		var item ScoredItem
+		if err = result.Scan(&item.ItemId, &item.Score); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, result.Err()
+}
+
+// selectRange completes a query of n rows from the offset of a list. All rows from the offset are selected if n is 0.
+func (d *SQLDatabase) selectRange(query, key string, n, offset int) (string, []interface{}) {
+	query += " WHERE name = ? AND position >= ?"
+	args := []interface{}{key, offset}
+	if n > 0 {
+		query += " AND position < ?"
+		args = append(args, offset+n)
+	}
+	return d.driver.Rebind(query + " ORDER BY position"), args
+}
+
+func (d *SQLDatabase) GetString(ctx context.Context, prefix, name string) (string, error) {
+	var val string
+	err := d.db.QueryRowContext(ctx, d.driver.Rebind("SELECT value FROM "+d.table("cache_strings")+" WHERE name = ?"),
+		prefix+"/"+name).Scan(&val)
+	if err == sql.ErrNoRows {
+		return "", errors.New(ErrObjectNotExist)
+	} else if err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+func (d *SQLDatabase) SetString(ctx context.Context, prefix, name string, val string) error {
+	query := "INSERT INTO " + d.table("cache_strings") + "(name, value) VALUES (?, ?) "
+	if d.driver == sqlutil.MySQL {
+		query += "ON DUPLICATE KEY UPDATE value = VALUES(value)"
+	} else {
+		query += "ON CONFLICT (name) DO UPDATE SET value = excluded.value"
+	}
+	_, err := d.db.ExecContext(ctx, d.driver.Rebind(query), prefix+"/"+name, val)
+	return err
+}
+
+func (d *SQLDatabase) GetInt(ctx context.Context, prefix, name string) (int, error) {
+	val, err := d.GetString(ctx, prefix, name)
+	if err != nil {
+		return -1, nil
+	}
+	return strconv.Atoi(val)
+}
+
+func (d *SQLDatabase) SetInt(ctx context.Context, prefix, name string, val int) error {
+	return d.SetString(ctx, prefix, name, strconv.Itoa(val))
+}
+
+func (d *SQLDatabase) Delete(ctx context.Context, prefix, name string) error {
+	key := prefix + "/" + name
+	return sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+		for _, table := range []string{"cache_lists", "cache_scores", "cache_strings"} {
+			if _, err := txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table(table)+" WHERE name = ?"), key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Lock acquires or renews a lock by a conditional update, or acquires a lock not existed by an insertion. Both
+// statements are atomic, so that only one owner succeeds. Expire times are in milliseconds since the epoch.
+func (d *SQLDatabase) Lock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	expireAt := unixMillis(now.Add(ttl))
+	result, err := d.db.ExecContext(ctx, d.driver.Rebind("UPDATE "+d.table("cache_locks")+" SET owner = ?, expire_at = ? "+
+		"WHERE name = ? AND (owner = ? OR expire_at < ?)"), owner, expireAt, name, owner, unixMillis(now))
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+	query := "INSERT INTO " + d.table("cache_locks") + "(name, owner, expire_at) VALUES (?, ?, ?) ON CONFLICT (name) DO NOTHING"
+	if d.driver == sqlutil.MySQL {
+		query = "INSERT IGNORE INTO " + d.table("cache_locks") + "(name, owner, expire_at) VALUES (?, ?, ?)"
+	}
+	if result, err = d.db.ExecContext(ctx, d.driver.Rebind(query), name, owner, expireAt); err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+	// MySQL doesn't count rows updated with unchanged values, which happens if the lock is renewed at once.
+	current, err := d.GetLock(ctx, name)
+	return current == owner, err
+}
+
+func (d *SQLDatabase) Unlock(ctx context.Context, name, owner string) error {
+	_, err := d.db.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("cache_locks")+" WHERE name = ? AND owner = ?"),
+		name, owner)
+	return err
+}
+
+func (d *SQLDatabase) GetLock(ctx context.Context, name string) (string, error) {
+	var owner string
+	err := d.db.QueryRowContext(ctx, d.driver.Rebind("SELECT owner FROM "+d.table("cache_locks")+
+		" WHERE name = ? AND expire_at >= ?"), name, unixMillis(time.Now())).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return owner, err
+}
+
+// unixMillis returns milliseconds since the epoch.
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	mySQLUri string
+)
+
+func init() {
+	// get environment variables
+	env := func(key, defaultValue string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+	mySQLUri = env("MYSQL_URI", "mysql://root@tcp(127.0.0.1:3306)/")
+}
+
+type testSQLDatabase struct {
+	Database
+}
+
+func newTestSQLDatabase(t *testing.T, dbName string) *testSQLDatabase {
+	database := new(testSQLDatabase)
+	// create database
+	dbName = "gorse_cache_" + dbName
+	databaseComm, err := sql.Open("mysql", mySQLUri[len(mySQLPrefix):])
+	assert.Nil(t, err)
+	_, err = databaseComm.Exec("DROP DATABASE IF EXISTS " + dbName)
+	assert.Nil(t, err)
+	_, err = databaseComm.Exec("CREATE DATABASE " + dbName)
+	assert.Nil(t, err)
+	err = databaseComm.Close()
+	assert.Nil(t, err)
+	// connect database
+	database.Database, err = Open(mySQLUri+dbName, "")
+	assert.Nil(t, err)
+	return database
+}
+
+func (db *testSQLDatabase) Close(t *testing.T) {
+	err := db.Database.Close()
+	assert.Nil(t, err)
+}
+
+func TestSQLDatabase_Meta(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Meta")
+	defer db.Close(t)
+	testMeta(t, db.Database)
+}
+
+func TestSQLDatabase_List(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_List")
+	defer db.Close(t)
+	testList(t, db.Database)
+}
+
+func TestSQLDatabase_Scores(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Scores")
+	defer db.Close(t)
+	testScores(t, db.Database)
+}
+
+func TestSQLDatabase_Delete(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Delete")
+	defer db.Close(t)
+	testDelete(t, db.Database)
+}
+
+func TestSQLDatabase_Lock(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Lock")
+	defer db.Close(t)
+	testLock(t, db.Database, time.Sleep)
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testSQLite struct {
+	Database
+	dir string
+}
+
+func newTestSQLite(t *testing.T) *testSQLite {
+	var err error
+	db := new(testSQLite)
+	db.dir, err = ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	db.Database, err = Open(sqlitePrefix+filepath.Join(db.dir, "cache.db"), "")
+	assert.Nil(t, err)
+	return db
+}
+
+func (db *testSQLite) Close(t *testing.T) {
+	err := db.Database.Close()
+	assert.Nil(t, err)
+	err = os.RemoveAll(db.dir)
+	assert.Nil(t, err)
+}
+
+func TestSQLite_Meta(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	testMeta(t, db.Database)
+}
+
+func TestSQLite_List(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	testList(t, db.Database)
+}
+
+func TestSQLite_Scores(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	testScores(t, db.Database)
+}
+
+func TestSQLite_Delete(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	testDelete(t, db.Database)
+}
+
+func TestSQLite_Lock(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	testLock(t, db.Database, time.Sleep)
+}
+
+func TestSQLite_Namespace(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	tenantDB, err := Open(sqlitePrefix+filepath.Join(db.dir, "cache.db"), "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	testNamespace(t, db.Database, tenantDB)
+}
+
+func TestSQLite_LargeList(t *testing.T) {
+	db := newTestSQLite(t)
+	defer db.Close(t)
+	ctx := context.Background()
+	// lists are inserted in batches
+	items := make([]string, sqlBatchSize*2+1)
+	scores := make([]ScoredItem, len(items))
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+		scores[i] = ScoredItem{ItemId: items[i], Score: float64(len(items) - i)}
+	}
+	err := db.SetList(ctx, "list", "0", items)
+	assert.Nil(t, err)
+	list, err := db.GetList(ctx, "list", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, items, list)
+	err = db.SetScores(ctx, "scores", "0", scores)
+	assert.Nil(t, err)
+	scored, err := db.GetScores(ctx, "scores", "0", 10, sqlBatchSize)
+	assert.Nil(t, err)
+	assert.Equal(t, scores[sqlBatchSize:sqlBatchSize+10], scored)
+	// reopen an existed store
+	err = db.Database.Close()
+	assert.Nil(t, err)
+	db.Database, err = Open(sqlitePrefix+filepath.Join(db.dir, "cache.db"), "")
+	assert.Nil(t, err)
+	list, err = db.GetList(ctx, "list", "0", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, items, list)
+}
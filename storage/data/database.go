@@ -17,18 +17,23 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/zhenghaoz/gorse/storage/sqlutil"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sort"
 	"strings"
 	"time"
 )
 
 const (
-	ErrUserNotExist = "user not exist"
-	ErrItemNotExist = "item not exist"
+	ErrUserNotExist    = "user not exist"
+	ErrItemNotExist    = "item not exist"
+	ErrErasureNotExist = "erasure not exist"
 )
 
 // Item stores meta data about item.
@@ -36,6 +41,43 @@ type Item struct {
 	ItemId    string `bson:"_id"`
 	Timestamp time.Time
 	Labels    []string
+	// ExpireTime is the time when the item expires. The item never expires if ExpireTime is nil.
+	ExpireTime *time.Time
+	// Hidden items are never recommended.
+	Hidden bool
+}
+
+// IsAvailable returns true if the item is neither hidden nor expired at the given time.
+func (item Item) IsAvailable(now time.Time) bool {
+	return !item.Hidden && (item.ExpireTime == nil || now.Before(*item.ExpireTime))
+}
+
+// ItemPatch is a partial update of an item. Nil fields are left unchanged.
+type ItemPatch struct {
+	Timestamp  *time.Time
+	Labels     []string
+	ExpireTime *time.Time
+	// ClearExpireTime removes the expire time of the item if ExpireTime is nil. It's set by "ExpireTime": null in JSON.
+	ClearExpireTime bool `json:"-"`
+	Hidden          *bool
+}
+
+// UnmarshalJSON decodes a patch from JSON. The expire time is cleared if it's null, and left unchanged if it's missing.
+func (patch *ItemPatch) UnmarshalJSON(data []byte) error {
+	type plainItemPatch ItemPatch
+	var temp plainItemPatch
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if expireTime, exist := fields["ExpireTime"]; exist && string(expireTime) == "null" {
+		temp.ClearExpireTime = true
+	}
+	*patch = ItemPatch(temp)
+	return nil
 }
 
 // User stores meta data about user.
@@ -44,6 +86,19 @@ type User struct {
 	Labels []string
 }
 
+// UserPatch is a partial update of a user. Nil fields are left unchanged.
+type UserPatch struct {
+	Labels []string
+}
+
+// Erasure is the audit record of erasing a user, which is also the tombstone preventing the user from being inserted
+// again. CompletedAt is nil until the erasure is completed.
+type Erasure struct {
+	UserId      string `bson:"_id"`
+	RequestedAt time.Time
+	CompletedAt *time.Time
+}
+
 // FeedbackKey identifies feedback.
 type FeedbackKey struct {
 	FeedbackType string
@@ -66,46 +121,188 @@ func (k *FeedbackKey) ToString() (string, error) {
 type Feedback struct {
 	FeedbackKey `bson:"_id"`
 	Timestamp   time.Time
+	// Value is the value of feedback, such as a rating, watch time or purchase amount.
+	Value float64
+	// Count is the number of times the feedback is received, which is increased only by BatchCountFeedback.
+	Count int
+}
+
+// DefaultFeedbackValue is the value of feedback whose value is missing.
+const DefaultFeedbackValue = 1
+
+// ValidateFeedbackValue checks whether the value of feedback is positive and finite. Values are targets of positive
+// samples for ranking models and confidence for matching models, which are meaningless otherwise.
+func ValidateFeedbackValue(value float64) error {
+	if !(value > 0) || math.IsInf(value, 1) {
+		return fmt.Errorf("value of feedback must be positive and finite (value = %v)", value)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes feedback from JSON. The value of feedback is DefaultFeedbackValue and the count of feedback is
+// 1 if missing.
+func (feedback *Feedback) UnmarshalJSON(data []byte) error {
+	type plainFeedback Feedback
+	temp := plainFeedback{Value: DefaultFeedbackValue, Count: 1}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	*feedback = Feedback(temp)
+	return nil
+}
+
+// mergeFeedback merges repeated feedback in a batch. The count of merged feedback is the number of repeats, and the
+// timestamp of merged feedback is the timestamp of the last repeat.
+func mergeFeedback(feedback []Feedback) []Feedback {
+	merged := make([]Feedback, 0, len(feedback))
+	positions := make(map[FeedbackKey]int)
+	for _, f := range feedback {
+		if i, exist := positions[f.FeedbackKey]; exist {
+			merged[i].Count++
+			merged[i].Timestamp = f.Timestamp
+		} else {
+			f.Count = 1
+			positions[f.FeedbackKey] = len(merged)
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
+
+// BatchError reports rows failed in a batch insertion. Other rows in the batch are inserted.
+type BatchError struct {
+	// Errors maps indices of failed rows to their errors.
+	Errors map[int]error
 }
 
+func newBatchError() *BatchError {
+	return &BatchError{Errors: make(map[int]error)}
+}
+
+// Indices returns indices of failed rows in ascending order.
+func (e *BatchError) Indices() []int {
+	indices := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+func (e *BatchError) Error() string {
+	first := e.Indices()[0]
+	return fmt.Sprintf("%d rows failed in batch (row %d: %v)", len(e.Errors), first, e.Errors[first])
+}
+
+// errorOrNil returns nil if no row failed.
+func (e *BatchError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// PullWindow is how far incremental pulls look back from the latest timestamp pulled before. Rows inserted with
+// timestamps older than the window at the time of insertion are missed by incremental pulls, so writers must report
+// such insertions as modifications along with updates and deletions.
+const PullWindow = time.Hour
+
+// Migration is a versioned change of the schema of a data store.
+type Migration struct {
+	Version     int
+	Description string
+}
+
+// Database is the interface of data stores. Queries are cancelled once ctx is done.
 type Database interface {
+	// Init applies all pending schema migrations.
 	Init() error
 	Close() error
+	// Migrate applies pending schema migrations in order and returns them. If dryRun is true, pending migrations are
+	// returned without being applied.
+	Migrate(ctx context.Context, dryRun bool) ([]Migration, error)
 	// items
-	InsertItem(item Item) error
-	BatchInsertItem(items []Item) error
-	DeleteItem(itemId string) error
-	GetItem(itemId string) (Item, error)
-	GetItems(cursor string, n int) (string, []Item, error)
-	GetItemFeedback(feedbackType, itemId string) ([]Feedback, error)
+	InsertItem(ctx context.Context, item Item) error
+	// BatchInsertItem inserts items. A *BatchError is returned if some items failed.
+	BatchInsertItem(ctx context.Context, items []Item) error
+	// UpsertItem inserts an item or replaces the existing one.
+	UpsertItem(ctx context.Context, item Item) error
+	// UpdateItem modifies fields of an existing item. ErrItemNotExist is returned if the item doesn't exist.
+	UpdateItem(ctx context.Context, itemId string, patch ItemPatch) error
+	DeleteItem(ctx context.Context, itemId string) error
+	// GetItem returns an item. ErrItemNotExist is returned if the item doesn't exist.
+	GetItem(ctx context.Context, itemId string) (Item, error)
+	// GetItems returns items. If timeLimit isn't nil, only items with timestamps not before timeLimit are returned.
+	GetItems(ctx context.Context, cursor string, n int, timeLimit *time.Time) (string, []Item, error)
+	GetItemFeedback(ctx context.Context, feedbackType, itemId string) ([]Feedback, error)
 	// users
-	InsertUser(user User) error
-	DeleteUser(userId string) error
-	GetUser(userId string) (User, error)
-	GetUsers(cursor string, n int) (string, []User, error)
-	GetUserFeedback(feedbackType, userId string) ([]Feedback, error)
+	InsertUser(ctx context.Context, user User) error
+	// UpsertUser inserts a user or replaces the existing one.
+	UpsertUser(ctx context.Context, user User) error
+	// UpdateUser modifies fields of an existing user. ErrUserNotExist is returned if the user doesn't exist.
+	UpdateUser(ctx context.Context, userId string, patch UserPatch) error
+	DeleteUser(ctx context.Context, userId string) error
+	GetUser(ctx context.Context, userId string) (User, error)
+	GetUsers(ctx context.Context, cursor string, n int) (string, []User, error)
+	GetUserFeedback(ctx context.Context, feedbackType, userId string) ([]Feedback, error)
+	// PutErasure inserts the erasure of a user or replaces the existing one.
+	PutErasure(ctx context.Context, erasure Erasure) error
+	// GetErasure returns the erasure of a user. ErrErasureNotExist is returned if the user hasn't been erased.
+	GetErasure(ctx context.Context, userId string) (Erasure, error)
 	// feedback
-	InsertFeedback(feedback Feedback, insertUser, insertItem bool) error
-	BatchInsertFeedback(feedback []Feedback, insertUser, insertItem bool) error
-	GetFeedback(feedbackType, cursor string, n int) (string, []Feedback, error)
+	InsertFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error
+	// BatchInsertFeedback inserts feedback. A *BatchError is returned if some feedback failed.
+	BatchInsertFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error
+	// BatchCountFeedback inserts feedback like BatchInsertFeedback, but repeated feedback increases the count and
+	// updates the timestamp of existed feedback. A *BatchError is returned if some feedback failed.
+	BatchCountFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error
+	// DeleteFeedback removes a piece of feedback. It's a no-op if the feedback doesn't exist.
+	DeleteFeedback(ctx context.Context, key FeedbackKey) error
+	// GetFeedback returns feedback. If timeLimit isn't nil, only feedback with timestamps not before timeLimit are returned.
+	GetFeedback(ctx context.Context, feedbackType, cursor string, n int, timeLimit *time.Time) (string, []Feedback, error)
 }
 
 const mySQLPrefix = "mysql://"
+const postgresPrefix = "postgres://"
+const sqlitePrefix = "sqlite://"
 const mongoPredix = "mongodb://"
 const redisPrefix = "redis://"
+const memoryPrefix = "memory://"
 
-// Open a connection to a database.
-func Open(path string) (Database, error) {
+// Open a connection to a database. The path of a memory store is "memory://" followed by an optional snapshot path.
+// Tables (collections or keys) are isolated by the namespace, and the default namespace is empty.
+func Open(path, namespace string) (Database, error) {
 	var err error
 	if strings.HasPrefix(path, mySQLPrefix) {
 		name := path[len(mySQLPrefix):]
 		database := new(SQLDatabase)
+		database.namespace = namespace
 		if database.db, err = sql.Open("mysql", name); err != nil {
 			return nil, err
 		}
 		return database, nil
+	} else if strings.HasPrefix(path, postgresPrefix) {
+		database := new(SQLDatabase)
+		database.driver = sqlutil.Postgres
+		database.namespace = namespace
+		if database.db, err = sql.Open("postgres", path); err != nil {
+			return nil, err
+		}
+		return database, nil
+	} else if strings.HasPrefix(path, sqlitePrefix) {
+		name := path[len(sqlitePrefix):]
+		database := new(SQLDatabase)
+		database.driver = sqlutil.SQLite
+		database.namespace = namespace
+		if database.db, err = sql.Open("sqlite", name); err != nil {
+			return nil, err
+		}
+		// SQLite allows only one writer at a time
+		database.db.SetMaxOpenConns(1)
+		return database, nil
 	} else if strings.HasPrefix(path, mongoPredix) {
 		database := new(MongoDB)
+		database.namespace = namespace
 		if database.client, err = mongo.Connect(context.Background(), options.Client().ApplyURI(path)); err != nil {
 			return nil, err
 		}
@@ -114,8 +311,39 @@ func Open(path string) (Database, error) {
 		addr := path[len(redisPrefix):]
 		database := new(Redis)
 		database.client = redis.NewClient(&redis.Options{Addr: addr})
+		database.namespace = namespace
 		log.Warn("redis is used for testing only")
 		return database, nil
+	} else if strings.HasPrefix(path, memoryPrefix) {
+		return openMemory(path[len(memoryPrefix):], namespace)
 	}
 	return nil, errors.Errorf("Unknown database: %s", path)
 }
+
+// OpenWithReplica opens a connection to a database like Open. Bulk reads (GetItems, GetUsers and GetFeedback) are
+// routed to the read replica if the replica isn't empty, and fall back to the primary database if the replica is down.
+// Only SQL databases support read replicas.
+func OpenWithReplica(path, replica, namespace string) (Database, error) {
+	database, err := Open(path, namespace)
+	if err != nil || replica == "" {
+		return database, err
+	}
+	primary, isSQL := database.(*SQLDatabase)
+	if !isSQL {
+		_ = database.Close()
+		return nil, errors.Errorf("read replica isn't supported: %s", path)
+	}
+	replicaDatabase, err := Open(replica, namespace)
+	if err != nil {
+		_ = database.Close()
+		return nil, err
+	}
+	secondary, isSQL := replicaDatabase.(*SQLDatabase)
+	if !isSQL || secondary.driver != primary.driver {
+		_ = database.Close()
+		_ = replicaDatabase.Close()
+		return nil, errors.Errorf("read replica mismatches primary database: %s", replica)
+	}
+	primary.replica = secondary.db
+	return primary, nil
+}
@@ -1,8 +1,12 @@
 package data
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"log"
+	"math"
 	"strconv"
 	"testing"
 	"time"
@@ -14,7 +18,7 @@ func getUsers(t *testing.T, db Database) []User {
 	var data []User
 	cursor := ""
 	for {
-		cursor, data, err = db.GetUsers(cursor, 2)
+		cursor, data, err = db.GetUsers(context.Background(), cursor, 2)
 		assert.Nil(t, err)
 		users = append(users, data...)
 		if cursor == "" {
@@ -30,13 +34,13 @@ func getUsers(t *testing.T, db Database) []User {
 	}
 }
 
-func getItems(t *testing.T, db Database) []Item {
+func getItems(t *testing.T, db Database, timeLimit *time.Time) []Item {
 	items := make([]Item, 0)
 	var err error
 	var data []Item
 	cursor := ""
 	for {
-		cursor, data, err = db.GetItems(cursor, 2)
+		cursor, data, err = db.GetItems(context.Background(), cursor, 2, timeLimit)
 		assert.Nil(t, err)
 		items = append(items, data...)
 		if cursor == "" {
@@ -52,13 +56,13 @@ func getItems(t *testing.T, db Database) []Item {
 	}
 }
 
-func getFeedback(t *testing.T, db Database) []Feedback {
+func getFeedback(t *testing.T, db Database, timeLimit *time.Time) []Feedback {
 	feedback := make([]Feedback, 0)
 	var err error
 	var data []Feedback
 	cursor := ""
 	for {
-		cursor, data, err = db.GetFeedback("click", cursor, 2)
+		cursor, data, err = db.GetFeedback(context.Background(), "click", cursor, 2, timeLimit)
 		assert.Nil(t, err)
 		feedback = append(feedback, data...)
 		if cursor == "" {
@@ -77,7 +81,7 @@ func getFeedback(t *testing.T, db Database) []Feedback {
 func testUsers(t *testing.T, db Database) {
 	// Insert users
 	for i := 0; i < 10; i++ {
-		if err := db.InsertUser(User{UserId: strconv.Itoa(i), Labels: []string{strconv.Itoa(i + 100)}}); err != nil {
+		if err := db.InsertUser(context.Background(), User{UserId: strconv.Itoa(i), Labels: []string{strconv.Itoa(i + 100)}}); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -89,50 +93,57 @@ func testUsers(t *testing.T, db Database) {
 		assert.Equal(t, []string{strconv.Itoa(i + 100)}, user.Labels)
 	}
 	// Get this user
-	if user, err := db.GetUser("0"); err != nil {
+	if user, err := db.GetUser(context.Background(), "0"); err != nil {
 		t.Fatal(err)
 	} else {
 		assert.Equal(t, "0", user.UserId)
 	}
 	// Delete this user
-	err := db.DeleteUser("0")
+	err := db.DeleteUser(context.Background(), "0")
 	assert.Nil(t, err)
-	_, err = db.GetUser("0")
-	assert.NotNil(t, err)
+	_, err = db.GetUser(context.Background(), "0")
+	assert.Equal(t, ErrUserNotExist, err.Error())
 }
 
 func testFeedback(t *testing.T, db Database) {
 	// users that already exists
-	err := db.InsertUser(User{"0", []string{"a"}})
+	err := db.InsertUser(context.Background(), User{"0", []string{"a"}})
 	assert.Nil(t, err)
 	// items that already exists
-	err = db.InsertItem(Item{ItemId: "0", Labels: []string{"b"}})
+	err = db.InsertItem(context.Background(), Item{ItemId: "0", Labels: []string{"b"}})
 	assert.Nil(t, err)
 	// Insert ret
 	feedback := []Feedback{
-		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "1", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "3", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "4", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1.5, 1},
+		{FeedbackKey{"click", "1", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 2.5, 1},
+		{FeedbackKey{"click", "2", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 3.5, 1},
+		{FeedbackKey{"click", "3", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 4.5, 1},
+		{FeedbackKey{"click", "4", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 5.5, 1},
 	}
-	err = db.InsertFeedback(feedback[0], true, true)
+	err = db.InsertFeedback(context.Background(), feedback[0], true, true)
 	assert.Nil(t, err)
-	err = db.BatchInsertFeedback(feedback[1:], true, true)
+	err = db.BatchInsertFeedback(context.Background(), feedback[1:], true, true)
 	assert.Nil(t, err)
 	// idempotent
-	err = db.InsertFeedback(feedback[0], true, true)
+	err = db.InsertFeedback(context.Background(), feedback[0], true, true)
 	assert.Nil(t, err)
-	err = db.BatchInsertFeedback(feedback[1:], true, true)
+	err = db.BatchInsertFeedback(context.Background(), feedback[1:], true, true)
 	assert.Nil(t, err)
 	// other type
-	err = db.InsertFeedback(Feedback{FeedbackKey: FeedbackKey{"like", "0", "2"}}, true, true)
+	err = db.InsertFeedback(context.Background(), Feedback{FeedbackKey: FeedbackKey{"like", "0", "2"}}, true, true)
 	assert.Nil(t, err)
 	// Get feedback
-	ret := getFeedback(t, db)
+	ret := getFeedback(t, db, nil)
+	assert.Equal(t, feedback, ret)
+	// Get feedback with time limit
+	timeLimit := time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)
+	ret = getFeedback(t, db, &timeLimit)
 	assert.Equal(t, feedback, ret)
+	timeLimit = time.Date(1996, 3, 16, 0, 0, 0, 0, time.UTC)
+	ret = getFeedback(t, db, &timeLimit)
+	assert.Empty(t, ret)
 	// Get items
-	items := getItems(t, db)
+	items := getItems(t, db, nil)
 	assert.Equal(t, 5, len(items))
 	for i, item := range items {
 		assert.Equal(t, strconv.Itoa(i*2), item.ItemId)
@@ -144,27 +155,60 @@ func testFeedback(t *testing.T, db Database) {
 		assert.Equal(t, strconv.Itoa(i), user.UserId)
 	}
 	// check users that already exists
-	user, err := db.GetUser("0")
+	user, err := db.GetUser(context.Background(), "0")
 	assert.Nil(t, err)
 	assert.Equal(t, User{"0", []string{"a"}}, user)
 	// check items that already exists
-	item, err := db.GetItem("0")
+	item, err := db.GetItem(context.Background(), "0")
 	assert.Nil(t, err)
 	assert.Equal(t, Item{ItemId: "0", Labels: []string{"b"}}, item)
 	// Get ret by user
-	ret, err = db.GetUserFeedback("click", "2")
+	ret, err = db.GetUserFeedback(context.Background(), "click", "2")
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(ret))
 	assert.Equal(t, "2", ret[0].UserId)
 	assert.Equal(t, "4", ret[0].ItemId)
 	// Get ret by item
-	ret, err = db.GetItemFeedback("click", "4")
+	ret, err = db.GetItemFeedback(context.Background(), "click", "4")
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(ret))
 	assert.Equal(t, "2", ret[0].UserId)
 	assert.Equal(t, "4", ret[0].ItemId)
 }
 
+func testFeedbackType(t *testing.T, db Database) {
+	ctx := context.Background()
+	timestamp := time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)
+	// item ids don't increase with user ids so that pages are ordered by both keys
+	clicks := []Feedback{
+		{FeedbackKey{"click", "0", "5"}, timestamp, 1, 1},
+		{FeedbackKey{"click", "1", "9"}, timestamp, 1, 1},
+		{FeedbackKey{"click", "2", "1"}, timestamp, 1, 1},
+		{FeedbackKey{"click", "3", "0"}, timestamp, 1, 1},
+		{FeedbackKey{"click", "4", "3"}, timestamp, 1, 1},
+	}
+	err := db.BatchInsertFeedback(ctx, clicks, true, true)
+	assert.Nil(t, err)
+	like := Feedback{FeedbackKey{"like", "2", "1"}, timestamp, 1, 1}
+	err = db.InsertFeedback(ctx, like, true, true)
+	assert.Nil(t, err)
+	// feedback of other types isn't paged
+	assert.ElementsMatch(t, clicks, getFeedback(t, db, nil))
+	// feedback of other types isn't returned
+	ret, err := db.GetUserFeedback(ctx, "click", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{clicks[2]}, ret)
+	ret, err = db.GetUserFeedback(ctx, "like", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{like}, ret)
+	ret, err = db.GetItemFeedback(ctx, "click", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{clicks[2]}, ret)
+	ret, err = db.GetItemFeedback(ctx, "like", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{like}, ret)
+}
+
 func testItems(t *testing.T, db Database) {
 	// Items
 	items := []Item{
@@ -195,53 +239,60 @@ func testItems(t *testing.T, db Database) {
 		},
 	}
 	// Insert item
-	err := db.InsertItem(items[0])
+	err := db.InsertItem(context.Background(), items[0])
 	assert.Nil(t, err)
-	err = db.BatchInsertItem(items[1:])
+	err = db.BatchInsertItem(context.Background(), items[1:])
 	assert.Nil(t, err)
 	// Get items
-	totalItems := getItems(t, db)
+	totalItems := getItems(t, db, nil)
 	assert.Equal(t, items, totalItems)
+	// Get items with time limit
+	timeLimit := time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)
+	totalItems = getItems(t, db, &timeLimit)
+	assert.Equal(t, items, totalItems)
+	timeLimit = time.Date(1996, 3, 16, 0, 0, 0, 0, time.UTC)
+	totalItems = getItems(t, db, &timeLimit)
+	assert.Empty(t, totalItems)
 	// Get item
 	for _, item := range items {
-		ret, err := db.GetItem(item.ItemId)
+		ret, err := db.GetItem(context.Background(), item.ItemId)
 		if err != nil {
 			t.Fatal(err)
 		}
 		assert.Equal(t, item, ret)
 	}
 	// Delete item
-	err = db.DeleteItem("0")
+	err = db.DeleteItem(context.Background(), "0")
 	assert.Nil(t, err)
-	_, err = db.GetItem("0")
-	assert.NotNil(t, err)
+	_, err = db.GetItem(context.Background(), "0")
+	assert.Equal(t, ErrItemNotExist, err.Error())
 }
 
 func testDeleteUser(t *testing.T, db Database) {
 	// Insert ret
 	feedback := []Feedback{
-		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "0", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "0", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "0", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "0", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "0", "4"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "0", "6"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "0", "8"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
 	}
-	if err := db.BatchInsertFeedback(feedback, true, true); err != nil {
+	if err := db.BatchInsertFeedback(context.Background(), feedback, true, true); err != nil {
 		t.Fatal(err)
 	}
 	// Delete user
-	if err := db.DeleteUser("0"); err != nil {
+	if err := db.DeleteUser(context.Background(), "0"); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := db.GetUser("0"); err == nil {
+	if _, err := db.GetUser(context.Background(), "0"); err == nil {
 		t.Fatal("failed to delete user")
 	}
-	if ret, err := db.GetUserFeedback("click", "0"); err != nil {
+	if ret, err := db.GetUserFeedback(context.Background(), "click", "0"); err != nil {
 		t.Fatal(err)
 	} else {
 		assert.Equal(t, 0, len(ret))
 	}
-	if _, ret, err := db.GetFeedback("click", "", 100); err != nil {
+	if _, ret, err := db.GetFeedback(context.Background(), "click", "", 100, nil); err != nil {
 		t.Fatal(err)
 	} else {
 		assert.Empty(t, ret)
@@ -251,30 +302,345 @@ func testDeleteUser(t *testing.T, db Database) {
 func testDeleteItem(t *testing.T, db Database) {
 	// Insert ret
 	feedbacks := []Feedback{
-		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "1", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "2", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "3", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
-		{FeedbackKey{"click", "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "1", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "2", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "3", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "4", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
 	}
-	if err := db.BatchInsertFeedback(feedbacks, true, true); err != nil {
+	if err := db.BatchInsertFeedback(context.Background(), feedbacks, true, true); err != nil {
 		t.Fatal(err)
 	}
 	// Delete item
-	if err := db.DeleteItem("0"); err != nil {
+	if err := db.DeleteItem(context.Background(), "0"); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := db.GetItem("0"); err == nil {
+	if _, err := db.GetItem(context.Background(), "0"); err == nil {
 		t.Fatal("failed to delete item")
 	}
-	if ret, err := db.GetItemFeedback("click", "0"); err != nil {
+	if ret, err := db.GetItemFeedback(context.Background(), "click", "0"); err != nil {
 		t.Fatal(err)
 	} else {
 		assert.Equal(t, 0, len(ret))
 	}
-	if _, ret, err := db.GetFeedback("click", "", 100); err != nil {
+	if _, ret, err := db.GetFeedback(context.Background(), "click", "", 100, nil); err != nil {
 		log.Fatal(err)
 	} else {
 		assert.Empty(t, ret)
 	}
 }
+
+func testDeleteFeedback(t *testing.T, db Database) {
+	feedbacks := []Feedback{
+		{FeedbackKey{"click", "0", "0"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"click", "0", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+		{FeedbackKey{"like", "1", "2"}, time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), 1, 1},
+	}
+	err := db.BatchInsertFeedback(context.Background(), feedbacks, true, true)
+	assert.Nil(t, err)
+	// delete feedback
+	err = db.DeleteFeedback(context.Background(), FeedbackKey{"click", "0", "0"})
+	assert.Nil(t, err)
+	ret := getFeedback(t, db, nil)
+	assert.Equal(t, []Feedback{feedbacks[1]}, ret)
+	ret, err = db.GetUserFeedback(context.Background(), "click", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{feedbacks[1]}, ret)
+	ret, err = db.GetItemFeedback(context.Background(), "click", "0")
+	assert.Nil(t, err)
+	assert.Empty(t, ret)
+	// feedback of other types is kept
+	ret, err = db.GetUserFeedback(context.Background(), "like", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{feedbacks[2]}, ret)
+	// users and items are kept
+	_, err = db.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	_, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	// delete feedback that doesn't exist
+	err = db.DeleteFeedback(context.Background(), FeedbackKey{"click", "1", "1"})
+	assert.Nil(t, err)
+}
+
+func testBatchInsert(t *testing.T, db Database) {
+	// insert more items than a batch
+	items := make([]Item, 250)
+	for i := range items {
+		items[i] = Item{ItemId: fmt.Sprintf("%03d", i), Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Labels: []string{"a"}}
+	}
+	err := db.BatchInsertItem(context.Background(), items)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, items, getItems(t, db, nil))
+	// insert more feedback than a batch
+	feedback := make([]Feedback, 0)
+	for i := 0; i < 250; i++ {
+		feedback = append(feedback, Feedback{
+			FeedbackKey: FeedbackKey{"click", strconv.Itoa(i), fmt.Sprintf("%03d", i)},
+			Timestamp:   time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
+			Value:       1,
+			Count:       1,
+		})
+	}
+	err = db.BatchInsertFeedback(context.Background(), feedback, true, false)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, feedback, getFeedback(t, db, nil))
+	assert.Equal(t, 250, len(getUsers(t, db)))
+	// insert duplicated feedback
+	err = db.BatchInsertFeedback(context.Background(), append(feedback[:1], feedback[:1]...), true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 250, len(getFeedback(t, db, nil)))
+}
+
+func testUpdateItem(t *testing.T, db Database) {
+	// upsert a new item
+	err := db.UpsertItem(context.Background(), Item{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Labels: []string{"a"}})
+	assert.Nil(t, err)
+	item, err := db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Item{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Labels: []string{"a"}}, item)
+	// upsert an existing item
+	err = db.UpsertItem(context.Background(), Item{ItemId: "0", Timestamp: time.Date(1996, 4, 8, 0, 0, 0, 0, time.UTC), Labels: []string{"b"}})
+	assert.Nil(t, err)
+	item, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Item{ItemId: "0", Timestamp: time.Date(1996, 4, 8, 0, 0, 0, 0, time.UTC), Labels: []string{"b"}}, item)
+	// patch labels
+	err = db.UpdateItem(context.Background(), "0", ItemPatch{Labels: []string{"c", "d"}})
+	assert.Nil(t, err)
+	item, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Item{ItemId: "0", Timestamp: time.Date(1996, 4, 8, 0, 0, 0, 0, time.UTC), Labels: []string{"c", "d"}}, item)
+	// patch timestamp
+	timestamp := time.Date(1996, 5, 1, 0, 0, 0, 0, time.UTC)
+	err = db.UpdateItem(context.Background(), "0", ItemPatch{Timestamp: &timestamp})
+	assert.Nil(t, err)
+	item, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Item{ItemId: "0", Timestamp: timestamp, Labels: []string{"c", "d"}}, item)
+	// patch an item that doesn't exist
+	err = db.UpdateItem(context.Background(), "1", ItemPatch{Labels: []string{"a"}})
+	assert.Equal(t, ErrItemNotExist, err.Error())
+	err = db.UpdateItem(context.Background(), "1", ItemPatch{})
+	assert.Equal(t, ErrItemNotExist, err.Error())
+}
+
+func testItemVisibility(t *testing.T, db Database) {
+	expireTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := []Item{
+		{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{ItemId: "1", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), ExpireTime: &expireTime},
+		{ItemId: "2", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Hidden: true},
+	}
+	err := db.InsertItem(context.Background(), items[0])
+	assert.Nil(t, err)
+	err = db.BatchInsertItem(context.Background(), items[1:])
+	assert.Nil(t, err)
+	_, returnItems, err := db.GetItems(context.Background(), "", 3, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, items, returnItems)
+	// patch expire time and hidden flag
+	hidden := true
+	err = db.UpdateItem(context.Background(), "0", ItemPatch{ExpireTime: &expireTime, Hidden: &hidden})
+	assert.Nil(t, err)
+	item, err := db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Item{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), ExpireTime: &expireTime, Hidden: true}, item)
+	// patch clears expire time
+	err = db.UpdateItem(context.Background(), "1", ItemPatch{ClearExpireTime: true})
+	assert.Nil(t, err)
+	item, err = db.GetItem(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.Nil(t, item.ExpireTime)
+	// upsert clears expire time and hidden flag
+	err = db.UpsertItem(context.Background(), Item{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)})
+	assert.Nil(t, err)
+	item, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, items[0], item)
+}
+
+func testUpdateUser(t *testing.T, db Database) {
+	// upsert a new user
+	err := db.UpsertUser(context.Background(), User{UserId: "0", Labels: []string{"a"}})
+	assert.Nil(t, err)
+	user, err := db.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"a"}}, user)
+	// upsert an existing user
+	err = db.UpsertUser(context.Background(), User{UserId: "0", Labels: []string{"b"}})
+	assert.Nil(t, err)
+	user, err = db.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"b"}}, user)
+	// patch labels
+	err = db.UpdateUser(context.Background(), "0", UserPatch{Labels: []string{"c", "d"}})
+	assert.Nil(t, err)
+	user, err = db.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"c", "d"}}, user)
+	// empty patch
+	err = db.UpdateUser(context.Background(), "0", UserPatch{})
+	assert.Nil(t, err)
+	user, err = db.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"c", "d"}}, user)
+	// patch a user that doesn't exist
+	err = db.UpdateUser(context.Background(), "1", UserPatch{Labels: []string{"a"}})
+	assert.Equal(t, ErrUserNotExist, err.Error())
+}
+
+func testErasure(t *testing.T, db Database) {
+	// get an erasure that doesn't exist
+	_, err := db.GetErasure(context.Background(), "0")
+	assert.Equal(t, ErrErasureNotExist, err.Error())
+	// put a requested erasure
+	requestedAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = db.PutErasure(context.Background(), Erasure{UserId: "0", RequestedAt: requestedAt})
+	assert.Nil(t, err)
+	erasure, err := db.GetErasure(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Erasure{UserId: "0", RequestedAt: requestedAt}, erasure)
+	// complete the erasure
+	completedAt := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	err = db.PutErasure(context.Background(), Erasure{UserId: "0", RequestedAt: requestedAt, CompletedAt: &completedAt})
+	assert.Nil(t, err)
+	erasure, err = db.GetErasure(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, "0", erasure.UserId)
+	assert.Equal(t, requestedAt, erasure.RequestedAt)
+	assert.NotNil(t, erasure.CompletedAt)
+	assert.Equal(t, completedAt, *erasure.CompletedAt)
+}
+
+func testCancelContext(t *testing.T, db Database) {
+	err := db.InsertUser(context.Background(), User{UserId: "0"})
+	assert.Nil(t, err)
+	// queries are cancelled once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = db.GetUser(ctx, "0")
+	assert.NotNil(t, err)
+	_, _, err = db.GetUsers(ctx, "", 10)
+	assert.NotNil(t, err)
+}
+
+func testMigrate(t *testing.T, db Database) {
+	// all migrations have been applied by Init
+	migrations, err := db.Migrate(context.Background(), true)
+	assert.Nil(t, err)
+	assert.Empty(t, migrations)
+	migrations, err = db.Migrate(context.Background(), false)
+	assert.Nil(t, err)
+	assert.Empty(t, migrations)
+}
+
+func TestItem_IsAvailable(t *testing.T) {
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	assert.True(t, Item{}.IsAvailable(now))
+	assert.True(t, Item{ExpireTime: &future}.IsAvailable(now))
+	assert.False(t, Item{ExpireTime: &now}.IsAvailable(now))
+	assert.False(t, Item{ExpireTime: &past}.IsAvailable(now))
+	assert.False(t, Item{Hidden: true}.IsAvailable(now))
+}
+
+func TestFeedback_UnmarshalJSON(t *testing.T) {
+	var feedback []Feedback
+	err := json.Unmarshal([]byte(`[
+		{"FeedbackType": "click", "UserId": "0", "ItemId": "0"},
+		{"FeedbackType": "click", "UserId": "0", "ItemId": "1", "Value": 0},
+		{"FeedbackType": "click", "UserId": "0", "ItemId": "2", "Value": 4.5}
+	]`), &feedback)
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{
+		{FeedbackKey: FeedbackKey{"click", "0", "0"}, Value: DefaultFeedbackValue, Count: 1},
+		{FeedbackKey: FeedbackKey{"click", "0", "1"}, Value: 0, Count: 1},
+		{FeedbackKey: FeedbackKey{"click", "0", "2"}, Value: 4.5, Count: 1},
+	}, feedback)
+}
+
+func TestItemPatch_UnmarshalJSON(t *testing.T) {
+	expireTime := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	var patches []ItemPatch
+	err := json.Unmarshal([]byte(`[
+		{"Labels": ["a"]},
+		{"ExpireTime": null},
+		{"ExpireTime": "2030-01-01T00:00:00Z"}
+	]`), &patches)
+	assert.Nil(t, err)
+	assert.Equal(t, []ItemPatch{
+		{Labels: []string{"a"}},
+		{ClearExpireTime: true},
+		{ExpireTime: &expireTime},
+	}, patches)
+}
+
+func TestValidateFeedbackValue(t *testing.T) {
+	assert.Nil(t, ValidateFeedbackValue(DefaultFeedbackValue))
+	assert.Nil(t, ValidateFeedbackValue(4.5))
+	assert.NotNil(t, ValidateFeedbackValue(0))
+	assert.NotNil(t, ValidateFeedbackValue(-1))
+	assert.NotNil(t, ValidateFeedbackValue(math.NaN()))
+	assert.NotNil(t, ValidateFeedbackValue(math.Inf(1)))
+}
+
+func testCountFeedback(t *testing.T, db Database) {
+	ctx := context.Background()
+	timestamp := time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC)
+	// count repeated feedback in a batch
+	err := db.BatchCountFeedback(ctx, []Feedback{
+		{FeedbackKey: FeedbackKey{"read", "0", "0"}, Timestamp: timestamp, Value: 2},
+		{FeedbackKey: FeedbackKey{"read", "0", "0"}, Timestamp: timestamp.Add(time.Hour), Value: 2},
+		{FeedbackKey: FeedbackKey{"read", "0", "1"}, Timestamp: timestamp, Value: 2},
+	}, true, true)
+	assert.Nil(t, err)
+	// count repeated feedback across batches
+	err = db.BatchCountFeedback(ctx, []Feedback{
+		{FeedbackKey: FeedbackKey{"read", "0", "0"}, Timestamp: timestamp.Add(2 * time.Hour), Value: 2},
+	}, true, true)
+	assert.Nil(t, err)
+	feedback, err := db.GetUserFeedback(ctx, "read", "0")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []Feedback{
+		{FeedbackKey{"read", "0", "0"}, timestamp.Add(2 * time.Hour), 2, 3},
+		{FeedbackKey{"read", "0", "1"}, timestamp, 2, 1},
+	}, feedback)
+	// repeated feedback aren't counted by BatchInsertFeedback
+	err = db.BatchInsertFeedback(ctx, []Feedback{
+		{FeedbackKey: FeedbackKey{"read", "0", "1"}, Timestamp: timestamp, Value: 2},
+	}, true, true)
+	assert.Nil(t, err)
+	feedback, err = db.GetItemFeedback(ctx, "read", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{{FeedbackKey{"read", "0", "1"}, timestamp, 2, 1}}, feedback)
+}
+
+func testNamespace(t *testing.T, db, tenantDB Database) {
+	ctx := context.Background()
+	// insert data into the default namespace and the namespace of a tenant
+	err := db.InsertFeedback(ctx, Feedback{FeedbackKey: FeedbackKey{"click", "0", "0"}, Timestamp: time.Now()}, true, true)
+	assert.Nil(t, err)
+	err = tenantDB.InsertFeedback(ctx, Feedback{FeedbackKey: FeedbackKey{"click", "1", "1"}, Timestamp: time.Now()}, true, true)
+	assert.Nil(t, err)
+	// data are isolated
+	for i, database := range []Database{db, tenantDB} {
+		id := strconv.Itoa(i)
+		_, users, err := database.GetUsers(ctx, "", 10)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(users))
+		assert.Equal(t, id, users[0].UserId)
+		_, items, err := database.GetItems(ctx, "", 10, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(items))
+		assert.Equal(t, id, items[0].ItemId)
+		_, feedback, err := database.GetFeedback(ctx, "click", "", 10, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(feedback))
+		assert.Equal(t, FeedbackKey{"click", id, id}, feedback[0].FeedbackKey)
+	}
+	_, err = db.GetUser(ctx, "1")
+	assert.Equal(t, ErrUserNotExist, err.Error())
+	_, err = tenantDB.GetItem(ctx, "0")
+	assert.Equal(t, ErrItemNotExist, err.Error())
+}
@@ -0,0 +1,540 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zhenghaoz/gorse/base"
+)
+
+// memoryStoreKey identifies a memory store by its snapshot path and its namespace.
+type memoryStoreKey struct {
+	snapshot  string
+	namespace string
+}
+
+// memoryStores are opened memory stores.
+var memoryStores = struct {
+	sync.Mutex
+	stores map[memoryStoreKey]*Memory
+}{stores: make(map[memoryStoreKey]*Memory)}
+
+// Memory is a data store in memory. Memory stores opened with the same snapshot path and the same namespace share data
+// in a process. If the snapshot path isn't empty, data are loaded from the snapshot once opened and saved to the
+// snapshot once the last reference is closed.
+type Memory struct {
+	mutex     sync.RWMutex
+	key       memoryStoreKey
+	snapshot  string
+	refs      int
+	items     map[string]Item
+	users     map[string]User
+	feedback  map[FeedbackKey]Feedback
+	erasures  map[string]Erasure
+	userIndex map[string]map[FeedbackKey]struct{}
+	itemIndex map[string]map[FeedbackKey]struct{}
+}
+
+// memorySnapshot is the content of a snapshot of a memory store.
+type memorySnapshot struct {
+	Items    []Item
+	Users    []User
+	Feedback []Feedback
+	Erasures []Erasure
+}
+
+// openMemory opens a memory store. The snapshot of a namespace is saved to the snapshot path suffixed by the namespace.
+func openMemory(snapshot, namespace string) (*Memory, error) {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	key := memoryStoreKey{snapshot: snapshot, namespace: namespace}
+	if db, exist := memoryStores.stores[key]; exist {
+		db.refs++
+		return db, nil
+	}
+	if snapshot != "" && namespace != "" {
+		snapshot += "." + namespace
+	}
+	db := &Memory{
+		key:       key,
+		snapshot:  snapshot,
+		refs:      1,
+		items:     make(map[string]Item),
+		users:     make(map[string]User),
+		feedback:  make(map[FeedbackKey]Feedback),
+		erasures:  make(map[string]Erasure),
+		userIndex: make(map[string]map[FeedbackKey]struct{}),
+		itemIndex: make(map[string]map[FeedbackKey]struct{}),
+	}
+	if snapshot != "" {
+		var data memorySnapshot
+		if err := base.ReadGob(snapshot, &data); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, item := range data.Items {
+			db.items[item.ItemId] = item
+		}
+		for _, user := range data.Users {
+			db.users[user.UserId] = user
+		}
+		for _, feedback := range data.Feedback {
+			// feedback in snapshots of older versions have no counts
+			if feedback.Count < 1 {
+				feedback.Count = 1
+			}
+			db.putFeedback(feedback)
+		}
+		for _, erasure := range data.Erasures {
+			db.erasures[erasure.UserId] = erasure
+		}
+	}
+	memoryStores.stores[key] = db
+	return db, nil
+}
+
+func (db *Memory) Init() error {
+	return nil
+}
+
+// Migrate does nothing since the memory store is schemaless.
+func (db *Memory) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	return []Migration{}, nil
+}
+
+// Close releases a reference to the memory store. The memory store is saved to its snapshot and discarded once the
+// last reference is released.
+func (db *Memory) Close() error {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	if db.refs--; db.refs > 0 {
+		return nil
+	}
+	delete(memoryStores.stores, db.key)
+	if db.snapshot == "" {
+		return nil
+	}
+	return db.Snapshot()
+}
+
+// Snapshot saves the memory store to its snapshot.
+func (db *Memory) Snapshot() error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	var data memorySnapshot
+	for _, item := range db.items {
+		data.Items = append(data.Items, item)
+	}
+	for _, user := range db.users {
+		data.Users = append(data.Users, user)
+	}
+	for _, feedback := range db.feedback {
+		data.Feedback = append(data.Feedback, feedback)
+	}
+	for _, erasure := range db.erasures {
+		data.Erasures = append(data.Erasures, erasure)
+	}
+	return base.WriteGob(db.snapshot, data)
+}
+
+func (db *Memory) InsertItem(ctx context.Context, item Item) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, exist := db.items[item.ItemId]; !exist {
+		db.items[item.ItemId] = item
+	}
+	return nil
+}
+
+func (db *Memory) BatchInsertItem(ctx context.Context, items []Item) error {
+	for _, item := range items {
+		if err := db.InsertItem(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Memory) UpsertItem(ctx context.Context, item Item) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.items[item.ItemId] = item
+	return nil
+}
+
+func (db *Memory) UpdateItem(ctx context.Context, itemId string, patch ItemPatch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	item, exist := db.items[itemId]
+	if !exist {
+		return errors.New(ErrItemNotExist)
+	}
+	if patch.Timestamp != nil {
+		item.Timestamp = *patch.Timestamp
+	}
+	if patch.Labels != nil {
+		item.Labels = patch.Labels
+	}
+	if patch.ExpireTime != nil || patch.ClearExpireTime {
+		item.ExpireTime = patch.ExpireTime
+	}
+	if patch.Hidden != nil {
+		item.Hidden = *patch.Hidden
+	}
+	db.items[itemId] = item
+	return nil
+}
+
+func (db *Memory) DeleteItem(ctx context.Context, itemId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.items, itemId)
+	for key := range db.itemIndex[itemId] {
+		db.removeFeedback(key)
+	}
+	return nil
+}
+
+func (db *Memory) GetItem(ctx context.Context, itemId string) (Item, error) {
+	if err := ctx.Err(); err != nil {
+		return Item{}, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	item, exist := db.items[itemId]
+	if !exist {
+		return Item{}, errors.New(ErrItemNotExist)
+	}
+	return item, nil
+}
+
+func (db *Memory) GetItems(ctx context.Context, cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	itemIds := make([]string, 0, len(db.items))
+	for itemId, item := range db.items {
+		if itemId >= cursor && (timeLimit == nil || !item.Timestamp.Before(*timeLimit)) {
+			itemIds = append(itemIds, itemId)
+		}
+	}
+	sort.Strings(itemIds)
+	items := make([]Item, 0, base.Min(n, len(itemIds)))
+	for _, itemId := range itemIds {
+		if len(items) == n {
+			return itemId, items, nil
+		}
+		items = append(items, db.items[itemId])
+	}
+	return "", items, nil
+}
+
+func (db *Memory) GetItemFeedback(ctx context.Context, feedbackType, itemId string) ([]Feedback, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.filterFeedback(db.itemIndex[itemId], feedbackType), nil
+}
+
+func (db *Memory) InsertUser(ctx context.Context, user User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if _, exist := db.users[user.UserId]; !exist {
+		db.users[user.UserId] = user
+	}
+	return nil
+}
+
+func (db *Memory) UpsertUser(ctx context.Context, user User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.users[user.UserId] = user
+	return nil
+}
+
+func (db *Memory) UpdateUser(ctx context.Context, userId string, patch UserPatch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	user, exist := db.users[userId]
+	if !exist {
+		return errors.New(ErrUserNotExist)
+	}
+	if patch.Labels != nil {
+		user.Labels = patch.Labels
+	}
+	db.users[userId] = user
+	return nil
+}
+
+func (db *Memory) DeleteUser(ctx context.Context, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	delete(db.users, userId)
+	for key := range db.userIndex[userId] {
+		db.removeFeedback(key)
+	}
+	return nil
+}
+
+func (db *Memory) GetUser(ctx context.Context, userId string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	user, exist := db.users[userId]
+	if !exist {
+		return User{}, errors.New(ErrUserNotExist)
+	}
+	return user, nil
+}
+
+func (db *Memory) PutErasure(ctx context.Context, erasure Erasure) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.erasures[erasure.UserId] = erasure
+	return nil
+}
+
+func (db *Memory) GetErasure(ctx context.Context, userId string) (Erasure, error) {
+	if err := ctx.Err(); err != nil {
+		return Erasure{}, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	erasure, exist := db.erasures[userId]
+	if !exist {
+		return Erasure{}, errors.New(ErrErasureNotExist)
+	}
+	return erasure, nil
+}
+
+func (db *Memory) GetUsers(ctx context.Context, cursor string, n int) (string, []User, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	userIds := make([]string, 0, len(db.users))
+	for userId := range db.users {
+		if userId >= cursor {
+			userIds = append(userIds, userId)
+		}
+	}
+	sort.Strings(userIds)
+	users := make([]User, 0, base.Min(n, len(userIds)))
+	for _, userId := range userIds {
+		if len(users) == n {
+			return userId, users, nil
+		}
+		users = append(users, db.users[userId])
+	}
+	return "", users, nil
+}
+
+func (db *Memory) GetUserFeedback(ctx context.Context, feedbackType, userId string) ([]Feedback, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.filterFeedback(db.userIndex[userId], feedbackType), nil
+}
+
+func (db *Memory) InsertFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
+	return db.insertFeedback(ctx, feedback, insertUser, insertItem, false)
+}
+
+// insertFeedback inserts a piece of feedback. Repeated feedback is ignored, or counted if count is true.
+func (db *Memory) insertFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem, count bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	// insert user
+	if _, exist := db.users[feedback.UserId]; !exist {
+		if !insertUser {
+			return nil
+		}
+		db.users[feedback.UserId] = User{UserId: feedback.UserId}
+	}
+	// insert item
+	if _, exist := db.items[feedback.ItemId]; !exist {
+		if !insertItem {
+			return nil
+		}
+		db.items[feedback.ItemId] = Item{ItemId: feedback.ItemId}
+	}
+	// insert feedback
+	if existed, exist := db.feedback[feedback.FeedbackKey]; !exist {
+		feedback.Count = 1
+		db.putFeedback(feedback)
+	} else if count {
+		existed.Count++
+		existed.Timestamp = feedback.Timestamp
+		db.feedback[feedback.FeedbackKey] = existed
+	}
+	return nil
+}
+
+func (db *Memory) BatchInsertFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	for _, f := range feedback {
+		if err := db.InsertFeedback(ctx, f, insertUser, insertItem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Memory) BatchCountFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	for _, f := range feedback {
+		if err := db.insertFeedback(ctx, f, insertUser, insertItem, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Memory) DeleteFeedback(ctx context.Context, key FeedbackKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.removeFeedback(key)
+	return nil
+}
+
+// GetFeedback returns feedback of a type, or of all types if feedbackType is empty.
+func (db *Memory) GetFeedback(ctx context.Context, feedbackType, cursor string, n int, timeLimit *time.Time) (string, []Feedback, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	var cursorKey FeedbackKey
+	if cursor != "" {
+		if err := json.Unmarshal([]byte(cursor), &cursorKey); err != nil {
+			return "", nil, err
+		}
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	feedback := make([]Feedback, 0)
+	for key, f := range db.feedback {
+		if (feedbackType == "" || key.FeedbackType == feedbackType) && !lessFeedbackKey(key, cursorKey) &&
+			(timeLimit == nil || !f.Timestamp.Before(*timeLimit)) {
+			feedback = append(feedback, f)
+		}
+	}
+	sortFeedback(feedback)
+	if len(feedback) > n {
+		nextCursor, err := json.Marshal(feedback[n].FeedbackKey)
+		if err != nil {
+			return "", nil, err
+		}
+		return string(nextCursor), feedback[:n], nil
+	}
+	return "", feedback, nil
+}
+
+// putFeedback writes feedback and its indices. The caller must hold the write lock.
+func (db *Memory) putFeedback(feedback Feedback) {
+	db.feedback[feedback.FeedbackKey] = feedback
+	if _, exist := db.userIndex[feedback.UserId]; !exist {
+		db.userIndex[feedback.UserId] = make(map[FeedbackKey]struct{})
+	}
+	db.userIndex[feedback.UserId][feedback.FeedbackKey] = struct{}{}
+	if _, exist := db.itemIndex[feedback.ItemId]; !exist {
+		db.itemIndex[feedback.ItemId] = make(map[FeedbackKey]struct{})
+	}
+	db.itemIndex[feedback.ItemId][feedback.FeedbackKey] = struct{}{}
+}
+
+// removeFeedback removes feedback and its indices. The caller must hold the write lock.
+func (db *Memory) removeFeedback(key FeedbackKey) {
+	delete(db.feedback, key)
+	if delete(db.userIndex[key.UserId], key); len(db.userIndex[key.UserId]) == 0 {
+		delete(db.userIndex, key.UserId)
+	}
+	if delete(db.itemIndex[key.ItemId], key); len(db.itemIndex[key.ItemId]) == 0 {
+		delete(db.itemIndex, key.ItemId)
+	}
+}
+
+// filterFeedback returns indexed feedback of a type, or of all types if feedbackType is empty. The caller must hold
+// the read lock.
+func (db *Memory) filterFeedback(index map[FeedbackKey]struct{}, feedbackType string) []Feedback {
+	feedback := make([]Feedback, 0)
+	for key := range index {
+		if feedbackType == "" || key.FeedbackType == feedbackType {
+			feedback = append(feedback, db.feedback[key])
+		}
+	}
+	sortFeedback(feedback)
+	return feedback
+}
+
+// sortFeedback sorts feedback by users and then items.
+func sortFeedback(feedback []Feedback) {
+	sort.Slice(feedback, func(i, j int) bool {
+		return lessFeedbackKey(feedback[i].FeedbackKey, feedback[j].FeedbackKey)
+	})
+}
+
+func lessFeedbackKey(a, b FeedbackKey) bool {
+	if a.UserId != b.UserId {
+		return a.UserId < b.UserId
+	}
+	if a.ItemId != b.ItemId {
+		return a.ItemId < b.ItemId
+	}
+	return a.FeedbackType < b.FeedbackType
+}
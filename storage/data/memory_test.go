@@ -0,0 +1,207 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testMemory struct {
+	Database
+}
+
+func newTestMemoryDatabase(t *testing.T) *testMemory {
+	database := new(testMemory)
+	var err error
+	database.Database, err = Open(memoryPrefix, "")
+	assert.Nil(t, err)
+	err = database.Init()
+	assert.Nil(t, err)
+	return database
+}
+
+func (db *testMemory) Close(t *testing.T) {
+	err := db.Database.Close()
+	assert.Nil(t, err)
+}
+
+func TestMemory_Users(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testUsers(t, db.Database)
+}
+
+func TestMemory_Feedback(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testFeedback(t, db.Database)
+}
+
+func TestMemory_FeedbackType(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testFeedbackType(t, db.Database)
+}
+
+func TestMemory_Item(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testItems(t, db.Database)
+}
+
+func TestMemory_DeleteUser(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testDeleteUser(t, db.Database)
+}
+
+func TestMemory_DeleteItem(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testDeleteItem(t, db.Database)
+}
+
+func TestMemory_ItemVisibility(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testItemVisibility(t, db.Database)
+}
+
+func TestMemory_Migrate(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testMigrate(t, db.Database)
+}
+
+func TestMemory_BatchInsert(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testBatchInsert(t, db.Database)
+}
+
+func TestMemory_CancelContext(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testCancelContext(t, db.Database)
+}
+
+func TestMemory_DeleteFeedback(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testDeleteFeedback(t, db.Database)
+}
+
+func TestMemory_UpdateItem(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testUpdateItem(t, db.Database)
+}
+
+func TestMemory_UpdateUser(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testUpdateUser(t, db.Database)
+}
+
+func TestMemory_Erasure(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testErasure(t, db.Database)
+}
+
+func TestMemory_CountFeedback(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	testCountFeedback(t, db.Database)
+}
+
+func TestMemory_Share(t *testing.T) {
+	db1, err := Open(memoryPrefix, "")
+	assert.Nil(t, err)
+	db2, err := Open(memoryPrefix, "")
+	assert.Nil(t, err)
+	// stores with the same path share data
+	err = db1.InsertUser(context.Background(), User{UserId: "0"})
+	assert.Nil(t, err)
+	user, err := db2.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, User{UserId: "0"}, user)
+	// data are kept until the last reference is closed
+	err = db1.Close()
+	assert.Nil(t, err)
+	_, err = db2.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+	db3, err := Open(memoryPrefix, "")
+	assert.Nil(t, err)
+	defer db3.Close()
+	_, err = db3.GetUser(context.Background(), "0")
+	assert.Equal(t, ErrUserNotExist, err.Error())
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := memoryPrefix + filepath.Join(dir, "snapshot")
+	// insert data
+	db, err := Open(path, "")
+	assert.Nil(t, err)
+	err = db.InsertItem(context.Background(), Item{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Labels: []string{"a"}})
+	assert.Nil(t, err)
+	err = db.InsertUser(context.Background(), User{UserId: "0", Labels: []string{"b"}})
+	assert.Nil(t, err)
+	err = db.InsertFeedback(context.Background(), Feedback{
+		FeedbackKey: FeedbackKey{"click", "0", "0"},
+		Timestamp:   time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
+		Value:       2,
+	}, false, false)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	// load data from snapshot
+	db, err = Open(path, "")
+	assert.Nil(t, err)
+	defer db.Close()
+	item, err := db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, Item{ItemId: "0", Timestamp: time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC), Labels: []string{"a"}}, item)
+	user, err := db.GetUser(context.Background(), "0")
+	assert.Nil(t, err)
+	assert.Equal(t, User{UserId: "0", Labels: []string{"b"}}, user)
+	feedback, err := db.GetItemFeedback(context.Background(), "click", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feedback{{
+		FeedbackKey: FeedbackKey{"click", "0", "0"},
+		Timestamp:   time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
+		Value:       2,
+		Count:       1,
+	}}, feedback)
+}
+
+func TestMemory_Namespace(t *testing.T) {
+	db := newTestMemoryDatabase(t)
+	defer db.Close(t)
+	tenantDB, err := Open(memoryPrefix, "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	testNamespace(t, db.Database, tenantDB)
+}
@@ -15,7 +15,9 @@ package data
 
 import (
 	"context"
+	"time"
 
+	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -24,68 +26,271 @@ import (
 type MongoDB struct {
 	client *mongo.Client
 	dbName string
+	// namespace prefixes names of collections.
+	namespace string
 }
 
+// collection returns the name of a collection in the namespace.
+func (db *MongoDB) collection(name string) string {
+	if db.namespace == "" {
+		return name
+	}
+	return db.namespace + "_" + name
+}
+
+// mongoMigration is a schema migration of MongoDB.
+type mongoMigration struct {
+	Migration
+	migrate func(db *MongoDB, ctx context.Context) error
+}
+
+// mongoMigrations are schema migrations of MongoDB in order. Migrations must be appended only.
+var mongoMigrations = []mongoMigration{
+	{Migration{1, "create collections of users, items and feedback"}, (*MongoDB).createCollections},
+	{Migration{2, "add count to feedback"}, (*MongoDB).addFeedbackCount},
+	{Migration{3, "create collection of erasures"}, (*MongoDB).createErasures},
+}
+
+// mongoIndex is a secondary index of MongoDB.
+type mongoIndex struct {
+	collection string
+	name       string
+	keys       bson.D
+}
+
+// mongoIndexes are secondary indexes created by Migrate once missing, regardless of versions of the schema. Feedback
+// are filtered by users or items along with feedback types, which turn into collection scans without these indexes.
+var mongoIndexes = []mongoIndex{
+	{"feedback", "user_id_feedback_type", bson.D{{Key: "_id.userid", Value: 1}, {Key: "_id.feedbacktype", Value: 1}}},
+	{"feedback", "item_id_feedback_type", bson.D{{Key: "_id.itemid", Value: 1}, {Key: "_id.feedbacktype", Value: 1}}},
+}
+
+// Init applies all pending schema migrations.
 func (db *MongoDB) Init() error {
-	ctx := context.Background()
-	d := db.client.Database(db.dbName)
-	if err := d.CreateCollection(ctx, "users"); err != nil {
+	_, err := db.Migrate(context.Background(), false)
+	return err
+}
+
+// Migrate applies pending schema migrations. Missing indexes are created after migrations are applied, so that
+// indexes dropped by accident are recreated as well.
+func (db *MongoDB) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("schema_version"))
+	// find the version of the schema
+	version := 0
+	opt := options.FindOne()
+	opt.SetSort(bson.M{"_id": -1})
+	var latest struct {
+		Version int `bson:"_id"`
+	}
+	if err := c.FindOne(ctx, bson.M{}, opt).Decode(&latest); err == nil {
+		version = latest.Version
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	// apply migrations
+	pending := make([]Migration, 0)
+	for _, migration := range mongoMigrations {
+		if migration.Version <= version {
+			continue
+		}
+		if !dryRun {
+			if err := migration.migrate(db, ctx); err != nil {
+				return pending, errors.Wrapf(err, "failed to apply migration %d", migration.Version)
+			}
+			if _, err := c.InsertOne(ctx, bson.M{
+				"_id":         migration.Version,
+				"description": migration.Description,
+				"applied_at":  time.Now().UTC(),
+			}); err != nil {
+				return pending, err
+			}
+		}
+		pending = append(pending, migration.Migration)
+	}
+	if !dryRun {
+		if err := db.createIndexes(ctx); err != nil {
+			return pending, errors.Wrap(err, "failed to create indexes")
+		}
+	}
+	return pending, nil
+}
+
+// createIndexes creates missing indexes. Existed indexes are skipped.
+func (db *MongoDB) createIndexes(ctx context.Context) error {
+	missing, err := db.missingIndexes(ctx)
+	if err != nil {
 		return err
 	}
-	if err := d.CreateCollection(ctx, "items"); err != nil {
+	d := db.client.Database(db.dbName)
+	for _, index := range missing {
+		model := mongo.IndexModel{Keys: index.keys, Options: options.Index().SetName(index.name)}
+		if _, err = d.Collection(db.collection(index.collection)).Indexes().CreateOne(ctx, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingIndexes returns indexes not created yet.
+func (db *MongoDB) missingIndexes(ctx context.Context) ([]mongoIndex, error) {
+	d := db.client.Database(db.dbName)
+	existed := make(map[string]map[string]bool)
+	missing := make([]mongoIndex, 0)
+	for _, index := range mongoIndexes {
+		if _, listed := existed[index.collection]; !listed {
+			r, err := d.Collection(db.collection(index.collection)).Indexes().List(ctx)
+			if err != nil {
+				return nil, err
+			}
+			var specs []struct {
+				Name string `bson:"name"`
+			}
+			if err = r.All(ctx, &specs); err != nil {
+				return nil, err
+			}
+			existed[index.collection] = make(map[string]bool)
+			for _, spec := range specs {
+				existed[index.collection][spec.Name] = true
+			}
+		}
+		if !existed[index.collection][index.name] {
+			missing = append(missing, index)
+		}
+	}
+	return missing, nil
+}
+
+// MissingIndexes returns names of indexes not created yet, in the form of "collection.index".
+func (db *MongoDB) MissingIndexes(ctx context.Context) ([]string, error) {
+	missing, err := db.missingIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(missing))
+	for i, index := range missing {
+		names[i] = db.collection(index.collection) + "." + index.name
+	}
+	return names, nil
+}
+
+// createCollections creates collections of users, items and feedback. Existed collections are skipped.
+func (db *MongoDB) createCollections(ctx context.Context) error {
+	return db.createCollection(ctx, "users", "items", "feedback")
+}
+
+// createErasures creates the collection of erasures.
+func (db *MongoDB) createErasures(ctx context.Context) error {
+	return db.createCollection(ctx, "erasures")
+}
+
+// createCollection creates collections in the namespace. Existed collections are skipped.
+func (db *MongoDB) createCollection(ctx context.Context, collections ...string) error {
+	d := db.client.Database(db.dbName)
+	names, err := d.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
 		return err
 	}
-	return d.CreateCollection(ctx, "feedback")
+	existed := make(map[string]bool)
+	for _, name := range names {
+		existed[name] = true
+	}
+	for _, name := range collections {
+		if name = db.collection(name); !existed[name] {
+			if err = d.CreateCollection(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addFeedbackCount adds counts to feedback. Existed feedback are counted once.
+func (db *MongoDB) addFeedbackCount(ctx context.Context) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("feedback"))
+	_, err := c.UpdateMany(ctx, bson.M{"count": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"count": 1}})
+	return err
 }
 
 func (db *MongoDB) Close() error {
 	return db.client.Disconnect(context.Background())
 }
 
-func (db *MongoDB) InsertItem(item Item) error {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("items")
+func (db *MongoDB) InsertItem(ctx context.Context, item Item) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("items"))
 	_, err := c.InsertOne(ctx, item)
 	return err
 }
 
-func (db *MongoDB) BatchInsertItem(items []Item) error {
-	for _, item := range items {
-		if err := db.InsertItem(item); err != nil {
-			return err
+func (db *MongoDB) BatchInsertItem(ctx context.Context, items []Item) error {
+	batchError := newBatchError()
+	for i, item := range items {
+		if err := db.InsertItem(ctx, item); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			batchError.Errors[i] = err
 		}
 	}
-	return nil
+	return batchError.errorOrNil()
+}
+
+func (db *MongoDB) UpsertItem(ctx context.Context, item Item) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("items"))
+	_, err := c.ReplaceOne(ctx, bson.M{"_id": item.ItemId}, item, options.Replace().SetUpsert(true))
+	return err
 }
 
-func (db *MongoDB) DeleteItem(itemId string) error {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("items")
+func (db *MongoDB) UpdateItem(ctx context.Context, itemId string, patch ItemPatch) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("items"))
+	set := bson.M{}
+	if patch.Timestamp != nil {
+		set["timestamp"] = *patch.Timestamp
+	}
+	if patch.Labels != nil {
+		set["labels"] = patch.Labels
+	}
+	if patch.ExpireTime != nil {
+		set["expiretime"] = *patch.ExpireTime
+	} else if patch.ClearExpireTime {
+		set["expiretime"] = nil
+	}
+	if patch.Hidden != nil {
+		set["hidden"] = *patch.Hidden
+	}
+	return db.updateOne(ctx, c, itemId, set, ErrItemNotExist)
+}
+
+func (db *MongoDB) DeleteItem(ctx context.Context, itemId string) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("items"))
 	_, err := c.DeleteOne(ctx, bson.M{"_id": itemId})
 	if err != nil {
 		return err
 	}
-	c = db.client.Database(db.dbName).Collection("feedback")
+	c = db.client.Database(db.dbName).Collection(db.collection("feedback"))
 	_, err = c.DeleteMany(ctx, bson.M{
 		"_id.itemid": bson.M{"$eq": itemId},
 	})
 	return err
 }
 
-func (db *MongoDB) GetItem(itemId string) (item Item, err error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("items")
+func (db *MongoDB) GetItem(ctx context.Context, itemId string) (item Item, err error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("items"))
 	r := c.FindOne(ctx, bson.M{"_id": itemId})
-	err = r.Decode(&item)
+	if err = r.Decode(&item); err == mongo.ErrNoDocuments {
+		err = errors.New(ErrItemNotExist)
+	}
 	return
 }
 
-func (db *MongoDB) GetItems(cursor string, n int) (string, []Item, error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("items")
+func (db *MongoDB) GetItems(ctx context.Context, cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("items"))
 	opt := options.Find()
 	opt.SetLimit(int64(n))
-	r, err := c.Find(ctx, bson.M{"_id": bson.M{"$gt": cursor}}, opt)
+	filter := bson.M{"_id": bson.M{"$gt": cursor}}
+	if timeLimit != nil {
+		filter["timestamp"] = bson.M{"$gte": *timeLimit}
+	}
+	r, err := c.Find(ctx, filter, opt)
 	if err != nil {
 		return "", nil, err
 	}
@@ -105,9 +310,8 @@ func (db *MongoDB) GetItems(cursor string, n int) (string, []Item, error) {
 	return cursor, items, nil
 }
 
-func (db *MongoDB) GetItemFeedback(feedbackType, itemId string) ([]Feedback, error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("feedback")
+func (db *MongoDB) GetItemFeedback(ctx context.Context, feedbackType, itemId string) ([]Feedback, error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("feedback"))
 	r, err := c.Find(ctx, bson.M{
 		"_id.feedbacktype": bson.M{"$eq": feedbackType},
 		"_id.itemid":       bson.M{"$eq": itemId},
@@ -117,7 +321,7 @@ func (db *MongoDB) GetItemFeedback(feedbackType, itemId string) ([]Feedback, err
 	}
 	feedbacks := make([]Feedback, 0)
 	for r.Next(ctx) {
-		var feedback Feedback
+		feedback := Feedback{Value: DefaultFeedbackValue}
 		if err = r.Decode(&feedback); err != nil {
 			return nil, err
 		}
@@ -126,38 +330,88 @@ func (db *MongoDB) GetItemFeedback(feedbackType, itemId string) ([]Feedback, err
 	return feedbacks, nil
 }
 
-func (db *MongoDB) InsertUser(user User) error {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("users")
+func (db *MongoDB) InsertUser(ctx context.Context, user User) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("users"))
 	_, err := c.InsertOne(ctx, user)
 	return err
 }
 
-func (db *MongoDB) DeleteUser(userId string) error {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("users")
+func (db *MongoDB) UpsertUser(ctx context.Context, user User) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("users"))
+	_, err := c.ReplaceOne(ctx, bson.M{"_id": user.UserId}, user, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (db *MongoDB) UpdateUser(ctx context.Context, userId string, patch UserPatch) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("users"))
+	set := bson.M{}
+	if patch.Labels != nil {
+		set["labels"] = patch.Labels
+	}
+	return db.updateOne(ctx, c, userId, set, ErrUserNotExist)
+}
+
+// updateOne sets fields of a document. The error message notExist is returned if the document doesn't exist.
+func (db *MongoDB) updateOne(ctx context.Context, c *mongo.Collection, id string, set bson.M, notExist string) error {
+	var matched int64
+	if len(set) == 0 {
+		count, err := c.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		matched = count
+	} else {
+		r, err := c.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+		if err != nil {
+			return err
+		}
+		matched = r.MatchedCount
+	}
+	if matched == 0 {
+		return errors.New(notExist)
+	}
+	return nil
+}
+
+func (db *MongoDB) DeleteUser(ctx context.Context, userId string) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("users"))
 	_, err := c.DeleteOne(ctx, bson.M{"_id": userId})
 	if err != nil {
 		return err
 	}
-	c = db.client.Database(db.dbName).Collection("feedback")
+	c = db.client.Database(db.dbName).Collection(db.collection("feedback"))
 	_, err = c.DeleteMany(ctx, bson.M{
 		"_id.userid": bson.M{"$eq": userId},
 	})
 	return err
 }
 
-func (db *MongoDB) GetUser(userId string) (user User, err error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("users")
+func (db *MongoDB) GetUser(ctx context.Context, userId string) (user User, err error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("users"))
+	r := c.FindOne(ctx, bson.M{"_id": userId})
+	if err = r.Decode(&user); err == mongo.ErrNoDocuments {
+		err = errors.New(ErrUserNotExist)
+	}
+	return
+}
+
+func (db *MongoDB) PutErasure(ctx context.Context, erasure Erasure) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("erasures"))
+	_, err := c.ReplaceOne(ctx, bson.M{"_id": erasure.UserId}, erasure, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (db *MongoDB) GetErasure(ctx context.Context, userId string) (erasure Erasure, err error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("erasures"))
 	r := c.FindOne(ctx, bson.M{"_id": userId})
-	err = r.Decode(&user)
+	if err = r.Decode(&erasure); err == mongo.ErrNoDocuments {
+		err = errors.New(ErrErasureNotExist)
+	}
 	return
 }
 
-func (db *MongoDB) GetUsers(cursor string, n int) (string, []User, error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("users")
+func (db *MongoDB) GetUsers(ctx context.Context, cursor string, n int) (string, []User, error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("users"))
 	opt := options.Find()
 	opt.SetLimit(int64(n))
 	r, err := c.Find(ctx, bson.M{"_id": bson.M{"$gt": cursor}}, opt)
@@ -180,9 +434,8 @@ func (db *MongoDB) GetUsers(cursor string, n int) (string, []User, error) {
 	return cursor, users, nil
 }
 
-func (db *MongoDB) GetUserFeedback(feedbackType, userId string) ([]Feedback, error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("feedback")
+func (db *MongoDB) GetUserFeedback(ctx context.Context, feedbackType, userId string) ([]Feedback, error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("feedback"))
 	r, err := c.Find(ctx, bson.M{
 		"_id.feedbacktype": bson.M{"$eq": feedbackType},
 		"_id.userid":       bson.M{"$eq": userId},
@@ -192,7 +445,7 @@ func (db *MongoDB) GetUserFeedback(feedbackType, userId string) ([]Feedback, err
 	}
 	feedbacks := make([]Feedback, 0)
 	for r.Next(ctx) {
-		var feedback Feedback
+		feedback := Feedback{Value: DefaultFeedbackValue}
 		if err = r.Decode(&feedback); err != nil {
 			return nil, err
 		}
@@ -201,19 +454,33 @@ func (db *MongoDB) GetUserFeedback(feedbackType, userId string) ([]Feedback, err
 	return feedbacks, nil
 }
 
-func (db *MongoDB) InsertFeedback(feedback Feedback, insertUser, insertItem bool) error {
-	ctx := context.Background()
+func (db *MongoDB) InsertFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
+	feedback.Count = 1
+	return db.insertFeedback(ctx, feedback, bson.M{"$set": feedback}, insertUser, insertItem)
+}
+
+// countFeedback inserts a piece of feedback, or increases the count and updates the timestamp of existed feedback.
+func (db *MongoDB) countFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
+	return db.insertFeedback(ctx, feedback, bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$set":         bson.M{"timestamp": feedback.Timestamp},
+		"$setOnInsert": bson.M{"value": feedback.Value},
+	}, insertUser, insertItem)
+}
+
+// insertFeedback upserts a piece of feedback by an update.
+func (db *MongoDB) insertFeedback(ctx context.Context, feedback Feedback, update bson.M, insertUser, insertItem bool) error {
 	opt := options.Update()
 	opt.SetUpsert(true)
 	// insert feedback
-	c := db.client.Database(db.dbName).Collection("feedback")
-	_, err := c.UpdateOne(ctx, bson.M{"_id": feedback.FeedbackKey}, bson.M{"$set": feedback}, opt)
+	c := db.client.Database(db.dbName).Collection(db.collection("feedback"))
+	_, err := c.UpdateOne(ctx, bson.M{"_id": feedback.FeedbackKey}, update, opt)
 	if err != nil {
 		return err
 	}
 	// insert user
 	if insertUser {
-		c = db.client.Database(db.dbName).Collection("users")
+		c = db.client.Database(db.dbName).Collection(db.collection("users"))
 		_, err = c.UpdateOne(ctx, bson.M{"_id": feedback.UserId}, bson.M{"$set": bson.M{"_id": feedback.UserId}}, opt)
 		if err != nil {
 			return err
@@ -221,7 +488,7 @@ func (db *MongoDB) InsertFeedback(feedback Feedback, insertUser, insertItem bool
 	}
 	// insert item
 	if insertItem {
-		c = db.client.Database(db.dbName).Collection("items")
+		c = db.client.Database(db.dbName).Collection(db.collection("items"))
 		_, err = c.UpdateOne(ctx, bson.M{"_id": feedback.ItemId}, bson.M{"$set": bson.M{"_id": feedback.ItemId}}, opt)
 		if err != nil {
 			return err
@@ -230,18 +497,40 @@ func (db *MongoDB) InsertFeedback(feedback Feedback, insertUser, insertItem bool
 	return nil
 }
 
-func (db *MongoDB) BatchInsertFeedback(feedback []Feedback, insertUser, insertItem bool) error {
-	for _, f := range feedback {
-		if err := db.InsertFeedback(f, insertUser, insertItem); err != nil {
-			return err
+func (db *MongoDB) BatchInsertFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	batchError := newBatchError()
+	for i, f := range feedback {
+		if err := db.InsertFeedback(ctx, f, insertUser, insertItem); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			batchError.Errors[i] = err
 		}
 	}
-	return nil
+	return batchError.errorOrNil()
+}
+
+func (db *MongoDB) BatchCountFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	batchError := newBatchError()
+	for i, f := range feedback {
+		if err := db.countFeedback(ctx, f, insertUser, insertItem); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			batchError.Errors[i] = err
+		}
+	}
+	return batchError.errorOrNil()
 }
 
-func (db *MongoDB) GetFeedback(feedbackType, cursor string, n int) (string, []Feedback, error) {
-	ctx := context.Background()
-	c := db.client.Database(db.dbName).Collection("feedback")
+func (db *MongoDB) DeleteFeedback(ctx context.Context, key FeedbackKey) error {
+	c := db.client.Database(db.dbName).Collection(db.collection("feedback"))
+	_, err := c.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (db *MongoDB) GetFeedback(ctx context.Context, feedbackType, cursor string, n int, timeLimit *time.Time) (string, []Feedback, error) {
+	c := db.client.Database(db.dbName).Collection(db.collection("feedback"))
 	opt := options.Find()
 	opt.SetLimit(int64(n))
 	var filter bson.M
@@ -259,13 +548,16 @@ func (db *MongoDB) GetFeedback(feedbackType, cursor string, n int) (string, []Fe
 			"_id":              bson.M{"$gt": feedbackKey},
 		}
 	}
+	if timeLimit != nil {
+		filter["timestamp"] = bson.M{"$gte": *timeLimit}
+	}
 	r, err := c.Find(ctx, filter, opt)
 	if err != nil {
 		return "", nil, err
 	}
 	feedbacks := make([]Feedback, 0)
 	for r.Next(ctx) {
-		var feedback Feedback
+		feedback := Feedback{Value: DefaultFeedbackValue}
 		if err = r.Decode(&feedback); err != nil {
 			return "", nil, err
 		}
@@ -57,7 +57,7 @@ func newTestMongoDatabase(t *testing.T, dbName string) *testMongoDatabase {
 	database := new(testMongoDatabase)
 	var err error
 	// create database
-	database.Database, err = Open(mongoUri)
+	database.Database, err = Open(mongoUri, "")
 	assert.Nil(t, err)
 	dbName = "gorse_" + dbName
 	databaseComm := database.GetMongoDB(t)
@@ -85,6 +85,12 @@ func TestMongoDatabase_Feedback(t *testing.T) {
 	testFeedback(t, db.Database)
 }
 
+func TestMongoDatabase_FeedbackType(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_FeedbackType")
+	defer db.Close(t)
+	testFeedbackType(t, db.Database)
+}
+
 func TestMongoDatabase_Item(t *testing.T) {
 	db := newTestMongoDatabase(t, "TestSQLDatabase_Item")
 	defer db.Close(t)
@@ -102,3 +108,91 @@ func TestMongoDatabase_DeleteItem(t *testing.T) {
 	defer db.Close(t)
 	testDeleteItem(t, db.Database)
 }
+
+func TestMongoDatabase_ItemVisibility(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_ItemVisibility")
+	defer db.Close(t)
+	testItemVisibility(t, db.Database)
+}
+
+func TestMongoDatabase_Migrate(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_Migrate")
+	defer db.Close(t)
+	testMigrate(t, db.Database)
+}
+
+func TestMongoDatabase_BatchInsert(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_BatchInsert")
+	defer db.Close(t)
+	testBatchInsert(t, db.Database)
+}
+
+func TestMongoDatabase_CancelContext(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_CancelContext")
+	defer db.Close(t)
+	testCancelContext(t, db.Database)
+}
+
+func TestMongoDatabase_DeleteFeedback(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_DeleteFeedback")
+	defer db.Close(t)
+	testDeleteFeedback(t, db.Database)
+}
+
+func TestMongoDatabase_UpdateItem(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_UpdateItem")
+	defer db.Close(t)
+	testUpdateItem(t, db.Database)
+}
+
+func TestMongoDatabase_UpdateUser(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_UpdateUser")
+	defer db.Close(t)
+	testUpdateUser(t, db.Database)
+}
+
+func TestMongoDatabase_Erasure(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_Erasure")
+	defer db.Close(t)
+	testErasure(t, db.Database)
+}
+
+func TestMongoDatabase_CountFeedback(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_CountFeedback")
+	defer db.Close(t)
+	testCountFeedback(t, db.Database)
+}
+
+func TestMongoDatabase_Namespace(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_Namespace")
+	defer db.Close(t)
+	tenantDB, err := Open(mongoUri, "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	tenantDB.(*MongoDB).dbName = db.GetMongoDB(t).dbName
+	err = tenantDB.Init()
+	assert.Nil(t, err)
+	testNamespace(t, db.Database, tenantDB)
+}
+
+func TestMongoDatabase_Indexes(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestSQLDatabase_Indexes")
+	defer db.Close(t)
+	ctx := context.Background()
+	mongoDB := db.GetMongoDB(t)
+	// all indexes have been created by Init
+	missing, err := mongoDB.MissingIndexes(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, missing)
+	// dropped indexes are reported and recreated by migration
+	_, err = mongoDB.client.Database(mongoDB.dbName).Collection("feedback").Indexes().DropOne(ctx, "user_id_feedback_type")
+	assert.Nil(t, err)
+	missing, err = mongoDB.MissingIndexes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"feedback.user_id_feedback_type"}, missing)
+	_, err = mongoDB.Migrate(ctx, false)
+	assert.Nil(t, err)
+	missing, err = mongoDB.MissingIndexes(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, missing)
+}
@@ -16,9 +16,11 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-redis/redis/v8"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -29,53 +31,136 @@ const (
 	prefixItem       = "item/"        // prefix for items
 	prefixUser       = "user/"        // prefix for users
 	prefixFeedback   = "feedback/"    // prefix for feedback
+	prefixErasure    = "erasure/"     // prefix for erasures
 )
 
+// redisNil is redis.Nil, which is shadowed by receivers of Redis.
+var redisNil = redis.Nil
+
+// redisTx and redisPipeliner are redis.Tx and redis.Pipeliner, which are shadowed by receivers of Redis.
+type redisTx = redis.Tx
+type redisPipeliner = redis.Pipeliner
+
+// redisTxFailedErr is redis.TxFailedErr, which is shadowed by receivers of Redis.
+var redisTxFailedErr = redis.TxFailedErr
+
+// redisMaxRetries is the max number of retries of optimistic transactions.
+const redisMaxRetries = 100
+
 type Redis struct {
 	client *redis.Client
+	// namespace prefixes keys.
+	namespace string
+}
+
+// key returns a key in the namespace.
+func (redis *Redis) key(key string) string {
+	if redis.namespace == "" {
+		return key
+	}
+	return redis.namespace + ":" + key
 }
 
 func (redis *Redis) Init() error {
 	return nil
 }
 
+// Migrate does nothing since Redis is schemaless.
+func (redis *Redis) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	return []Migration{}, nil
+}
+
 func (redis *Redis) Close() error {
 	return redis.client.Close()
 }
 
-func (redis *Redis) InsertItem(item Item) error {
-	var ctx = context.Background()
+func (redis *Redis) InsertItem(ctx context.Context, item Item) error {
 	// write item
 	data, err := json.Marshal(item)
 	if err != nil {
 		return err
 	}
-	if err = redis.client.Set(ctx, prefixItem+item.ItemId, data, 0).Err(); err != nil {
+	if err = redis.client.Set(ctx, redis.key(prefixItem+item.ItemId), data, 0).Err(); err != nil {
 		return err
 	}
 	// write index
 	for _, label := range item.Labels {
 		// inset label index
-		if err = redis.client.SAdd(ctx, prefixLabelIndex+label, item.ItemId).Err(); err != nil {
+		if err = redis.client.SAdd(ctx, redis.key(prefixLabelIndex+label), item.ItemId).Err(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (redis *Redis) BatchInsertItem(items []Item) error {
-	for _, item := range items {
-		if err := redis.InsertItem(item); err != nil {
+func (redis *Redis) BatchInsertItem(ctx context.Context, items []Item) error {
+	batchError := newBatchError()
+	pipe := redis.client.Pipeline()
+	rows := make([]int, 0, len(items))
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			batchError.Errors[i] = err
+			continue
+		}
+		// write item
+		pipe.Set(ctx, redis.key(prefixItem+item.ItemId), data, 0)
+		rows = append(rows, i)
+		// write index
+		for _, label := range item.Labels {
+			pipe.SAdd(ctx, redis.key(prefixLabelIndex+label), item.ItemId)
+			rows = append(rows, i)
+		}
+	}
+	return execPipeline(ctx, pipe, rows, batchError)
+}
+
+func (redis *Redis) UpsertItem(ctx context.Context, item Item) error {
+	// remove item from indices of outdated labels
+	if exist, err := redis.client.Exists(ctx, redis.key(prefixItem+item.ItemId)).Result(); err != nil {
+		return err
+	} else if exist > 0 {
+		oldItem, err := redis.GetItem(ctx, item.ItemId)
+		if err != nil {
 			return err
 		}
+		for _, label := range oldItem.Labels {
+			if err = redis.client.SRem(ctx, redis.key(prefixLabelIndex+label), item.ItemId).Err(); err != nil {
+				return err
+			}
+		}
 	}
-	return nil
+	return redis.InsertItem(ctx, item)
 }
 
-func (redis *Redis) DeleteItem(itemId string) error {
-	var ctx = context.Background()
+func (redis *Redis) UpdateItem(ctx context.Context, itemId string, patch ItemPatch) error {
+	if exist, err := redis.client.Exists(ctx, redis.key(prefixItem+itemId)).Result(); err != nil {
+		return err
+	} else if exist == 0 {
+		return errors.New(ErrItemNotExist)
+	}
+	item, err := redis.GetItem(ctx, itemId)
+	if err != nil {
+		return err
+	}
+	if patch.Timestamp != nil {
+		item.Timestamp = *patch.Timestamp
+	}
+	if patch.Labels != nil {
+		item.Labels = patch.Labels
+	}
+	if patch.ExpireTime != nil || patch.ClearExpireTime {
+		item.ExpireTime = patch.ExpireTime
+	}
+	if patch.Hidden != nil {
+		item.Hidden = *patch.Hidden
+	}
+	return redis.UpsertItem(ctx, item)
+}
+
+func (redis *Redis) DeleteItem(ctx context.Context, itemId string) error {
 	// remove user
-	if err := redis.client.Del(ctx, prefixItem+itemId).Err(); err != nil {
+	if err := redis.client.Del(ctx, redis.key(prefixItem+itemId)).Err(); err != nil {
 		return err
 	}
 	// remove feedback
@@ -83,24 +168,24 @@ func (redis *Redis) DeleteItem(itemId string) error {
 	var err error
 	var keys []string
 	for {
-		keys, cursor, err = redis.client.Scan(ctx, cursor, prefixItemIndex+itemId+"*", 0).Result()
+		keys, cursor, err = redis.client.Scan(ctx, cursor, redis.key(prefixItemIndex+itemId+"*"), 0).Result()
 		if err != nil {
 			return err
 		}
 		for _, key := range keys {
 			_, tp := parseItemIndexKey(key)
 			// remove feedbacks
-			userIds, err := redis.client.SMembers(ctx, createItemIndexKey(tp, itemId)).Result()
+			userIds, err := redis.client.SMembers(ctx, redis.key(createItemIndexKey(tp, itemId))).Result()
 			if err != nil {
 				return err
 			}
 			for _, userId := range userIds {
-				if err = redis.client.Del(ctx, createFeedbackKey(FeedbackKey{tp, userId, itemId})).Err(); err != nil {
+				if err = redis.client.Del(ctx, redis.key(createFeedbackKey(FeedbackKey{tp, userId, itemId}))).Err(); err != nil {
 					return err
 				}
 			}
 			// remove index
-			if err = redis.client.Del(ctx, createItemIndexKey(tp, itemId)).Err(); err != nil {
+			if err = redis.client.Del(ctx, redis.key(createItemIndexKey(tp, itemId))).Err(); err != nil {
 				return err
 			}
 		}
@@ -111,10 +196,11 @@ func (redis *Redis) DeleteItem(itemId string) error {
 	return nil
 }
 
-func (redis *Redis) GetItem(itemId string) (Item, error) {
-	var ctx = context.Background()
-	data, err := redis.client.Get(ctx, prefixItem+itemId).Result()
-	if err != nil {
+func (redis *Redis) GetItem(ctx context.Context, itemId string) (Item, error) {
+	data, err := redis.client.Get(ctx, redis.key(prefixItem+itemId)).Result()
+	if err == redisNil {
+		return Item{}, errors.New(ErrItemNotExist)
+	} else if err != nil {
 		return Item{}, err
 	}
 	var item Item
@@ -122,8 +208,7 @@ func (redis *Redis) GetItem(itemId string) (Item, error) {
 	return item, err
 }
 
-func (redis *Redis) GetItems(cursor string, n int) (string, []Item, error) {
-	var ctx = context.Background()
+func (redis *Redis) GetItems(ctx context.Context, cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	var err error
 	cursorNum := uint64(0)
 	if len(cursor) > 0 {
@@ -135,7 +220,7 @@ func (redis *Redis) GetItems(cursor string, n int) (string, []Item, error) {
 	items := make([]Item, 0)
 	// scan * from zero util cursor is zero
 	var keys []string
-	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, prefixItem+"*", int64(n)).Result()
+	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, redis.key(prefixItem+"*"), int64(n)).Result()
 	if err != nil {
 		return "", nil, err
 	}
@@ -149,6 +234,9 @@ func (redis *Redis) GetItems(cursor string, n int) (string, []Item, error) {
 		if err != nil {
 			return "", nil, err
 		}
+		if timeLimit != nil && item.Timestamp.Before(*timeLimit) {
+			continue
+		}
 		items = append(items, item)
 	}
 	if cursorNum == 0 {
@@ -159,16 +247,15 @@ func (redis *Redis) GetItems(cursor string, n int) (string, []Item, error) {
 	return cursor, items, nil
 }
 
-func (redis *Redis) GetItemFeedback(feedbackType, itemId string) ([]Feedback, error) {
-	var ctx = context.Background()
+func (redis *Redis) GetItemFeedback(ctx context.Context, feedbackType, itemId string) ([]Feedback, error) {
 	feedback := make([]Feedback, 0)
-	userIds, err := redis.client.SMembers(ctx, createItemIndexKey(feedbackType, itemId)).Result()
+	userIds, err := redis.client.SMembers(ctx, redis.key(createItemIndexKey(feedbackType, itemId))).Result()
 	if err != nil {
 		return nil, err
 	}
 
 	for _, userId := range userIds {
-		val, err := redis.getFeedback(feedbackType, userId, itemId)
+		val, err := redis.getFeedback(ctx, feedbackType, userId, itemId)
 		if err != nil {
 			return nil, err
 		}
@@ -177,19 +264,37 @@ func (redis *Redis) GetItemFeedback(feedbackType, itemId string) ([]Feedback, er
 	return feedback, err
 }
 
-func (redis *Redis) InsertUser(user User) error {
-	var ctx = context.Background()
+func (redis *Redis) InsertUser(ctx context.Context, user User) error {
 	data, err := json.Marshal(user)
 	if err != nil {
 		return err
 	}
-	return redis.client.Set(ctx, prefixUser+user.UserId, data, 0).Err()
+	return redis.client.Set(ctx, redis.key(prefixUser+user.UserId), data, 0).Err()
+}
+
+func (redis *Redis) UpsertUser(ctx context.Context, user User) error {
+	return redis.InsertUser(ctx, user)
+}
+
+func (redis *Redis) UpdateUser(ctx context.Context, userId string, patch UserPatch) error {
+	if exist, err := redis.client.Exists(ctx, redis.key(prefixUser+userId)).Result(); err != nil {
+		return err
+	} else if exist == 0 {
+		return errors.New(ErrUserNotExist)
+	}
+	user, err := redis.GetUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if patch.Labels != nil {
+		user.Labels = patch.Labels
+	}
+	return redis.InsertUser(ctx, user)
 }
 
-func (redis *Redis) DeleteUser(userId string) error {
-	var ctx = context.Background()
+func (redis *Redis) DeleteUser(ctx context.Context, userId string) error {
 	// remove user
-	if err := redis.client.Del(ctx, prefixUser+userId).Err(); err != nil {
+	if err := redis.client.Del(ctx, redis.key(prefixUser+userId)).Err(); err != nil {
 		return err
 	}
 	// remove feedback
@@ -197,24 +302,24 @@ func (redis *Redis) DeleteUser(userId string) error {
 	var err error
 	var keys []string
 	for {
-		keys, cursor, err = redis.client.Scan(ctx, cursor, prefixUserIndex+userId+"*", 0).Result()
+		keys, cursor, err = redis.client.Scan(ctx, cursor, redis.key(prefixUserIndex+userId+"*"), 0).Result()
 		if err != nil {
 			return err
 		}
 		for _, key := range keys {
 			_, tp := parseUserIndexKey(key)
 			// remove feedbacks
-			itemIds, err := redis.client.SMembers(ctx, createUserIndexKey(tp, userId)).Result()
+			itemIds, err := redis.client.SMembers(ctx, redis.key(createUserIndexKey(tp, userId))).Result()
 			if err != nil {
 				return err
 			}
 			for _, itemId := range itemIds {
-				if err = redis.client.Del(ctx, createFeedbackKey(FeedbackKey{tp, userId, itemId})).Err(); err != nil {
+				if err = redis.client.Del(ctx, redis.key(createFeedbackKey(FeedbackKey{tp, userId, itemId}))).Err(); err != nil {
 					return err
 				}
 			}
 			// remove index
-			if err = redis.client.Del(ctx, createUserIndexKey(tp, userId)).Err(); err != nil {
+			if err = redis.client.Del(ctx, redis.key(createUserIndexKey(tp, userId))).Err(); err != nil {
 				return err
 			}
 		}
@@ -225,10 +330,11 @@ func (redis *Redis) DeleteUser(userId string) error {
 	return nil
 }
 
-func (redis *Redis) GetUser(userId string) (User, error) {
-	var ctx = context.Background()
-	val, err := redis.client.Get(ctx, prefixUser+userId).Result()
-	if err != nil {
+func (redis *Redis) GetUser(ctx context.Context, userId string) (User, error) {
+	val, err := redis.client.Get(ctx, redis.key(prefixUser+userId)).Result()
+	if err == redisNil {
+		return User{}, errors.New(ErrUserNotExist)
+	} else if err != nil {
 		return User{}, err
 	}
 	var user User
@@ -239,8 +345,29 @@ func (redis *Redis) GetUser(userId string) (User, error) {
 	return user, err
 }
 
-func (redis *Redis) GetUsers(cursor string, n int) (string, []User, error) {
-	var ctx = context.Background()
+func (redis *Redis) PutErasure(ctx context.Context, erasure Erasure) error {
+	data, err := json.Marshal(erasure)
+	if err != nil {
+		return err
+	}
+	return redis.client.Set(ctx, redis.key(prefixErasure+erasure.UserId), data, 0).Err()
+}
+
+func (redis *Redis) GetErasure(ctx context.Context, userId string) (Erasure, error) {
+	val, err := redis.client.Get(ctx, redis.key(prefixErasure+userId)).Result()
+	if err == redisNil {
+		return Erasure{}, errors.New(ErrErasureNotExist)
+	} else if err != nil {
+		return Erasure{}, err
+	}
+	var erasure Erasure
+	if err = json.Unmarshal([]byte(val), &erasure); err != nil {
+		return Erasure{}, err
+	}
+	return erasure, nil
+}
+
+func (redis *Redis) GetUsers(ctx context.Context, cursor string, n int) (string, []User, error) {
 	var err error
 	cursorNum := uint64(0)
 	if len(cursor) > 0 {
@@ -251,7 +378,7 @@ func (redis *Redis) GetUsers(cursor string, n int) (string, []User, error) {
 	}
 	users := make([]User, 0)
 	var keys []string
-	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, prefixUser+"*", int64(n)).Result()
+	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, redis.key(prefixUser+"*"), int64(n)).Result()
 	if err != nil {
 		return "", nil, err
 	}
@@ -275,18 +402,17 @@ func (redis *Redis) GetUsers(cursor string, n int) (string, []User, error) {
 	return cursor, users, nil
 }
 
-func (redis *Redis) GetUserFeedback(feedbackType, userId string) ([]Feedback, error) {
-	var ctx = context.Background()
+func (redis *Redis) GetUserFeedback(ctx context.Context, feedbackType, userId string) ([]Feedback, error) {
 	feedback := make([]Feedback, 0)
 
 	// get itemId list by userId
-	itemIds, err := redis.client.SMembers(ctx, createUserIndexKey(feedbackType, userId)).Result()
+	itemIds, err := redis.client.SMembers(ctx, redis.key(createUserIndexKey(feedbackType, userId))).Result()
 	if err != nil {
 		return nil, err
 	}
 	// get feedback by itemId and userId
 	for _, itemId := range itemIds {
-		val, err := redis.getFeedback(feedbackType, userId, itemId)
+		val, err := redis.getFeedback(ctx, feedbackType, userId, itemId)
 		if err != nil {
 			return nil, err
 		}
@@ -295,11 +421,10 @@ func (redis *Redis) GetUserFeedback(feedbackType, userId string) ([]Feedback, er
 	return feedback, err
 }
 
-func (redis *Redis) getFeedback(tp, userId, itemId string) (Feedback, error) {
-	var ctx = context.Background()
+func (redis *Redis) getFeedback(ctx context.Context, tp, userId, itemId string) (Feedback, error) {
 	feedbackKey := FeedbackKey{FeedbackType: tp, UserId: userId, ItemId: itemId}
 	// get feedback by feedbackKey
-	val, err := redis.client.Get(ctx, createFeedbackKey(feedbackKey)).Result()
+	val, err := redis.client.Get(ctx, redis.key(createFeedbackKey(feedbackKey))).Result()
 	if err != nil {
 		return Feedback{}, err
 	}
@@ -333,20 +458,63 @@ func parseItemIndexKey(key string) (itemId, tp string) {
 	return fields[1], fields[3]
 }
 
-func (redis *Redis) InsertFeedback(feedback Feedback, insertUser, insertItem bool) error {
-	var ctx = context.Background()
+func (redis *Redis) InsertFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
+	feedback.Count = 1
 	val, err := json.Marshal(feedback)
 	if err != nil {
 		return err
 	}
 	// insert feedback
-	err = redis.client.Set(ctx, createFeedbackKey(feedback.FeedbackKey), val, 0).Err()
+	err = redis.client.Set(ctx, redis.key(createFeedbackKey(feedback.FeedbackKey)), val, 0).Err()
 	if err != nil {
 		return err
 	}
+	return redis.insertFeedbackIndex(ctx, feedback, insertUser, insertItem)
+}
+
+// countFeedback inserts a piece of feedback, or increases the count and updates the timestamp of existed feedback.
+func (redis *Redis) countFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
+	key := redis.key(createFeedbackKey(feedback.FeedbackKey))
+	count := func(tx *redisTx) error {
+		feedback.Count = 1
+		if val, err := tx.Get(ctx, key).Result(); err == nil {
+			var existed Feedback
+			if err = json.Unmarshal([]byte(val), &existed); err != nil {
+				return err
+			}
+			feedback.Count += existed.Count
+			feedback.Value = existed.Value
+		} else if err != redisNil {
+			return err
+		}
+		val, err := json.Marshal(feedback)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redisPipeliner) error {
+			return pipe.Set(ctx, key, val, 0).Err()
+		})
+		return err
+	}
+	// retry if the feedback is modified concurrently
+	var err error
+	for i := 0; i < redisMaxRetries; i++ {
+		if err = redis.client.Watch(ctx, count, key); err != redisTxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return redis.insertFeedbackIndex(ctx, feedback, insertUser, insertItem)
+}
+
+// insertFeedbackIndex inserts the user, the item and indices of a piece of feedback.
+func (redis *Redis) insertFeedbackIndex(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
+	var err error
 	// insert user
 	if insertUser {
-		if exist, err := redis.client.Exists(ctx, prefixUser+feedback.UserId).Result(); err != nil {
+		if exist, err := redis.client.Exists(ctx, redis.key(prefixUser+feedback.UserId)).Result(); err != nil {
 			return err
 		} else if exist == 0 {
 			user := User{UserId: feedback.UserId}
@@ -354,14 +522,14 @@ func (redis *Redis) InsertFeedback(feedback Feedback, insertUser, insertItem boo
 			if err != nil {
 				return err
 			}
-			if err = redis.client.Set(ctx, prefixUser+feedback.UserId, data, 0).Err(); err != nil {
+			if err = redis.client.Set(ctx, redis.key(prefixUser+feedback.UserId), data, 0).Err(); err != nil {
 				return err
 			}
 		}
 	}
 	// Insert item
 	if insertItem {
-		if exist, err := redis.client.Exists(ctx, prefixItem+feedback.ItemId).Result(); err != nil {
+		if exist, err := redis.client.Exists(ctx, redis.key(prefixItem+feedback.ItemId)).Result(); err != nil {
 			return err
 		} else if exist == 0 {
 			item := Item{ItemId: feedback.ItemId}
@@ -369,33 +537,108 @@ func (redis *Redis) InsertFeedback(feedback Feedback, insertUser, insertItem boo
 			if err != nil {
 				return err
 			}
-			if err = redis.client.Set(ctx, prefixItem+feedback.ItemId, data, 0).Err(); err != nil {
+			if err = redis.client.Set(ctx, redis.key(prefixItem+feedback.ItemId), data, 0).Err(); err != nil {
 				return err
 			}
 		}
 	}
 	// insert user index
-	if err = redis.client.SAdd(ctx, createUserIndexKey(feedback.FeedbackType, feedback.UserId), feedback.ItemId).Err(); err != nil {
+	if err = redis.client.SAdd(ctx, redis.key(createUserIndexKey(feedback.FeedbackType, feedback.UserId)), feedback.ItemId).Err(); err != nil {
 		return err
 	}
 	// insert item index
-	if err = redis.client.SAdd(ctx, createItemIndexKey(feedback.FeedbackType, feedback.ItemId), feedback.UserId).Err(); err != nil {
+	if err = redis.client.SAdd(ctx, redis.key(createItemIndexKey(feedback.FeedbackType, feedback.ItemId)), feedback.UserId).Err(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (redis *Redis) BatchInsertFeedback(feedback []Feedback, insertUser, insertItem bool) error {
-	for _, temp := range feedback {
-		if err := redis.InsertFeedback(temp, insertUser, insertItem); err != nil {
-			return err
+func (redis *Redis) BatchInsertFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	batchError := newBatchError()
+	pipe := redis.client.Pipeline()
+	rows := make([]int, 0, len(feedback))
+	for i, f := range feedback {
+		f.Count = 1
+		val, err := json.Marshal(f)
+		if err != nil {
+			batchError.Errors[i] = err
+			continue
+		}
+		// insert feedback
+		pipe.Set(ctx, redis.key(createFeedbackKey(f.FeedbackKey)), val, 0)
+		rows = append(rows, i)
+		// insert user
+		if insertUser {
+			data, err := json.Marshal(User{UserId: f.UserId})
+			if err != nil {
+				batchError.Errors[i] = err
+				continue
+			}
+			pipe.SetNX(ctx, redis.key(prefixUser+f.UserId), data, 0)
+			rows = append(rows, i)
+		}
+		// insert item
+		if insertItem {
+			data, err := json.Marshal(Item{ItemId: f.ItemId})
+			if err != nil {
+				batchError.Errors[i] = err
+				continue
+			}
+			pipe.SetNX(ctx, redis.key(prefixItem+f.ItemId), data, 0)
+			rows = append(rows, i)
+		}
+		// insert user index
+		pipe.SAdd(ctx, redis.key(createUserIndexKey(f.FeedbackType, f.UserId)), f.ItemId)
+		rows = append(rows, i)
+		// insert item index
+		pipe.SAdd(ctx, redis.key(createItemIndexKey(f.FeedbackType, f.ItemId)), f.UserId)
+		rows = append(rows, i)
+	}
+	return execPipeline(ctx, pipe, rows, batchError)
+}
+
+func (redis *Redis) BatchCountFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	batchError := newBatchError()
+	for i, f := range feedback {
+		if err := redis.countFeedback(ctx, f, insertUser, insertItem); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			batchError.Errors[i] = err
 		}
 	}
-	return nil
+	return batchError.errorOrNil()
 }
 
-func (redis *Redis) GetFeedback(feedbackType, cursor string, n int) (string, []Feedback, error) {
-	var ctx = context.Background()
+// execPipeline executes commands in a pipeline. The i-th command belongs to the rows[i]-th row and failed commands
+// are reported as failed rows. Commands aren't rolled back so failed rows might be written partially.
+func execPipeline(ctx context.Context, pipe redis.Pipeliner, rows []int, batchError *BatchError) error {
+	cmds, err := pipe.Exec(ctx)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for i, cmd := range cmds {
+		if cmd.Err() != nil {
+			batchError.Errors[rows[i]] = cmd.Err()
+		}
+	}
+	return batchError.errorOrNil()
+}
+
+func (redis *Redis) DeleteFeedback(ctx context.Context, key FeedbackKey) error {
+	// remove feedback
+	if err := redis.client.Del(ctx, redis.key(createFeedbackKey(key))).Err(); err != nil {
+		return err
+	}
+	// remove user index
+	if err := redis.client.SRem(ctx, redis.key(createUserIndexKey(key.FeedbackType, key.UserId)), key.ItemId).Err(); err != nil {
+		return err
+	}
+	// remove item index
+	return redis.client.SRem(ctx, redis.key(createItemIndexKey(key.FeedbackType, key.ItemId)), key.UserId).Err()
+}
+
+func (redis *Redis) GetFeedback(ctx context.Context, feedbackType, cursor string, n int, timeLimit *time.Time) (string, []Feedback, error) {
 	var err error
 	cursorNum := uint64(0)
 	if len(cursor) > 0 {
@@ -406,7 +649,7 @@ func (redis *Redis) GetFeedback(feedbackType, cursor string, n int) (string, []F
 	}
 	feedback := make([]Feedback, 0)
 	var keys []string
-	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, prefixFeedback+feedbackType+"*", int64(n)).Result()
+	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, redis.key(prefixFeedback+feedbackType+"*"), int64(n)).Result()
 	if err != nil {
 		return "", nil, err
 	}
@@ -420,6 +663,9 @@ func (redis *Redis) GetFeedback(feedbackType, cursor string, n int) (string, []F
 		if err != nil {
 			return "", nil, err
 		}
+		if timeLimit != nil && data.Timestamp.Before(*timeLimit) {
+			continue
+		}
 		feedback = append(feedback, data)
 	}
 	if cursorNum == 0 {
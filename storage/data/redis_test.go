@@ -14,6 +14,7 @@
 package data
 
 import (
+	"context"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -29,7 +30,7 @@ func newMockRedis(t *testing.T) *mockRedis {
 	db := new(mockRedis)
 	db.server, err = miniredis.Run()
 	assert.Nil(t, err)
-	db.Database, err = Open(redisPrefix + db.server.Addr())
+	db.Database, err = Open(redisPrefix+db.server.Addr(), "")
 	assert.Nil(t, err)
 	return db
 }
@@ -52,6 +53,12 @@ func TestRedis_Feedback(t *testing.T) {
 	testFeedback(t, db.Database)
 }
 
+func TestRedis_FeedbackType(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testFeedbackType(t, db.Database)
+}
+
 func TestRedis_Item(t *testing.T) {
 	db := newMockRedis(t)
 	defer db.Close(t)
@@ -69,3 +76,100 @@ func TestRedis_DeleteItem(t *testing.T) {
 	defer db.Close(t)
 	testDeleteItem(t, db.Database)
 }
+
+func TestRedis_ItemVisibility(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testItemVisibility(t, db.Database)
+}
+
+func TestRedis_Migrate(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testMigrate(t, db.Database)
+}
+
+func TestRedis_BatchInsert(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testBatchInsert(t, db.Database)
+}
+
+func TestRedis_CancelContext(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testCancelContext(t, db.Database)
+}
+
+func TestRedis_DeleteFeedback(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testDeleteFeedback(t, db.Database)
+}
+
+func TestRedis_UpdateItem(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testUpdateItem(t, db.Database)
+}
+
+func TestRedis_UpdateUser(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testUpdateUser(t, db.Database)
+}
+
+func TestRedis_Erasure(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testErasure(t, db.Database)
+}
+
+func TestRedis_CountFeedback(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testCountFeedback(t, db.Database)
+}
+
+func TestRedis_BatchInsertFailure(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	// index of label "b" has a wrong type
+	err := db.server.Set(prefixLabelIndex+"b", "")
+	assert.Nil(t, err)
+	items := []Item{{ItemId: "0", Labels: []string{"a"}}, {ItemId: "1", Labels: []string{"b"}}, {ItemId: "2"}}
+	err = db.BatchInsertItem(context.Background(), items)
+	batchError, ok := err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, []int{1}, batchError.Indices())
+	_, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	_, err = db.GetItem(context.Background(), "2")
+	assert.Nil(t, err)
+	// index of user "1" has a wrong type
+	err = db.server.Set(createUserIndexKey("click", "1"), "")
+	assert.Nil(t, err)
+	feedback := []Feedback{
+		{FeedbackKey: FeedbackKey{"click", "0", "0"}},
+		{FeedbackKey: FeedbackKey{"click", "1", "0"}},
+		{FeedbackKey: FeedbackKey{"click", "2", "0"}},
+	}
+	err = db.BatchInsertFeedback(context.Background(), feedback, true, true)
+	batchError, ok = err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, []int{1}, batchError.Indices())
+	for _, userId := range []string{"0", "2"} {
+		ret, err := db.GetUserFeedback(context.Background(), "click", userId)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(ret))
+	}
+}
+
+func TestRedis_Namespace(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	tenantDB, err := Open(redisPrefix+db.server.Addr(), "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	testNamespace(t, db.Database, tenantDB)
+}
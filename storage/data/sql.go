@@ -14,83 +14,477 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
+	"strings"
+	"time"
+
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zhenghaoz/gorse/storage/sqlutil"
+	_ "modernc.org/sqlite"
 )
 
+// sqlBatchSize is the maximal number of rows in a multi-row insertion.
+const sqlBatchSize = 100
+
 type SQLDatabase struct {
-	db *sql.DB
+	db     *sql.DB
+	driver sqlutil.Driver
+	// replica is the read replica for bulk reads, which is nil if there is no read replica.
+	replica *sql.DB
+	// namespace prefixes names of tables.
+	namespace string
+}
+
+// table returns the name of a table in the namespace.
+func (d *SQLDatabase) table(name string) string {
+	if d.namespace == "" {
+		return name
+	}
+	return d.namespace + "_" + name
+}
+
+// sqlMigration is a schema migration of SQL databases.
+type sqlMigration struct {
+	Migration
+	migrate func(d *SQLDatabase, ctx context.Context, txn *sql.Tx) error
+}
+
+// sqlMigrations are schema migrations of SQL databases in order. Migrations must be appended only.
+var sqlMigrations = []sqlMigration{
+	{Migration{1, "create tables of items, users and feedback"}, (*SQLDatabase).createTables},
+	{Migration{2, "add value to feedback"}, (*SQLDatabase).addFeedbackValue},
+	{Migration{3, "add expire time and hidden flag to items"}, (*SQLDatabase).addItemVisibility},
+	{Migration{4, "add count to feedback"}, (*SQLDatabase).addFeedbackCount},
+	{Migration{5, "create table of erasures"}, (*SQLDatabase).createErasures},
 }
 
+// Init applies all pending schema migrations.
 func (d *SQLDatabase) Init() error {
-	// create tables
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS items (" +
-		"item_id varchar(256) NOT NULL," +
-		"time_stamp timestamp NOT NULL," +
-		"labels json NOT NULL," +
-		"PRIMARY KEY(item_id)" +
-		")"); err != nil {
-		return err
+	_, err := d.Migrate(context.Background(), false)
+	return err
+}
+
+// Migrate applies pending schema migrations in order. Each migration is applied in a transaction along with the record
+// of its version, so that a failed migration is rolled back and applied again next time. However, MySQL commits schema
+// changes implicitly, so a failed migration of MySQL must be recovered by hand.
+func (d *SQLDatabase) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	version, err := d.schemaVersion(ctx, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Migration, 0)
+	for _, migration := range sqlMigrations {
+		if migration.Version <= version {
+			continue
+		}
+		if !dryRun {
+			if err = sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+				if err := migration.migrate(d, ctx, txn); err != nil {
+					return err
+				}
+				_, err := txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("schema_version")+"(version, description, applied_at) VALUES (?, ?, ?)"),
+					migration.Version, migration.Description, time.Now().UTC())
+				return err
+			}); err != nil {
+				return pending, errors.Wrapf(err, "failed to apply migration %d", migration.Version)
+			}
+		}
+		pending = append(pending, migration.Migration)
 	}
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS users (" +
-		"user_id varchar(256) NOT NULL," +
-		"labels json NOT NULL," +
-		"PRIMARY KEY (user_id)" +
+	return pending, nil
+}
+
+// schemaVersion returns the version of the schema. The table of schema versions is created if it doesn't exist unless
+// dryRun is true.
+func (d *SQLDatabase) schemaVersion(ctx context.Context, dryRun bool) (int, error) {
+	if dryRun {
+		if err := d.db.PingContext(ctx); err != nil {
+			return 0, err
+		}
+	} else if _, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("schema_version")+" ("+
+		"version integer NOT NULL,"+
+		"description varchar(256) NOT NULL,"+
+		"applied_at timestamp NOT NULL,"+
+		"PRIMARY KEY(version)"+
 		")"); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := d.db.QueryRowContext(ctx, "SELECT MAX(version) FROM "+d.table("schema_version")).Scan(&version); err != nil {
+		if dryRun {
+			// the table of schema versions doesn't exist
+			return 0, nil
+		}
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// createTables creates tables of items, users and feedback. Tables are the same as tables created by the first release,
+// so that existed tables are kept and migrated from version 1.
+func (d *SQLDatabase) createTables(ctx context.Context, txn *sql.Tx) error {
+	switch d.driver {
+	case sqlutil.MySQL:
+		// create tables
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("items")+" ("+
+			"item_id varchar(256) NOT NULL,"+
+			"time_stamp timestamp NOT NULL,"+
+			"labels json NOT NULL,"+
+			"PRIMARY KEY(item_id)"+
+			")"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("users")+" ("+
+			"user_id varchar(256) NOT NULL,"+
+			"labels json NOT NULL,"+
+			"PRIMARY KEY (user_id)"+
+			")"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("feedback")+" ("+
+			"feedback_type varchar(256) NOT NULL,"+
+			"user_id varchar(256) NOT NULL,"+
+			"item_id varchar(256) NOT NULL,"+
+			"time_stamp timestamp NOT NULL,"+
+			"PRIMARY KEY(feedback_type, user_id, item_id)"+
+			")"); err != nil {
+			return err
+		}
+		// change settings
+		if _, err := txn.ExecContext(ctx, "SET GLOBAL sql_mode=\""+
+			"ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,ERROR_FOR_DIVISION_BY_ZERO,"+
+			"NO_ENGINE_SUBSTITUTION\""); err != nil {
+			return err
+		}
+	case sqlutil.Postgres:
+		// create tables
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("items")+" ("+
+			"item_id varchar(256) NOT NULL,"+
+			"time_stamp timestamp NOT NULL DEFAULT '0001-01-01',"+
+			"labels jsonb NOT NULL DEFAULT '[]',"+
+			"PRIMARY KEY(item_id)"+
+			")"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("users")+" ("+
+			"user_id varchar(256) NOT NULL,"+
+			"labels jsonb NOT NULL DEFAULT '[]',"+
+			"PRIMARY KEY (user_id)"+
+			")"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("feedback")+" ("+
+			"feedback_type varchar(256) NOT NULL,"+
+			"user_id varchar(256) NOT NULL,"+
+			"item_id varchar(256) NOT NULL,"+
+			"time_stamp timestamp NOT NULL,"+
+			"PRIMARY KEY(feedback_type, user_id, item_id)"+
+			")"); err != nil {
+			return err
+		}
+		// create indices for feedback lookup by user or item
+		if _, err := txn.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS "+d.table("feedback_user_id")+" ON "+d.table("feedback")+"(user_id)"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS "+d.table("feedback_item_id")+" ON "+d.table("feedback")+"(item_id)"); err != nil {
+			return err
+		}
+	case sqlutil.SQLite:
+		// create tables
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("items")+" ("+
+			"item_id varchar(256) NOT NULL,"+
+			"time_stamp datetime NOT NULL DEFAULT '0001-01-01 00:00:00+00:00',"+
+			"labels text NOT NULL DEFAULT '[]',"+
+			"PRIMARY KEY(item_id)"+
+			")"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("users")+" ("+
+			"user_id varchar(256) NOT NULL,"+
+			"labels text NOT NULL DEFAULT '[]',"+
+			"PRIMARY KEY (user_id)"+
+			")"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("feedback")+" ("+
+			"feedback_type varchar(256) NOT NULL,"+
+			"user_id varchar(256) NOT NULL,"+
+			"item_id varchar(256) NOT NULL,"+
+			"time_stamp datetime NOT NULL,"+
+			"PRIMARY KEY(feedback_type, user_id, item_id)"+
+			")"); err != nil {
+			return err
+		}
+		// create indices for feedback lookup by user or item
+		if _, err := txn.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS "+d.table("feedback_user_id")+" ON "+d.table("feedback")+"(user_id)"); err != nil {
+			return err
+		}
+		if _, err := txn.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS "+d.table("feedback_item_id")+" ON "+d.table("feedback")+"(item_id)"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFeedbackValue adds values to feedback. Tables created by releases between values and migrations have values
+// already, so the column is added only if it's missing.
+func (d *SQLDatabase) addFeedbackValue(ctx context.Context, txn *sql.Tx) error {
+	exist, err := d.hasColumn(ctx, txn, d.table("feedback"), "value")
+	if err != nil || exist {
 		return err
 	}
-	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS feedback (" +
-		"feedback_type varchar(256) NOT NULL," +
-		"user_id varchar(256) NOT NULL," +
-		"item_id varchar(256) NOT NULL," +
-		"time_stamp timestamp NOT NULL," +
-		"PRIMARY KEY(feedback_type, user_id, item_id)" +
-		")"); err != nil {
+	var valueType string
+	switch d.driver {
+	case sqlutil.MySQL:
+		valueType = "double"
+	case sqlutil.Postgres:
+		valueType = "double precision"
+	default:
+		valueType = "real"
+	}
+	_, err = txn.ExecContext(ctx, "ALTER TABLE "+d.table("feedback")+" ADD COLUMN value "+valueType+" NOT NULL DEFAULT 1")
+	return err
+}
+
+// hasColumn checks whether a column exists in a table. Columns are looked up in the catalog since a failed statement
+// aborts the transaction of PostgreSQL.
+func (d *SQLDatabase) hasColumn(ctx context.Context, txn *sql.Tx, table, column string) (bool, error) {
+	var query string
+	switch d.driver {
+	case sqlutil.MySQL:
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+	case sqlutil.Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = LOWER(?) AND column_name = ?"
+	default:
+		query = "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	}
+	var count int
+	if err := txn.QueryRowContext(ctx, d.driver.Rebind(query), table, column).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// addItemVisibility adds expire times and hidden flags to items.
+func (d *SQLDatabase) addItemVisibility(ctx context.Context, txn *sql.Tx) error {
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err := txn.ExecContext(ctx, "ALTER TABLE "+d.table("items")+" ADD COLUMN expire_time timestamp NULL DEFAULT NULL, "+
+			"ADD COLUMN hidden bool NOT NULL DEFAULT false")
+		return err
+	case sqlutil.Postgres:
+		_, err := txn.ExecContext(ctx, "ALTER TABLE "+d.table("items")+" ADD COLUMN expire_time timestamp, "+
+			"ADD COLUMN hidden boolean NOT NULL DEFAULT false")
+		return err
+	default:
+		// SQLite adds a column per statement
+		if _, err := txn.ExecContext(ctx, "ALTER TABLE "+d.table("items")+" ADD COLUMN expire_time datetime"); err != nil {
+			return err
+		}
+		_, err := txn.ExecContext(ctx, "ALTER TABLE "+d.table("items")+" ADD COLUMN hidden boolean NOT NULL DEFAULT false")
 		return err
 	}
-	// change settings
-	_, err := d.db.Exec("SET GLOBAL sql_mode=\"" +
-		"ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,ERROR_FOR_DIVISION_BY_ZERO," +
-		"NO_ENGINE_SUBSTITUTION\"")
+}
+
+// addFeedbackCount adds counts to feedback. Existed feedback are counted once.
+func (d *SQLDatabase) addFeedbackCount(ctx context.Context, txn *sql.Tx) error {
+	_, err := txn.ExecContext(ctx, "ALTER TABLE "+d.table("feedback")+" ADD COLUMN count integer NOT NULL DEFAULT 1")
 	return err
 }
 
+// createErasures creates the table of erasures.
+func (d *SQLDatabase) createErasures(ctx context.Context, txn *sql.Tx) error {
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("erasures")+" ("+
+			"user_id varchar(256) NOT NULL,"+
+			"requested_at timestamp NOT NULL,"+
+			"completed_at timestamp NULL DEFAULT NULL,"+
+			"PRIMARY KEY(user_id)"+
+			")")
+		return err
+	case sqlutil.Postgres:
+		_, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("erasures")+" ("+
+			"user_id varchar(256) NOT NULL,"+
+			"requested_at timestamp NOT NULL,"+
+			"completed_at timestamp,"+
+			"PRIMARY KEY(user_id)"+
+			")")
+		return err
+	default:
+		_, err := txn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+d.table("erasures")+" ("+
+			"user_id varchar(256) NOT NULL,"+
+			"requested_at datetime NOT NULL,"+
+			"completed_at datetime,"+
+			"PRIMARY KEY(user_id)"+
+			")")
+		return err
+	}
+}
+
 func (d *SQLDatabase) Close() error {
+	if d.replica != nil {
+		if err := d.replica.Close(); err != nil {
+			return err
+		}
+	}
 	return d.db.Close()
 }
 
-func (d *SQLDatabase) InsertItem(item Item) error {
+// queryBulk runs a bulk read on the read replica. The query is run on the primary database if there is no read replica
+// or the read replica fails.
+func (d *SQLDatabase) queryBulk(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if d.replica != nil {
+		result, err := d.replica.QueryContext(ctx, query, args...)
+		if err == nil || ctx.Err() != nil {
+			return result, err
+		}
+		log.Warnf("data: failed to query read replica, fall back to primary (%v)", err)
+	}
+	return d.db.QueryContext(ctx, query, args...)
+}
+
+func (d *SQLDatabase) InsertItem(ctx context.Context, item Item) error {
 	labels, err := json.Marshal(item.Labels)
 	if err != nil {
 		return err
 	}
-	_, err = d.db.Exec("INSERT IGNORE items(item_id, time_stamp, labels) VALUES (?, ?, ?)",
-		item.ItemId, item.Timestamp, labels)
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = d.db.ExecContext(ctx, "INSERT IGNORE "+d.table("items")+"(item_id, time_stamp, labels, expire_time, hidden) VALUES (?, ?, ?, ?, ?)",
+			item.ItemId, item.Timestamp, labels, d.nullableTime(item.ExpireTime), item.Hidden)
+	default:
+		_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("items")+"(item_id, time_stamp, labels, expire_time, hidden) VALUES (?, ?, ?, ?, ?) "+
+			"ON CONFLICT DO NOTHING"),
+			item.ItemId, item.Timestamp.UTC(), string(labels), d.nullableTime(item.ExpireTime), item.Hidden)
+	}
 	return err
 }
 
-func (d *SQLDatabase) BatchInsertItem(items []Item) error {
+func (d *SQLDatabase) BatchInsertItem(ctx context.Context, items []Item) error {
+	batchError := newBatchError()
+	for begin := 0; begin < len(items); begin += sqlBatchSize {
+		end := begin + sqlBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		if err := sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+			return d.insertItems(ctx, txn, items[begin:end])
+		}); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// insert items one by one to locate failed items
+			for i := begin; i < end; i++ {
+				if err = d.InsertItem(ctx, items[i]); err != nil {
+					batchError.Errors[i] = err
+				}
+			}
+		}
+	}
+	return batchError.errorOrNil()
+}
+
+// insertItems inserts items by a multi-row insertion.
+func (d *SQLDatabase) insertItems(ctx context.Context, txn *sql.Tx, items []Item) error {
+	args := make([]interface{}, 0, len(items)*5)
 	for _, item := range items {
-		if err := d.InsertItem(item); err != nil {
+		labels, err := json.Marshal(item.Labels)
+		if err != nil {
 			return err
 		}
+		if d.driver == sqlutil.MySQL {
+			args = append(args, item.ItemId, item.Timestamp, labels, d.nullableTime(item.ExpireTime), item.Hidden)
+		} else {
+			args = append(args, item.ItemId, item.Timestamp.UTC(), string(labels), d.nullableTime(item.ExpireTime), item.Hidden)
+		}
 	}
-	return nil
+	var err error
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = txn.ExecContext(ctx, "INSERT IGNORE "+d.table("items")+"(item_id, time_stamp, labels, expire_time, hidden) VALUES "+
+			sqlutil.Placeholders(len(items), 5), args...)
+	default:
+		_, err = txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("items")+"(item_id, time_stamp, labels, expire_time, hidden) VALUES "+
+			sqlutil.Placeholders(len(items), 5)+" ON CONFLICT DO NOTHING"), args...)
+	}
+	return err
+}
+
+func (d *SQLDatabase) UpsertItem(ctx context.Context, item Item) error {
+	labels, err := json.Marshal(item.Labels)
+	if err != nil {
+		return err
+	}
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = d.db.ExecContext(ctx, "INSERT "+d.table("items")+"(item_id, time_stamp, labels, expire_time, hidden) VALUES (?, ?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE time_stamp = VALUES(time_stamp), labels = VALUES(labels), "+
+			"expire_time = VALUES(expire_time), hidden = VALUES(hidden)",
+			item.ItemId, item.Timestamp, labels, d.nullableTime(item.ExpireTime), item.Hidden)
+	default:
+		_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("items")+"(item_id, time_stamp, labels, expire_time, hidden) VALUES (?, ?, ?, ?, ?) "+
+			"ON CONFLICT (item_id) DO UPDATE SET time_stamp = EXCLUDED.time_stamp, labels = EXCLUDED.labels, "+
+			"expire_time = EXCLUDED.expire_time, hidden = EXCLUDED.hidden"),
+			item.ItemId, item.Timestamp.UTC(), string(labels), d.nullableTime(item.ExpireTime), item.Hidden)
+	}
+	return err
+}
+
+func (d *SQLDatabase) UpdateItem(ctx context.Context, itemId string, patch ItemPatch) error {
+	if _, err := d.GetItem(ctx, itemId); err != nil {
+		return err
+	}
+	var columns []string
+	var args []interface{}
+	if patch.Timestamp != nil {
+		columns = append(columns, "time_stamp = ?")
+		if d.driver == sqlutil.MySQL {
+			args = append(args, *patch.Timestamp)
+		} else {
+			args = append(args, patch.Timestamp.UTC())
+		}
+	}
+	if patch.Labels != nil {
+		labels, err := json.Marshal(patch.Labels)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, "labels = ?")
+		args = append(args, string(labels))
+	}
+	if patch.ExpireTime != nil || patch.ClearExpireTime {
+		columns = append(columns, "expire_time = ?")
+		args = append(args, d.nullableTime(patch.ExpireTime))
+	}
+	if patch.Hidden != nil {
+		columns = append(columns, "hidden = ?")
+		args = append(args, *patch.Hidden)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	args = append(args, itemId)
+	_, err := d.db.ExecContext(ctx, d.driver.Rebind("UPDATE "+d.table("items")+" SET "+strings.Join(columns, ", ")+" WHERE item_id = ?"), args...)
+	return err
 }
 
-func (d *SQLDatabase) DeleteItem(itemId string) error {
-	txn, err := d.db.Begin()
+func (d *SQLDatabase) DeleteItem(ctx context.Context, itemId string) error {
+	txn, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	_, err = txn.Exec("DELETE FROM items WHERE item_id = ?", itemId)
+	_, err = txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("items")+" WHERE item_id = ?"), itemId)
 	if err != nil {
 		txn.Rollback()
 		return err
 	}
-	_, err = txn.Exec("DELETE FROM feedback WHERE item_id = ?", itemId)
+	_, err = txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("feedback")+" WHERE item_id = ?"), itemId)
 	if err != nil {
 		txn.Rollback()
 		return err
@@ -98,44 +492,37 @@ func (d *SQLDatabase) DeleteItem(itemId string) error {
 	return txn.Commit()
 }
 
-func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
-	result, err := d.db.Query("SELECT item_id, time_stamp, labels FROM items WHERE item_id = ?", itemId)
+func (d *SQLDatabase) GetItem(ctx context.Context, itemId string) (Item, error) {
+	result, err := d.db.QueryContext(ctx, d.driver.Rebind("SELECT item_id, time_stamp, labels, expire_time, hidden FROM "+d.table("items")+" "+
+		"WHERE item_id = ?"), itemId)
 	if err != nil {
 		return Item{}, err
 	}
-	defer result.Close()
-	if result.Next() {
-		var item Item
-		var labels string
-		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels); err != nil {
-			return Item{}, err
-		}
-		if err := json.Unmarshal([]byte(labels), &item.Labels); err != nil {
-			return Item{}, err
-		}
-		return item, nil
+	items, err := d.scanItems(result)
+	if err != nil {
+		return Item{}, err
+	}
+	if len(items) == 0 {
+		return Item{}, errors.New(ErrItemNotExist)
 	}
-	return Item{}, errors.New(ErrItemNotExist)
+	return items[0], nil
 }
 
-func (d *SQLDatabase) GetItems(cursor string, n int) (string, []Item, error) {
-	result, err := d.db.Query("SELECT item_id, time_stamp, labels FROM items "+
-		"WHERE item_id >= ? LIMIT ?", cursor, n+1)
+func (d *SQLDatabase) GetItems(ctx context.Context, cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
+	timeCondition, args := "", []interface{}{cursor}
+	if timeLimit != nil {
+		timeCondition = " AND time_stamp >= ?"
+		args = append(args, timeLimit.UTC())
+	}
+	args = append(args, n+1)
+	result, err := d.queryBulk(ctx, d.driver.Rebind("SELECT item_id, time_stamp, labels, expire_time, hidden FROM "+d.table("items")+" "+
+		"WHERE item_id >= ?"+timeCondition+" ORDER BY item_id LIMIT ?"), args...)
 	if err != nil {
 		return "", nil, err
 	}
-	items := make([]Item, 0)
-	defer result.Close()
-	for result.Next() {
-		var item Item
-		var labels string
-		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels); err != nil {
-			return "", nil, err
-		}
-		if err := json.Unmarshal([]byte(labels), &item.Labels); err != nil {
-			return "", nil, err
-		}
-		items = append(items, item)
+	items, err := d.scanItems(result)
+	if err != nil {
+		return "", nil, err
 	}
 	if len(items) == n+1 {
 		return items[len(items)-1].ItemId, items[:len(items)-1], nil
@@ -143,42 +530,71 @@ func (d *SQLDatabase) GetItems(cursor string, n int) (string, []Item, error) {
 	return "", items, nil
 }
 
-func (d *SQLDatabase) GetItemFeedback(feedbackType, itemId string) ([]Feedback, error) {
-	result, err := d.db.Query("SELECT user_id, item_id FROM feedback WHERE item_id = ?", itemId)
+func (d *SQLDatabase) GetItemFeedback(ctx context.Context, feedbackType, itemId string) ([]Feedback, error) {
+	result, err := d.db.QueryContext(ctx, d.driver.Rebind("SELECT feedback_type, user_id, item_id, time_stamp, value, count FROM "+d.table("feedback")+" "+
+		"WHERE item_id = ? AND (? = '' OR feedback_type = ?)"), itemId, feedbackType, feedbackType)
 	if err != nil {
 		return nil, err
 	}
-	feedbacks := make([]Feedback, 0)
-	for result.Next() {
-		var feedback Feedback
-		if err := result.Scan(&feedback.UserId, &feedback.ItemId); err != nil {
-			return nil, err
-		}
-		feedbacks = append(feedbacks, feedback)
+	return d.scanFeedback(result)
+}
+
+func (d *SQLDatabase) InsertUser(ctx context.Context, user User) error {
+	labels, err := json.Marshal(user.Labels)
+	if err != nil {
+		return err
 	}
-	return feedbacks, nil
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = d.db.ExecContext(ctx, "INSERT "+d.table("users")+"(user_id, labels) VALUES (?, ?)", user.UserId, labels)
+	default:
+		_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("users")+"(user_id, labels) VALUES (?, ?)"), user.UserId, string(labels))
+	}
+	return err
 }
 
-func (d *SQLDatabase) InsertUser(user User) error {
+func (d *SQLDatabase) UpsertUser(ctx context.Context, user User) error {
 	labels, err := json.Marshal(user.Labels)
 	if err != nil {
 		return err
 	}
-	_, err = d.db.Exec("INSERT users(user_id, labels) VALUES (?, ?)", user.UserId, labels)
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = d.db.ExecContext(ctx, "INSERT "+d.table("users")+"(user_id, labels) VALUES (?, ?) "+
+			"ON DUPLICATE KEY UPDATE labels = VALUES(labels)", user.UserId, labels)
+	default:
+		_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("users")+"(user_id, labels) VALUES (?, ?) "+
+			"ON CONFLICT (user_id) DO UPDATE SET labels = EXCLUDED.labels"), user.UserId, string(labels))
+	}
 	return err
 }
 
-func (d *SQLDatabase) DeleteUser(userId string) error {
-	txn, err := d.db.Begin()
+func (d *SQLDatabase) UpdateUser(ctx context.Context, userId string, patch UserPatch) error {
+	if _, err := d.GetUser(ctx, userId); err != nil {
+		return err
+	}
+	if patch.Labels == nil {
+		return nil
+	}
+	labels, err := json.Marshal(patch.Labels)
 	if err != nil {
 		return err
 	}
-	_, err = txn.Exec("DELETE FROM users WHERE user_id = ?", userId)
+	_, err = d.db.ExecContext(ctx, d.driver.Rebind("UPDATE "+d.table("users")+" SET labels = ? WHERE user_id = ?"), string(labels), userId)
+	return err
+}
+
+func (d *SQLDatabase) DeleteUser(ctx context.Context, userId string) error {
+	txn, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("users")+" WHERE user_id = ?"), userId)
 	if err != nil {
 		txn.Rollback()
 		return err
 	}
-	_, err = txn.Exec("DELETE FROM feedback WHERE user_id = ?", userId)
+	_, err = txn.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("feedback")+" WHERE user_id = ?"), userId)
 	if err != nil {
 		txn.Rollback()
 		return err
@@ -186,8 +602,8 @@ func (d *SQLDatabase) DeleteUser(userId string) error {
 	return txn.Commit()
 }
 
-func (d *SQLDatabase) GetUser(userId string) (User, error) {
-	result, err := d.db.Query("SELECT user_id, labels FROM users WHERE user_id = ?", userId)
+func (d *SQLDatabase) GetUser(ctx context.Context, userId string) (User, error) {
+	result, err := d.db.QueryContext(ctx, d.driver.Rebind("SELECT user_id, labels FROM "+d.table("users")+" WHERE user_id = ?"), userId)
 	if err != nil {
 		return User{}, err
 	}
@@ -206,9 +622,46 @@ func (d *SQLDatabase) GetUser(userId string) (User, error) {
 	return User{}, errors.New(ErrUserNotExist)
 }
 
-func (d *SQLDatabase) GetUsers(cursor string, n int) (string, []User, error) {
-	result, err := d.db.Query("SELECT user_id, labels FROM users "+
-		"WHERE user_id >= ? LIMIT ?", cursor, n+1)
+func (d *SQLDatabase) PutErasure(ctx context.Context, erasure Erasure) error {
+	var err error
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = d.db.ExecContext(ctx, "INSERT "+d.table("erasures")+"(user_id, requested_at, completed_at) VALUES (?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE requested_at = VALUES(requested_at), completed_at = VALUES(completed_at)",
+			erasure.UserId, erasure.RequestedAt, d.nullableTime(erasure.CompletedAt))
+	default:
+		_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("erasures")+"(user_id, requested_at, completed_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (user_id) DO UPDATE SET requested_at = EXCLUDED.requested_at, completed_at = EXCLUDED.completed_at"),
+			erasure.UserId, erasure.RequestedAt.UTC(), d.nullableTime(erasure.CompletedAt))
+	}
+	return err
+}
+
+func (d *SQLDatabase) GetErasure(ctx context.Context, userId string) (Erasure, error) {
+	result, err := d.db.QueryContext(ctx, d.driver.Rebind("SELECT user_id, requested_at, completed_at FROM "+d.table("erasures")+" WHERE user_id = ?"), userId)
+	if err != nil {
+		return Erasure{}, err
+	}
+	defer result.Close()
+	if result.Next() {
+		var erasure Erasure
+		var completedAt sql.NullTime
+		if err := result.Scan(&erasure.UserId, &erasure.RequestedAt, &completedAt); err != nil {
+			return Erasure{}, err
+		}
+		erasure.RequestedAt = d.fixTime(erasure.RequestedAt)
+		if completedAt.Valid {
+			t := d.fixTime(completedAt.Time)
+			erasure.CompletedAt = &t
+		}
+		return erasure, nil
+	}
+	return Erasure{}, errors.New(ErrErasureNotExist)
+}
+
+func (d *SQLDatabase) GetUsers(ctx context.Context, cursor string, n int) (string, []User, error) {
+	result, err := d.queryBulk(ctx, d.driver.Rebind("SELECT user_id, labels FROM "+d.table("users")+" "+
+		"WHERE user_id >= ? ORDER BY user_id LIMIT ?"), cursor, n+1)
 	if err != nil {
 		return "", nil, err
 	}
@@ -231,31 +684,30 @@ func (d *SQLDatabase) GetUsers(cursor string, n int) (string, []User, error) {
 	return "", users, nil
 }
 
-func (d *SQLDatabase) GetUserFeedback(feedbackType, userId string) ([]Feedback, error) {
-	result, err := d.db.Query("SELECT feedback_type, user_id, item_id, time_stamp FROM feedback WHERE user_id = ?", userId)
+func (d *SQLDatabase) GetUserFeedback(ctx context.Context, feedbackType, userId string) ([]Feedback, error) {
+	result, err := d.db.QueryContext(ctx, d.driver.Rebind("SELECT feedback_type, user_id, item_id, time_stamp, value, count FROM "+d.table("feedback")+" "+
+		"WHERE user_id = ? AND (? = '' OR feedback_type = ?)"), userId, feedbackType, feedbackType)
 	if err != nil {
 		return nil, err
 	}
-	feedbacks := make([]Feedback, 0)
-	for result.Next() {
-		var feedback Feedback
-		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp); err != nil {
-			return nil, err
-		}
-		feedbacks = append(feedbacks, feedback)
-	}
-	return feedbacks, nil
+	return d.scanFeedback(result)
 }
 
-func (d *SQLDatabase) InsertFeedback(feedback Feedback, insertUser, insertItem bool) error {
+func (d *SQLDatabase) InsertFeedback(ctx context.Context, feedback Feedback, insertUser, insertItem bool) error {
 	// insert users
 	if insertUser {
-		_, err := d.db.Exec("INSERT IGNORE users(user_id) VALUES (?)", feedback.UserId)
+		var err error
+		switch d.driver {
+		case sqlutil.MySQL:
+			_, err = d.db.ExecContext(ctx, "INSERT IGNORE "+d.table("users")+"(user_id) VALUES (?)", feedback.UserId)
+		default:
+			_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("users")+"(user_id) VALUES (?) ON CONFLICT DO NOTHING"), feedback.UserId)
+		}
 		if err != nil {
 			return err
 		}
 	} else {
-		if _, err := d.GetUser(feedback.UserId); err != nil {
+		if _, err := d.GetUser(ctx, feedback.UserId); err != nil {
 			if err.Error() == ErrUserNotExist {
 				return nil
 			}
@@ -264,12 +716,18 @@ func (d *SQLDatabase) InsertFeedback(feedback Feedback, insertUser, insertItem b
 	}
 	// insert items
 	if insertItem {
-		_, err := d.db.Exec("INSERT IGNORE items(item_id) VALUES (?)", feedback.ItemId)
+		var err error
+		switch d.driver {
+		case sqlutil.MySQL:
+			_, err = d.db.ExecContext(ctx, "INSERT IGNORE "+d.table("items")+"(item_id) VALUES (?)", feedback.ItemId)
+		default:
+			_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("items")+"(item_id) VALUES (?) ON CONFLICT DO NOTHING"), feedback.ItemId)
+		}
 		if err != nil {
 			return err
 		}
 	} else {
-		if _, err := d.GetItem(feedback.ItemId); err != nil {
+		if _, err := d.GetItem(ctx, feedback.ItemId); err != nil {
 			if err.Error() == ErrItemNotExist {
 				return nil
 			}
@@ -277,43 +735,203 @@ func (d *SQLDatabase) InsertFeedback(feedback Feedback, insertUser, insertItem b
 		}
 	}
 	// insert feedback
-	_, err := d.db.Exec("INSERT IGNORE feedback(feedback_type, user_id, item_id, time_stamp) VALUES (?,?,?,?)",
-		feedback.FeedbackType, feedback.UserId, feedback.ItemId, feedback.Timestamp)
+	var err error
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = d.db.ExecContext(ctx, "INSERT IGNORE "+d.table("feedback")+"(feedback_type, user_id, item_id, time_stamp, value) VALUES (?,?,?,?,?)",
+			feedback.FeedbackType, feedback.UserId, feedback.ItemId, feedback.Timestamp, feedback.Value)
+	default:
+		_, err = d.db.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("feedback")+"(feedback_type, user_id, item_id, time_stamp, value) VALUES (?,?,?,?,?) "+
+			"ON CONFLICT DO NOTHING"),
+			feedback.FeedbackType, feedback.UserId, feedback.ItemId, feedback.Timestamp.UTC(), feedback.Value)
+	}
 	return err
 }
 
-func (d *SQLDatabase) BatchInsertFeedback(feedback []Feedback, insertUser, insertItem bool) error {
+func (d *SQLDatabase) BatchInsertFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	return d.batchInsertFeedback(ctx, feedback, insertUser, insertItem, false)
+}
+
+func (d *SQLDatabase) BatchCountFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem bool) error {
+	return d.batchInsertFeedback(ctx, feedback, insertUser, insertItem, true)
+}
+
+// batchInsertFeedback inserts feedback in batches. Repeated feedback are counted if count is true.
+func (d *SQLDatabase) batchInsertFeedback(ctx context.Context, feedback []Feedback, insertUser, insertItem, count bool) error {
+	batchError := newBatchError()
+	for begin := 0; begin < len(feedback); begin += sqlBatchSize {
+		end := begin + sqlBatchSize
+		if end > len(feedback) {
+			end = len(feedback)
+		}
+		if err := sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+			return d.insertFeedback(ctx, txn, feedback[begin:end], insertUser, insertItem, count)
+		}); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// insert feedback one by one to locate failed feedback
+			for i := begin; i < end; i++ {
+				if err = sqlutil.Transaction(ctx, d.db, func(txn *sql.Tx) error {
+					return d.insertFeedback(ctx, txn, feedback[i:i+1], insertUser, insertItem, count)
+				}); err != nil {
+					batchError.Errors[i] = err
+				}
+			}
+		}
+	}
+	return batchError.errorOrNil()
+}
+
+// insertFeedback inserts feedback by multi-row insertions. Feedback of users or items that don't exist is skipped
+// unless they are inserted. Repeated feedback are ignored, or counted if count is true.
+func (d *SQLDatabase) insertFeedback(ctx context.Context, txn *sql.Tx, feedback []Feedback, insertUser, insertItem, count bool) error {
+	userIds, itemIds := make(map[string]bool), make(map[string]bool)
 	for _, f := range feedback {
-		if err := d.InsertFeedback(f, insertUser, insertItem); err != nil {
+		userIds[f.UserId] = true
+		itemIds[f.ItemId] = true
+	}
+	// insert users or skip feedback of users that don't exist
+	if insertUser {
+		if err := d.insertIds(ctx, txn, d.table("users"), "user_id", userIds); err != nil {
 			return err
 		}
+	} else {
+		existedUserIds, err := d.selectIds(ctx, txn, d.table("users"), "user_id", userIds)
+		if err != nil {
+			return err
+		}
+		userIds = existedUserIds
 	}
-	return nil
+	// insert items or skip feedback of items that don't exist
+	if insertItem {
+		if err := d.insertIds(ctx, txn, d.table("items"), "item_id", itemIds); err != nil {
+			return err
+		}
+	} else {
+		existedItemIds, err := d.selectIds(ctx, txn, d.table("items"), "item_id", itemIds)
+		if err != nil {
+			return err
+		}
+		itemIds = existedItemIds
+	}
+	// a row can't be upserted twice in a statement
+	if count {
+		feedback = mergeFeedback(feedback)
+	}
+	// insert feedback
+	args := make([]interface{}, 0, len(feedback)*6)
+	for _, f := range feedback {
+		if !userIds[f.UserId] || !itemIds[f.ItemId] {
+			continue
+		}
+		if d.driver == sqlutil.MySQL {
+			args = append(args, f.FeedbackType, f.UserId, f.ItemId, f.Timestamp, f.Value)
+		} else {
+			args = append(args, f.FeedbackType, f.UserId, f.ItemId, f.Timestamp.UTC(), f.Value)
+		}
+		if count {
+			args = append(args, f.Count)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	var err error
+	switch {
+	case count && d.driver == sqlutil.MySQL:
+		_, err = txn.ExecContext(ctx, "INSERT INTO "+d.table("feedback")+"(feedback_type, user_id, item_id, time_stamp, value, count) VALUES "+
+			sqlutil.Placeholders(len(args)/6, 6)+" ON DUPLICATE KEY UPDATE count = count + VALUES(count), time_stamp = VALUES(time_stamp)", args...)
+	case count:
+		_, err = txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("feedback")+"(feedback_type, user_id, item_id, time_stamp, value, count) VALUES "+
+			sqlutil.Placeholders(len(args)/6, 6)+" ON CONFLICT (feedback_type, user_id, item_id) DO UPDATE SET "+
+			"count = "+d.table("feedback")+".count + excluded.count, time_stamp = excluded.time_stamp"), args...)
+	case d.driver == sqlutil.MySQL:
+		_, err = txn.ExecContext(ctx, "INSERT IGNORE "+d.table("feedback")+"(feedback_type, user_id, item_id, time_stamp, value) VALUES "+
+			sqlutil.Placeholders(len(args)/5, 5), args...)
+	default:
+		_, err = txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+d.table("feedback")+"(feedback_type, user_id, item_id, time_stamp, value) VALUES "+
+			sqlutil.Placeholders(len(args)/5, 5)+" ON CONFLICT DO NOTHING"), args...)
+	}
+	return err
+}
+
+// insertIds inserts rows with only primary keys into a table. Existed rows are ignored.
+func (d *SQLDatabase) insertIds(ctx context.Context, txn *sql.Tx, table, column string, ids map[string]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for id := range ids {
+		args = append(args, id)
+	}
+	var err error
+	switch d.driver {
+	case sqlutil.MySQL:
+		_, err = txn.ExecContext(ctx, "INSERT IGNORE "+table+"("+column+") VALUES "+sqlutil.Placeholders(len(ids), 1), args...)
+	default:
+		_, err = txn.ExecContext(ctx, d.driver.Rebind("INSERT INTO "+table+"("+column+") VALUES "+sqlutil.Placeholders(len(ids), 1)+
+			" ON CONFLICT DO NOTHING"), args...)
+	}
+	return err
 }
 
-func (d *SQLDatabase) GetFeedback(feedbackType, cursor string, n int) (string, []Feedback, error) {
+// selectIds returns primary keys existed in a table.
+func (d *SQLDatabase) selectIds(ctx context.Context, txn *sql.Tx, table, column string, ids map[string]bool) (map[string]bool, error) {
+	existedIds := make(map[string]bool)
+	if len(ids) == 0 {
+		return existedIds, nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for id := range ids {
+		args = append(args, id)
+	}
+	result, err := txn.QueryContext(ctx, d.driver.Rebind("SELECT "+column+" FROM "+table+" WHERE "+column+" IN ("+
+		strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")+")"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var id string
+		if err = result.Scan(&id); err != nil {
+			return nil, err
+		}
+		existedIds[id] = true
+	}
+	return existedIds, result.Err()
+}
+
+func (d *SQLDatabase) DeleteFeedback(ctx context.Context, key FeedbackKey) error {
+	_, err := d.db.ExecContext(ctx, d.driver.Rebind("DELETE FROM "+d.table("feedback")+" WHERE feedback_type = ? AND user_id = ? AND item_id = ?"),
+		key.FeedbackType, key.UserId, key.ItemId)
+	return err
+}
+
+func (d *SQLDatabase) GetFeedback(ctx context.Context, feedbackType, cursor string, n int, timeLimit *time.Time) (string, []Feedback, error) {
 	var cursorKey FeedbackKey
 	if cursor != "" {
 		if err := json.Unmarshal([]byte(cursor), &cursorKey); err != nil {
 			return "", nil, err
 		}
 	}
-	result, err := d.db.Query("SELECT feedback_type, user_id, item_id, time_stamp FROM feedback "+
-		"WHERE feedback_type = ? AND user_id >= ? AND item_id >= ? LIMIT ?", feedbackType, cursorKey.UserId, cursorKey.ItemId, n+1)
+	timeCondition, args := "", []interface{}{feedbackType, cursorKey.UserId, cursorKey.ItemId}
+	if timeLimit != nil {
+		timeCondition = " AND time_stamp >= ?"
+		args = append(args, timeLimit.UTC())
+	}
+	args = append(args, n+1)
+	result, err := d.queryBulk(ctx, d.driver.Rebind("SELECT feedback_type, user_id, item_id, time_stamp, value, count FROM "+d.table("feedback")+" "+
+		"WHERE feedback_type = ? AND (user_id, item_id) >= (?, ?)"+timeCondition+" ORDER BY user_id, item_id LIMIT ?"), args...)
 	if err != nil {
 		return "", nil, err
 	}
-	feedbacks := make([]Feedback, 0)
-	for result.Next() {
-		var feedback Feedback
-		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp); err != nil {
-			return "", nil, err
-		}
-		feedbacks = append(feedbacks, feedback)
+	feedbacks, err := d.scanFeedback(result)
+	if err != nil {
+		return "", nil, err
 	}
 	if len(feedbacks) == n+1 {
-		nextCursorKey := feedbacks[len(feedbacks)-1]
-		nextCursor, err := json.Marshal(nextCursorKey)
+		nextCursor, err := json.Marshal(feedbacks[len(feedbacks)-1].FeedbackKey)
 		if err != nil {
 			return "", nil, err
 		}
@@ -321,3 +939,61 @@ func (d *SQLDatabase) GetFeedback(feedbackType, cursor string, n int) (string, [
 	}
 	return "", feedbacks, nil
 }
+
+// scanItems reads items (item_id, time_stamp, labels, expire_time, hidden) from rows.
+func (d *SQLDatabase) scanItems(result *sql.Rows) ([]Item, error) {
+	defer result.Close()
+	items := make([]Item, 0)
+	for result.Next() {
+		var item Item
+		var labels string
+		var expireTime sql.NullTime
+		if err := result.Scan(&item.ItemId, &item.Timestamp, &labels, &expireTime, &item.Hidden); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(labels), &item.Labels); err != nil {
+			return nil, err
+		}
+		item.Timestamp = d.fixTime(item.Timestamp)
+		if expireTime.Valid {
+			t := d.fixTime(expireTime.Time)
+			item.ExpireTime = &t
+		}
+		items = append(items, item)
+	}
+	return items, result.Err()
+}
+
+// scanFeedback reads feedback (feedback_type, user_id, item_id, time_stamp, value) from rows.
+func (d *SQLDatabase) scanFeedback(result *sql.Rows) ([]Feedback, error) {
+	defer result.Close()
+	feedbacks := make([]Feedback, 0)
+	for result.Next() {
+		var feedback Feedback
+		if err := result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Value, &feedback.Count); err != nil {
+			return nil, err
+		}
+		feedback.Timestamp = d.fixTime(feedback.Timestamp)
+		feedbacks = append(feedbacks, feedback)
+	}
+	return feedbacks, result.Err()
+}
+
+// nullableTime converts a timestamp to an argument of queries. Nil is converted to NULL.
+func (d *SQLDatabase) nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	} else if d.driver == sqlutil.MySQL {
+		return *t
+	}
+	return t.UTC()
+}
+
+// fixTime converts timestamps to UTC. The PostgreSQL and SQLite drivers return them in
+// an anonymous zone with zero offset.
+func (d *SQLDatabase) fixTime(t time.Time) time.Time {
+	if d.driver != sqlutil.MySQL {
+		return t.In(time.UTC)
+	}
+	return t
+}
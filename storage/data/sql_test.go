@@ -56,7 +56,7 @@ func newTestSQLDatabase(t *testing.T, dbName string) *testSQLDatabase {
 	database := new(testSQLDatabase)
 	var err error
 	// create database
-	database.Database, err = Open(sqlUri + "?timeout=30s&parseTime=true")
+	database.Database, err = Open(sqlUri+"?timeout=30s&parseTime=true", "")
 	assert.Nil(t, err)
 	dbName = "gorse_" + dbName
 	databaseComm := database.GetComm(t)
@@ -65,7 +65,7 @@ func newTestSQLDatabase(t *testing.T, dbName string) *testSQLDatabase {
 	_, err = databaseComm.Exec("CREATE DATABASE " + dbName)
 	assert.Nil(t, err)
 	// connect database
-	database.Database, err = Open(sqlUri + dbName + "?timeout=30s&parseTime=true")
+	database.Database, err = Open(sqlUri+dbName+"?timeout=30s&parseTime=true", "")
 	assert.Nil(t, err)
 	// create schema
 	err = database.Init()
@@ -85,6 +85,12 @@ func TestSQLDatabase_Feedback(t *testing.T) {
 	testFeedback(t, db.Database)
 }
 
+func TestSQLDatabase_FeedbackType(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_FeedbackType")
+	defer db.Close(t)
+	testFeedbackType(t, db.Database)
+}
+
 func TestSQLDatabase_Item(t *testing.T) {
 	db := newTestSQLDatabase(t, "TestSQLDatabase_Item")
 	defer db.Close(t)
@@ -102,3 +108,68 @@ func TestSQLDatabase_DeleteItem(t *testing.T) {
 	defer db.Close(t)
 	testDeleteItem(t, db.Database)
 }
+
+func TestSQLDatabase_ItemVisibility(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_ItemVisibility")
+	defer db.Close(t)
+	testItemVisibility(t, db.Database)
+}
+
+func TestSQLDatabase_Migrate(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Migrate")
+	defer db.Close(t)
+	testMigrate(t, db.Database)
+}
+
+func TestSQLDatabase_BatchInsert(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_BatchInsert")
+	defer db.Close(t)
+	testBatchInsert(t, db.Database)
+}
+
+func TestSQLDatabase_CancelContext(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_CancelContext")
+	defer db.Close(t)
+	testCancelContext(t, db.Database)
+}
+
+func TestSQLDatabase_DeleteFeedback(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_DeleteFeedback")
+	defer db.Close(t)
+	testDeleteFeedback(t, db.Database)
+}
+
+func TestSQLDatabase_UpdateItem(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_UpdateItem")
+	defer db.Close(t)
+	testUpdateItem(t, db.Database)
+}
+
+func TestSQLDatabase_UpdateUser(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_UpdateUser")
+	defer db.Close(t)
+	testUpdateUser(t, db.Database)
+}
+
+func TestSQLDatabase_Erasure(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Erasure")
+	defer db.Close(t)
+	testErasure(t, db.Database)
+}
+
+func TestSQLDatabase_CountFeedback(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_CountFeedback")
+	defer db.Close(t)
+	testCountFeedback(t, db.Database)
+}
+
+func TestSQLDatabase_Namespace(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Namespace")
+	defer db.Close(t)
+	tenantDB, err := Open(sqlUri+"gorse_TestSQLDatabase_Namespace?timeout=30s&parseTime=true", "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	err = tenantDB.Init()
+	assert.Nil(t, err)
+	testNamespace(t, db.Database, tenantDB)
+}
@@ -0,0 +1,352 @@
+// Copyright 2020 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/storage/sqlutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testSQLite struct {
+	Database
+	dir string
+}
+
+func (db *testSQLite) Close(t *testing.T) {
+	err := db.Database.Close()
+	assert.Nil(t, err)
+	err = os.RemoveAll(db.dir)
+	assert.Nil(t, err)
+}
+
+func newTestSQLiteDatabase(t *testing.T, dbName string) *testSQLite {
+	database := new(testSQLite)
+	var err error
+	// create database
+	database.dir, err = ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	database.Database, err = Open(sqlitePrefix+filepath.Join(database.dir, dbName+".db"), "")
+	assert.Nil(t, err)
+	// create schema
+	err = database.Init()
+	assert.Nil(t, err)
+	return database
+}
+
+func TestSQLite_Users(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Users")
+	defer db.Close(t)
+	testUsers(t, db.Database)
+}
+
+func TestSQLite_Feedback(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Feedback")
+	defer db.Close(t)
+	testFeedback(t, db.Database)
+}
+
+func TestSQLite_FeedbackType(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_FeedbackType")
+	defer db.Close(t)
+	testFeedbackType(t, db.Database)
+}
+
+func TestSQLite_Item(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Item")
+	defer db.Close(t)
+	testItems(t, db.Database)
+}
+
+func TestSQLite_DeleteUser(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_DeleteUser")
+	defer db.Close(t)
+	testDeleteUser(t, db.Database)
+}
+
+func TestSQLite_DeleteItem(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_DeleteItem")
+	defer db.Close(t)
+	testDeleteItem(t, db.Database)
+}
+
+func TestSQLite_ItemVisibility(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_ItemVisibility")
+	defer db.Close(t)
+	testItemVisibility(t, db.Database)
+}
+
+func TestSQLite_Migrate(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Migrate")
+	defer db.Close(t)
+	testMigrate(t, db.Database)
+}
+
+func TestSQLite_BatchInsert(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_BatchInsert")
+	defer db.Close(t)
+	testBatchInsert(t, db.Database)
+}
+
+func TestSQLite_CancelContext(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_CancelContext")
+	defer db.Close(t)
+	testCancelContext(t, db.Database)
+}
+
+func TestSQLite_DeleteFeedback(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_DeleteFeedback")
+	defer db.Close(t)
+	testDeleteFeedback(t, db.Database)
+}
+
+func TestSQLite_UpdateItem(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_UpdateItem")
+	defer db.Close(t)
+	testUpdateItem(t, db.Database)
+}
+
+func TestSQLite_UpdateUser(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_UpdateUser")
+	defer db.Close(t)
+	testUpdateUser(t, db.Database)
+}
+
+func TestSQLite_Erasure(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Erasure")
+	defer db.Close(t)
+	testErasure(t, db.Database)
+}
+
+func TestSQLite_CountFeedback(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_CountFeedback")
+	defer db.Close(t)
+	testCountFeedback(t, db.Database)
+}
+
+func TestSQLite_BatchInsertFailure(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_BatchInsertFailure")
+	defer db.Close(t)
+	// reject an item by a trigger
+	_, err := db.Database.(*SQLDatabase).db.Exec("CREATE TRIGGER reject_item BEFORE INSERT ON items " +
+		"WHEN NEW.item_id = '1' BEGIN SELECT RAISE(ABORT, 'rejected'); END")
+	assert.Nil(t, err)
+	items := []Item{{ItemId: "0"}, {ItemId: "1"}, {ItemId: "2"}}
+	err = db.BatchInsertItem(context.Background(), items)
+	batchError, ok := err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, []int{1}, batchError.Indices())
+	_, err = db.GetItem(context.Background(), "0")
+	assert.Nil(t, err)
+	_, err = db.GetItem(context.Background(), "2")
+	assert.Nil(t, err)
+	// reject feedback of the item
+	feedback := []Feedback{
+		{FeedbackKey: FeedbackKey{"click", "0", "0"}},
+		{FeedbackKey: FeedbackKey{"click", "0", "1"}},
+		{FeedbackKey: FeedbackKey{"click", "0", "2"}},
+	}
+	err = db.BatchInsertFeedback(context.Background(), feedback, true, true)
+	batchError, ok = err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, []int{1}, batchError.Indices())
+	ret, err := db.GetUserFeedback(context.Background(), "click", "0")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ret))
+}
+
+// sqliteBaselineSchema is the schema created by the first release supporting SQLite, before values of feedback and
+// migrations were introduced.
+var sqliteBaselineSchema = []string{
+	"CREATE TABLE IF NOT EXISTS items (" +
+		"item_id varchar(256) NOT NULL," +
+		"time_stamp datetime NOT NULL DEFAULT '0001-01-01 00:00:00+00:00'," +
+		"labels text NOT NULL DEFAULT '[]'," +
+		"PRIMARY KEY(item_id)" +
+		")",
+	"CREATE TABLE IF NOT EXISTS users (" +
+		"user_id varchar(256) NOT NULL," +
+		"labels text NOT NULL DEFAULT '[]'," +
+		"PRIMARY KEY (user_id)" +
+		")",
+	"CREATE TABLE IF NOT EXISTS feedback (" +
+		"feedback_type varchar(256) NOT NULL," +
+		"user_id varchar(256) NOT NULL," +
+		"item_id varchar(256) NOT NULL," +
+		"time_stamp datetime NOT NULL," +
+		"PRIMARY KEY(feedback_type, user_id, item_id)" +
+		")",
+	"CREATE INDEX IF NOT EXISTS feedback_user_id ON feedback(user_id)",
+	"CREATE INDEX IF NOT EXISTS feedback_item_id ON feedback(item_id)",
+}
+
+func TestSQLite_MigrateLegacySchema(t *testing.T) {
+	for name, test := range map[string]struct {
+		statements []string
+		insert     string
+		value      float64
+	}{
+		// tables created by the first release
+		"baseline": {
+			statements: sqliteBaselineSchema,
+			insert:     "INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp) VALUES ('click', '0', '0', '1996-03-15')",
+			value:      1,
+		},
+		// tables created by releases adding values to feedback before migrations
+		"valued": {
+			statements: append(append([]string(nil), sqliteBaselineSchema...),
+				"ALTER TABLE feedback ADD COLUMN value real NOT NULL DEFAULT 1"),
+			insert: "INSERT INTO feedback(feedback_type, user_id, item_id, time_stamp, value) VALUES ('click', '0', '0', '1996-03-15', 2)",
+			value:  2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gorse")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+			database, err := Open(sqlitePrefix+filepath.Join(dir, "TestSQLite_MigrateLegacySchema.db"), "")
+			assert.Nil(t, err)
+			defer database.Close()
+			// create tables without versions of schema
+			db := database.(*SQLDatabase)
+			for _, statement := range test.statements {
+				_, err = db.db.Exec(statement)
+				assert.Nil(t, err)
+			}
+			_, err = db.db.Exec(test.insert)
+			assert.Nil(t, err)
+			// dry run
+			migrations, err := database.Migrate(context.Background(), true)
+			assert.Nil(t, err)
+			assert.Equal(t, []Migration{
+				{1, "create tables of items, users and feedback"},
+				{2, "add value to feedback"},
+				{3, "add expire time and hidden flag to items"},
+				{4, "add count to feedback"},
+				{5, "create table of erasures"},
+			}, migrations)
+			_, err = db.db.Exec("SELECT count FROM feedback")
+			assert.NotNil(t, err)
+			// migrate
+			migrations, err = database.Migrate(context.Background(), false)
+			assert.Nil(t, err)
+			assert.Equal(t, 5, len(migrations))
+			feedback, err := database.GetUserFeedback(context.Background(), "click", "0")
+			assert.Nil(t, err)
+			assert.Equal(t, []Feedback{{
+				FeedbackKey: FeedbackKey{"click", "0", "0"},
+				Timestamp:   time.Date(1996, 3, 15, 0, 0, 0, 0, time.UTC),
+				Value:       test.value,
+				Count:       1,
+			}}, feedback)
+			// migrate again
+			migrations, err = database.Migrate(context.Background(), false)
+			assert.Nil(t, err)
+			assert.Empty(t, migrations)
+		})
+	}
+}
+
+func TestSQLite_MigrateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	database, err := Open(sqlitePrefix+filepath.Join(dir, "TestSQLite_MigrateFailure.db"), "")
+	assert.Nil(t, err)
+	defer database.Close()
+	// the second statement of migration 3 fails
+	db := database.(*SQLDatabase)
+	err = sqlutil.Transaction(context.Background(), db.db, func(txn *sql.Tx) error {
+		return db.createTables(context.Background(), txn)
+	})
+	assert.Nil(t, err)
+	_, err = db.db.Exec("ALTER TABLE items ADD COLUMN hidden boolean")
+	assert.Nil(t, err)
+	migrations, err := database.Migrate(context.Background(), false)
+	assert.NotNil(t, err)
+	assert.Equal(t, []Migration{
+		{1, "create tables of items, users and feedback"},
+		{2, "add value to feedback"},
+	}, migrations)
+	// migration 3 is rolled back
+	_, err = db.db.Exec("SELECT expire_time FROM items")
+	assert.NotNil(t, err)
+	migrations, err = database.Migrate(context.Background(), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{
+		{3, "add expire time and hidden flag to items"},
+		{4, "add count to feedback"},
+		{5, "create table of erasures"},
+	}, migrations)
+}
+
+func TestSQLite_Namespace(t *testing.T) {
+	db := newTestSQLiteDatabase(t, "TestSQLite_Namespace")
+	defer db.Close(t)
+	tenantDB, err := Open(sqlitePrefix+filepath.Join(db.dir, "TestSQLite_Namespace.db"), "tenant")
+	assert.Nil(t, err)
+	defer tenantDB.Close()
+	err = tenantDB.Init()
+	assert.Nil(t, err)
+	testNamespace(t, db.Database, tenantDB)
+}
+
+func TestSQLite_Replica(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	primaryPath := sqlitePrefix + filepath.Join(dir, "primary.db")
+	replicaPath := sqlitePrefix + filepath.Join(dir, "replica.db")
+	// the replica lags behind the primary
+	for path, itemId := range map[string]string{primaryPath: "1", replicaPath: "0"} {
+		database, err := Open(path, "")
+		assert.Nil(t, err)
+		err = database.Init()
+		assert.Nil(t, err)
+		err = database.InsertItem(context.Background(), Item{ItemId: itemId})
+		assert.Nil(t, err)
+		err = database.Close()
+		assert.Nil(t, err)
+	}
+	database, err := OpenWithReplica(primaryPath, replicaPath, "")
+	assert.Nil(t, err)
+	defer database.Close()
+	// bulk reads are routed to the replica
+	_, items, err := database.GetItems(context.Background(), "", 10, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "0", items[0].ItemId)
+	// other reads are routed to the primary
+	item, err := database.GetItem(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", item.ItemId)
+	// fall back to the primary if the replica is down
+	err = database.(*SQLDatabase).replica.Close()
+	assert.Nil(t, err)
+	_, items, err = database.GetItems(context.Background(), "", 10, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "1", items[0].ItemId)
+	// read replicas of other databases are not supported
+	_, err = OpenWithReplica(memoryPrefix, replicaPath, "")
+	assert.NotNil(t, err)
+	_, err = OpenWithReplica(primaryPath, memoryPrefix, "")
+	assert.NotNil(t, err)
+}
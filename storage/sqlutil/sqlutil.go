@@ -0,0 +1,68 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sqlutil
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Driver is the dialect spoken by a SQL database.
+type Driver int
+
+const (
+	MySQL Driver = iota
+	Postgres
+	SQLite
+)
+
+// Rebind replaces "?" placeholders by "$n" placeholders for PostgreSQL.
+func (driver Driver) Rebind(query string) string {
+	if driver != Postgres {
+		return query
+	}
+	buf := make([]byte, 0, len(query)+8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			buf = append(buf, '$')
+			buf = append(buf, strconv.Itoa(n)...)
+		} else {
+			buf = append(buf, query[i])
+		}
+	}
+	return string(buf)
+}
+
+// Placeholders generates placeholders of n rows with given number of columns, such as "(?,?),(?,?)".
+func Placeholders(n, columns int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", columns), ",") + ")"
+	return strings.TrimSuffix(strings.Repeat(row+",", n), ",")
+}
+
+// Transaction runs f in a transaction. The transaction is rolled back if f fails.
+func Transaction(ctx context.Context, db *sql.DB, f func(txn *sql.Tx) error) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = f(txn); err != nil {
+		txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sqlutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriver_Rebind(t *testing.T) {
+	query := "SELECT * FROM items WHERE item_id = ? AND time_stamp >= ?"
+	assert.Equal(t, query, MySQL.Rebind(query))
+	assert.Equal(t, query, SQLite.Rebind(query))
+	assert.Equal(t, "SELECT * FROM items WHERE item_id = $1 AND time_stamp >= $2", Postgres.Rebind(query))
+}
+
+func TestPlaceholders(t *testing.T) {
+	assert.Equal(t, "(?,?,?)", Placeholders(1, 3))
+	assert.Equal(t, "(?,?),(?,?)", Placeholders(2, 2))
+}
@@ -16,7 +16,6 @@ package worker
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -29,6 +28,9 @@ import (
 	"google.golang.org/grpc"
 )
 
+// batchSize is the number of items pulled from the data store in a batch.
+const batchSize = 1000
+
 type Worker struct {
 	cfg        *config.Config
 	cacheStore cache.Database
@@ -43,6 +45,9 @@ type Worker struct {
 	Jobs              int
 	MatchModelVersion int64
 	MatchModel        cf.MatrixFactorization
+
+	// tenant is the name of the tenant served by the worker, which is empty for the default tenant.
+	tenant string
 }
 
 func NewWorker(masterHost string, masterPort int, jobs int) *Worker {
@@ -53,50 +58,56 @@ func NewWorker(masterHost string, masterPort int, jobs int) *Worker {
 	}
 }
 
+// Register keeps the worker registered to the master. Failures are retried in the next period, during which masters
+// might fail over.
 func (w *Worker) Register() {
 	for {
 		if _, err := w.MasterClient.RegisterWorker(context.Background(), &protocol.Void{}); err != nil {
-			log.Fatal("worker:", err)
+			log.Errorf("worker: failed to register (%v)", err)
 		}
 		time.Sleep(time.Duration(w.cfg.Master.ClusterMetaTimeout/2) * time.Second)
 	}
 }
 
 func (w *Worker) Sync() {
+	ctx := protocol.WithTenant(context.Background(), w.tenant)
 	for {
 		// pull model version
 		log.Info("worker: pull model version from master")
-		matchModel, err := w.MasterClient.GetMatchModelVersion(context.Background(), &protocol.Void{})
+		matchModel, err := w.MasterClient.GetMatchModelVersion(ctx, &protocol.Void{})
 		if err != nil {
 			log.Errorf("worker: failed to pull model version (%v)", err)
-		}
-
-		// pull model
-		if matchModel.Version != w.MatchModelVersion {
+		} else if matchModel.Version != w.MatchModelVersion {
 			log.Infof("worker: found new model version (%x)", matchModel.Version)
 			// pull model
-			matchModel, err = w.MasterClient.GetMatchModel(context.Background(), &protocol.Void{},
-				grpc.MaxCallRecvMsgSize(10e9))
-			if err != nil {
+			if err = w.pullMatchModel(ctx); err != nil {
 				log.Errorf("worker: failed to pull model (%v)", err)
 			}
 		}
 
-		w.MatchModel, err = cf.DecodeModel(matchModel.Name, matchModel.Model)
-		w.MatchModelVersion = matchModel.Version
-		if err != nil {
-			log.Errorf("worker: failed to decode model (%v)", err)
-		}
-
 		// sleep
 		time.Sleep(time.Minute)
 	}
 }
 
+// pullMatchModel pulls the match model from the master.
+func (w *Worker) pullMatchModel(ctx context.Context) error {
+	matchModel, err := w.MasterClient.GetMatchModel(ctx, &protocol.Void{}, grpc.MaxCallRecvMsgSize(10e9))
+	if err != nil {
+		return err
+	}
+	nextModel, err := cf.DecodeModel(matchModel.Name, matchModel.Model)
+	if err != nil {
+		return err
+	}
+	w.MatchModel, w.MatchModelVersion = nextModel, matchModel.Version
+	return nil
+}
+
 func (w *Worker) Serve() {
 
-	// connect to master
-	conn, err := grpc.Dial(fmt.Sprintf("%v:%v", w.MasterHost, w.MasterPort), grpc.WithInsecure())
+	// connect to masters
+	conn, err := protocol.DialMasters(protocol.MasterAddresses(w.MasterHost, w.MasterPort), grpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("worker: failed to connect master (%v)", err)
 	}
@@ -112,14 +123,13 @@ func (w *Worker) Serve() {
 		log.Fatalf("worker: failed to parse master config (%v)", err)
 	}
 
-	// connect to data store
-	if w.dataStore, err = data.Open(w.cfg.Database.DataStore); err != nil {
-		log.Fatalf("worker: failed to connect data store (%v)", err)
-	}
-
-	// connect to cache store
-	if w.cacheStore, err = cache.Open(w.cfg.Database.CacheStore); err != nil {
-		log.Fatalf("worker: failed to connect cache store (%v)", err)
+	// connect to databases
+	w.connect()
+	for name := range w.cfg.Tenants {
+		tenant := w.newTenant(name)
+		tenant.connect()
+		go tenant.Sync()
+		go tenant.Loop()
 	}
 
 	// register to master
@@ -127,16 +137,43 @@ func (w *Worker) Serve() {
 	// sync model
 	go w.Sync()
 
+	w.Loop()
+}
+
+// newTenant creates the worker of a tenant, which shares the connection to the master.
+func (w *Worker) newTenant(name string) *Worker {
+	tenant := NewWorker(w.MasterHost, w.MasterPort, w.Jobs)
+	tenant.cfg, _ = w.cfg.Tenant(name)
+	tenant.MasterClient = w.MasterClient
+	tenant.tenant = name
+	return tenant
+}
+
+// connect connects to databases in the namespace of the tenant.
+func (w *Worker) connect() {
+	var err error
+	if w.dataStore, err = data.OpenWithReplica(w.cfg.Database.DataStore, w.cfg.Database.DataStoreReplica, w.tenant); err != nil {
+		log.Fatalf("worker: failed to connect data store (%v)", err)
+	}
+	if w.cacheStore, err = cache.Open(w.cfg.Database.CacheStore, w.tenant); err != nil {
+		log.Fatalf("worker: failed to connect cache store (%v)", err)
+	}
+}
+
+// Loop generates matched items for users allocated to the worker periodically.
+func (w *Worker) Loop() {
 	for {
 		if w.MatchModel != nil {
 			// get cluster
 			cluster, err := w.MasterClient.GetCluster(context.Background(), &protocol.Void{})
 			if err != nil {
 				log.Errorf("worker: failed to get cluster info (%v)", err)
+				time.Sleep(time.Minute)
+				continue
 			}
 
 			workingUsers := Split(w.MatchModel.GetUserIndex(), cluster.Workers, cluster.Me)
-			w.GenerateMatchItems(w.MatchModel, workingUsers)
+			w.GenerateMatchItems(context.Background(), w.MatchModel, workingUsers)
 
 			// sleep
 			time.Sleep(time.Duration(w.cfg.CF.PredictPeriod) * time.Minute)
@@ -146,9 +183,15 @@ func (w *Worker) Serve() {
 	}
 }
 
-func (w *Worker) GenerateMatchItems(m cf.MatrixFactorization, users []string) {
+// GenerateMatchItems generates matched items for users. Items seen by users, hidden items and expired items are
+// excluded.
+func (w *Worker) GenerateMatchItems(ctx context.Context, m cf.MatrixFactorization, users []string) {
 	// get items
 	items := m.GetItemIndex().GetNames()
+	unavailableItems, err := w.pullUnavailableItems(ctx)
+	if err != nil {
+		log.Fatalf("worker: failed to pull items (%v)", err)
+	}
 	log.Infof("worker: generate match items for %v users among %v items (n_jobs = %v)", len(users), len(items), w.Jobs)
 	// progress tracker
 	completed := make(chan interface{})
@@ -170,8 +213,16 @@ func (w *Worker) GenerateMatchItems(m cf.MatrixFactorization, users []string) {
 	// generate match items
 	_ = base.Parallel(len(users), w.Jobs, func(workerId, jobId int) error {
 		user := users[jobId]
+		// skip erased users since the model might be trained before erasure
+		if _, err := w.dataStore.GetUser(ctx, user); err != nil {
+			if err.Error() != data.ErrUserNotExist {
+				log.Errorf("worker: failed to pull user (user_id = %v, err = %v)", user, err)
+			}
+			completed <- nil
+			return nil
+		}
 		// remove saw items
-		historyFeedback, err := w.dataStore.GetUserFeedback("", user)
+		historyFeedback, err := w.dataStore.GetUserFeedback(ctx, "", user)
 		if err != nil {
 			log.Fatalf("worker: failed to pull user feedback (%v)", err)
 		}
@@ -181,12 +232,12 @@ func (w *Worker) GenerateMatchItems(m cf.MatrixFactorization, users []string) {
 		}
 		recItems := base.NewTopKStringFilter(w.cfg.Similar.NumSimilar)
 		for _, item := range items {
-			if !historySet.Contain(item) {
+			if !historySet.Contain(item) && !unavailableItems.Contain(item) {
 				recItems.Push(item, m.Predict(user, item))
 			}
 		}
-		elems, _ := recItems.PopAll()
-		if err := w.cacheStore.SetList(cache.MatchedItems, user, elems); err != nil {
+		elems, scores := recItems.PopAll()
+		if err := w.cacheStore.SetScores(ctx, cache.MatchedItems, user, cache.CreateScoredItems(elems, scores)); err != nil {
 			log.Fatalf("worker: failed to push matched items (%v)", err)
 		}
 		completed <- nil
@@ -195,6 +246,29 @@ func (w *Worker) GenerateMatchItems(m cf.MatrixFactorization, users []string) {
 	close(completed)
 }
 
+// pullUnavailableItems pulls identifiers of items that are hidden or expired from the data store.
+func (w *Worker) pullUnavailableItems(ctx context.Context) (base.StringSet, error) {
+	now := time.Now()
+	unavailableItems := base.NewStringSet()
+	cursor := ""
+	for {
+		var items []data.Item
+		var err error
+		cursor, items, err = w.dataStore.GetItems(ctx, cursor, batchSize, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if !item.IsAvailable(now) {
+				unavailableItems.Add(item.ItemId)
+			}
+		}
+		if cursor == "" {
+			return unavailableItems, nil
+		}
+	}
+}
+
 func Split(userIndex base.Index, nodes []string, me string) []string {
 	// locate me
 	pos := -1
@@ -12,3 +12,68 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 package worker
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/cf"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"github.com/zhenghaoz/gorse/storage/data"
+)
+
+// mockMatrixFactorization predicts scores of items by their identifiers.
+type mockMatrixFactorization struct {
+	cf.MatrixFactorization
+	itemIndex base.Index
+}
+
+func (m *mockMatrixFactorization) Predict(userId, itemId string) float32 {
+	score, _ := strconv.Atoi(itemId)
+	return float32(score)
+}
+
+func (m *mockMatrixFactorization) GetItemIndex() base.Index {
+	return m.itemIndex
+}
+
+func TestWorker_GenerateMatchItems(t *testing.T) {
+	var err error
+	w := NewWorker("", 0, 1)
+	w.cfg = (*config.Config)(nil).LoadDefaultIfNil()
+	w.dataStore, err = data.Open("memory://", "")
+	assert.Nil(t, err)
+	defer w.dataStore.Close()
+	w.cacheStore, err = cache.Open("memory://", "")
+	assert.Nil(t, err)
+	defer w.cacheStore.Close()
+	// item 0: seen
+	// item 2: hidden
+	// item 3: expired
+	expireTime := time.Now().Add(-time.Hour)
+	err = w.dataStore.BatchInsertItem(context.Background(), []data.Item{
+		{ItemId: "0"}, {ItemId: "1"}, {ItemId: "2", Hidden: true}, {ItemId: "3", ExpireTime: &expireTime}, {ItemId: "4"},
+	})
+	assert.Nil(t, err)
+	err = w.dataStore.InsertFeedback(context.Background(), data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "a", ItemId: "0"},
+	}, true, false)
+	assert.Nil(t, err)
+	m := &mockMatrixFactorization{itemIndex: base.NewMapIndex()}
+	for i := 0; i < 5; i++ {
+		m.itemIndex.Add(strconv.Itoa(i))
+	}
+	// user b has been erased
+	w.GenerateMatchItems(context.Background(), m, []string{"a", "b"})
+	matchedItems, err := w.cacheStore.GetScores(context.Background(), cache.MatchedItems, "a", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{ItemId: "4", Score: 4}, {ItemId: "1", Score: 1}}, matchedItems)
+	matchedItems, err = w.cacheStore.GetScores(context.Background(), cache.MatchedItems, "b", 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, matchedItems)
+}